@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/OSMeteor/firetower/service/manager"
 
@@ -21,6 +22,21 @@ func init() {
 }
 func main() {
 	m := &manager.Manager{}
+	if port, ok := ConfigTree.Get("http.port").(int64); ok {
+		manager.HttpAddress = fmt.Sprintf(":%d", port)
+		manager.AdminToken, _ = ConfigTree.Get("http.admintoken").(string)
+		manager.PublicStats, _ = ConfigTree.Get("http.publicstats").(bool)
+		go manager.HttpDashboard()
+	}
+	if size, ok := ConfigTree.Get("gateway.queuesize").(int64); ok {
+		manager.GatewayQueueSize = int(size)
+	}
+	if policy, ok := ConfigTree.Get("gateway.overflow").(string); ok {
+		manager.GatewayOverflowPolicy = policy
+	}
+	if sec, ok := ConfigTree.Get("gateway.writetimeout").(int64); ok {
+		manager.GatewayWriteTimeout = time.Duration(sec) * time.Second
+	}
 	go m.StartGrpcService(fmt.Sprintf(":%d", ConfigTree.Get("grpc.port").(int64)))
 	m.StartSocketService(fmt.Sprintf("0.0.0.0:%d", ConfigTree.Get("socket.port").(int64)))
 }
@@ -34,7 +34,7 @@ func (m *GetConnectNumRequest) Reset()         { *m = GetConnectNumRequest{} }
 func (m *GetConnectNumRequest) String() string { return proto.CompactTextString(m) }
 func (*GetConnectNumRequest) ProtoMessage()    {}
 func (*GetConnectNumRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_topicmanage_fc3522fc6bd4a59f, []int{0}
+	return fileDescriptor_topicmanage_426b62343708aee2, []int{0}
 }
 func (m *GetConnectNumRequest) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_GetConnectNumRequest.Unmarshal(m, b)
@@ -72,7 +72,7 @@ func (m *GetConnectNumResponse) Reset()         { *m = GetConnectNumResponse{} }
 func (m *GetConnectNumResponse) String() string { return proto.CompactTextString(m) }
 func (*GetConnectNumResponse) ProtoMessage()    {}
 func (*GetConnectNumResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_topicmanage_fc3522fc6bd4a59f, []int{1}
+	return fileDescriptor_topicmanage_426b62343708aee2, []int{1}
 }
 func (m *GetConnectNumResponse) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_GetConnectNumResponse.Unmarshal(m, b)
@@ -111,7 +111,7 @@ func (m *SubscribeTopicRequest) Reset()         { *m = SubscribeTopicRequest{} }
 func (m *SubscribeTopicRequest) String() string { return proto.CompactTextString(m) }
 func (*SubscribeTopicRequest) ProtoMessage()    {}
 func (*SubscribeTopicRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_topicmanage_fc3522fc6bd4a59f, []int{2}
+	return fileDescriptor_topicmanage_426b62343708aee2, []int{2}
 }
 func (m *SubscribeTopicRequest) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_SubscribeTopicRequest.Unmarshal(m, b)
@@ -155,7 +155,7 @@ func (m *SubscribeTopicResponse) Reset()         { *m = SubscribeTopicResponse{}
 func (m *SubscribeTopicResponse) String() string { return proto.CompactTextString(m) }
 func (*SubscribeTopicResponse) ProtoMessage()    {}
 func (*SubscribeTopicResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_topicmanage_fc3522fc6bd4a59f, []int{3}
+	return fileDescriptor_topicmanage_426b62343708aee2, []int{3}
 }
 func (m *SubscribeTopicResponse) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_SubscribeTopicResponse.Unmarshal(m, b)
@@ -187,7 +187,7 @@ func (m *UnSubscribeTopicRequest) Reset()         { *m = UnSubscribeTopicRequest
 func (m *UnSubscribeTopicRequest) String() string { return proto.CompactTextString(m) }
 func (*UnSubscribeTopicRequest) ProtoMessage()    {}
 func (*UnSubscribeTopicRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_topicmanage_fc3522fc6bd4a59f, []int{4}
+	return fileDescriptor_topicmanage_426b62343708aee2, []int{4}
 }
 func (m *UnSubscribeTopicRequest) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_UnSubscribeTopicRequest.Unmarshal(m, b)
@@ -231,7 +231,7 @@ func (m *UnSubscribeTopicResponse) Reset()         { *m = UnSubscribeTopicRespon
 func (m *UnSubscribeTopicResponse) String() string { return proto.CompactTextString(m) }
 func (*UnSubscribeTopicResponse) ProtoMessage()    {}
 func (*UnSubscribeTopicResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_topicmanage_fc3522fc6bd4a59f, []int{5}
+	return fileDescriptor_topicmanage_426b62343708aee2, []int{5}
 }
 func (m *UnSubscribeTopicResponse) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_UnSubscribeTopicResponse.Unmarshal(m, b)
@@ -256,6 +256,8 @@ type PublishRequest struct {
 	Data                 []byte   `protobuf:"bytes,2,opt,name=Data,proto3" json:"Data,omitempty"`
 	MessageId            string   `protobuf:"bytes,3,opt,name=MessageId,proto3" json:"MessageId,omitempty"`
 	Source               string   `protobuf:"bytes,4,opt,name=Source,proto3" json:"Source,omitempty"`
+	Ttl                  int64    `protobuf:"varint,5,opt,name=Ttl,proto3" json:"Ttl,omitempty"`
+	Deadline             int64    `protobuf:"varint,6,opt,name=Deadline,proto3" json:"Deadline,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -265,7 +267,7 @@ func (m *PublishRequest) Reset()         { *m = PublishRequest{} }
 func (m *PublishRequest) String() string { return proto.CompactTextString(m) }
 func (*PublishRequest) ProtoMessage()    {}
 func (*PublishRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_topicmanage_fc3522fc6bd4a59f, []int{6}
+	return fileDescriptor_topicmanage_426b62343708aee2, []int{6}
 }
 func (m *PublishRequest) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_PublishRequest.Unmarshal(m, b)
@@ -313,6 +315,20 @@ func (m *PublishRequest) GetSource() string {
 	return ""
 }
 
+func (m *PublishRequest) GetTtl() int64 {
+	if m != nil {
+		return m.Ttl
+	}
+	return 0
+}
+
+func (m *PublishRequest) GetDeadline() int64 {
+	if m != nil {
+		return m.Deadline
+	}
+	return 0
+}
+
 type PublishResponse struct {
 	Ok                   bool     `protobuf:"varint,1,opt,name=Ok,proto3" json:"Ok,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
@@ -324,7 +340,7 @@ func (m *PublishResponse) Reset()         { *m = PublishResponse{} }
 func (m *PublishResponse) String() string { return proto.CompactTextString(m) }
 func (*PublishResponse) ProtoMessage()    {}
 func (*PublishResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_topicmanage_fc3522fc6bd4a59f, []int{7}
+	return fileDescriptor_topicmanage_426b62343708aee2, []int{7}
 }
 func (m *PublishResponse) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_PublishResponse.Unmarshal(m, b)
@@ -362,7 +378,7 @@ func (m *CheckTopicExistRequest) Reset()         { *m = CheckTopicExistRequest{}
 func (m *CheckTopicExistRequest) String() string { return proto.CompactTextString(m) }
 func (*CheckTopicExistRequest) ProtoMessage()    {}
 func (*CheckTopicExistRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_topicmanage_fc3522fc6bd4a59f, []int{8}
+	return fileDescriptor_topicmanage_426b62343708aee2, []int{8}
 }
 func (m *CheckTopicExistRequest) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_CheckTopicExistRequest.Unmarshal(m, b)
@@ -400,7 +416,7 @@ func (m *CheckTopicExistResponse) Reset()         { *m = CheckTopicExistResponse
 func (m *CheckTopicExistResponse) String() string { return proto.CompactTextString(m) }
 func (*CheckTopicExistResponse) ProtoMessage()    {}
 func (*CheckTopicExistResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_topicmanage_fc3522fc6bd4a59f, []int{9}
+	return fileDescriptor_topicmanage_426b62343708aee2, []int{9}
 }
 func (m *CheckTopicExistResponse) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_CheckTopicExistResponse.Unmarshal(m, b)
@@ -427,6 +443,582 @@ func (m *CheckTopicExistResponse) GetOk() bool {
 	return false
 }
 
+type KickUserRequest struct {
+	UserId               string   `protobuf:"bytes,1,opt,name=UserId,proto3" json:"UserId,omitempty"`
+	Topic                string   `protobuf:"bytes,2,opt,name=Topic,proto3" json:"Topic,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *KickUserRequest) Reset()         { *m = KickUserRequest{} }
+func (m *KickUserRequest) String() string { return proto.CompactTextString(m) }
+func (*KickUserRequest) ProtoMessage()    {}
+func (*KickUserRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_topicmanage_426b62343708aee2, []int{10}
+}
+func (m *KickUserRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_KickUserRequest.Unmarshal(m, b)
+}
+func (m *KickUserRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_KickUserRequest.Marshal(b, m, deterministic)
+}
+func (dst *KickUserRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_KickUserRequest.Merge(dst, src)
+}
+func (m *KickUserRequest) XXX_Size() int {
+	return xxx_messageInfo_KickUserRequest.Size(m)
+}
+func (m *KickUserRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_KickUserRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_KickUserRequest proto.InternalMessageInfo
+
+func (m *KickUserRequest) GetUserId() string {
+	if m != nil {
+		return m.UserId
+	}
+	return ""
+}
+
+func (m *KickUserRequest) GetTopic() string {
+	if m != nil {
+		return m.Topic
+	}
+	return ""
+}
+
+type KickUserResponse struct {
+	Gateways             int64    `protobuf:"varint,1,opt,name=Gateways,proto3" json:"Gateways,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *KickUserResponse) Reset()         { *m = KickUserResponse{} }
+func (m *KickUserResponse) String() string { return proto.CompactTextString(m) }
+func (*KickUserResponse) ProtoMessage()    {}
+func (*KickUserResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_topicmanage_426b62343708aee2, []int{11}
+}
+func (m *KickUserResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_KickUserResponse.Unmarshal(m, b)
+}
+func (m *KickUserResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_KickUserResponse.Marshal(b, m, deterministic)
+}
+func (dst *KickUserResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_KickUserResponse.Merge(dst, src)
+}
+func (m *KickUserResponse) XXX_Size() int {
+	return xxx_messageInfo_KickUserResponse.Size(m)
+}
+func (m *KickUserResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_KickUserResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_KickUserResponse proto.InternalMessageInfo
+
+func (m *KickUserResponse) GetGateways() int64 {
+	if m != nil {
+		return m.Gateways
+	}
+	return 0
+}
+
+type RemoveTopicRequest struct {
+	Topic                string   `protobuf:"bytes,1,opt,name=Topic,proto3" json:"Topic,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RemoveTopicRequest) Reset()         { *m = RemoveTopicRequest{} }
+func (m *RemoveTopicRequest) String() string { return proto.CompactTextString(m) }
+func (*RemoveTopicRequest) ProtoMessage()    {}
+func (*RemoveTopicRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_topicmanage_426b62343708aee2, []int{12}
+}
+func (m *RemoveTopicRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RemoveTopicRequest.Unmarshal(m, b)
+}
+func (m *RemoveTopicRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RemoveTopicRequest.Marshal(b, m, deterministic)
+}
+func (dst *RemoveTopicRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RemoveTopicRequest.Merge(dst, src)
+}
+func (m *RemoveTopicRequest) XXX_Size() int {
+	return xxx_messageInfo_RemoveTopicRequest.Size(m)
+}
+func (m *RemoveTopicRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_RemoveTopicRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RemoveTopicRequest proto.InternalMessageInfo
+
+func (m *RemoveTopicRequest) GetTopic() string {
+	if m != nil {
+		return m.Topic
+	}
+	return ""
+}
+
+type RemoveTopicResponse struct {
+	Gateways             int64    `protobuf:"varint,1,opt,name=Gateways,proto3" json:"Gateways,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RemoveTopicResponse) Reset()         { *m = RemoveTopicResponse{} }
+func (m *RemoveTopicResponse) String() string { return proto.CompactTextString(m) }
+func (*RemoveTopicResponse) ProtoMessage()    {}
+func (*RemoveTopicResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_topicmanage_426b62343708aee2, []int{13}
+}
+func (m *RemoveTopicResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RemoveTopicResponse.Unmarshal(m, b)
+}
+func (m *RemoveTopicResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RemoveTopicResponse.Marshal(b, m, deterministic)
+}
+func (dst *RemoveTopicResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RemoveTopicResponse.Merge(dst, src)
+}
+func (m *RemoveTopicResponse) XXX_Size() int {
+	return xxx_messageInfo_RemoveTopicResponse.Size(m)
+}
+func (m *RemoveTopicResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_RemoveTopicResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RemoveTopicResponse proto.InternalMessageInfo
+
+func (m *RemoveTopicResponse) GetGateways() int64 {
+	if m != nil {
+		return m.Gateways
+	}
+	return 0
+}
+
+type UnsubscribeUserRequest struct {
+	Topic                string   `protobuf:"bytes,1,opt,name=Topic,proto3" json:"Topic,omitempty"`
+	UserId               string   `protobuf:"bytes,2,opt,name=UserId,proto3" json:"UserId,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *UnsubscribeUserRequest) Reset()         { *m = UnsubscribeUserRequest{} }
+func (m *UnsubscribeUserRequest) String() string { return proto.CompactTextString(m) }
+func (*UnsubscribeUserRequest) ProtoMessage()    {}
+func (*UnsubscribeUserRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_topicmanage_426b62343708aee2, []int{14}
+}
+func (m *UnsubscribeUserRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_UnsubscribeUserRequest.Unmarshal(m, b)
+}
+func (m *UnsubscribeUserRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_UnsubscribeUserRequest.Marshal(b, m, deterministic)
+}
+func (dst *UnsubscribeUserRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_UnsubscribeUserRequest.Merge(dst, src)
+}
+func (m *UnsubscribeUserRequest) XXX_Size() int {
+	return xxx_messageInfo_UnsubscribeUserRequest.Size(m)
+}
+func (m *UnsubscribeUserRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_UnsubscribeUserRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_UnsubscribeUserRequest proto.InternalMessageInfo
+
+func (m *UnsubscribeUserRequest) GetTopic() string {
+	if m != nil {
+		return m.Topic
+	}
+	return ""
+}
+
+func (m *UnsubscribeUserRequest) GetUserId() string {
+	if m != nil {
+		return m.UserId
+	}
+	return ""
+}
+
+type UnsubscribeUserResponse struct {
+	Gateways             int64    `protobuf:"varint,1,opt,name=Gateways,proto3" json:"Gateways,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *UnsubscribeUserResponse) Reset()         { *m = UnsubscribeUserResponse{} }
+func (m *UnsubscribeUserResponse) String() string { return proto.CompactTextString(m) }
+func (*UnsubscribeUserResponse) ProtoMessage()    {}
+func (*UnsubscribeUserResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_topicmanage_426b62343708aee2, []int{15}
+}
+func (m *UnsubscribeUserResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_UnsubscribeUserResponse.Unmarshal(m, b)
+}
+func (m *UnsubscribeUserResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_UnsubscribeUserResponse.Marshal(b, m, deterministic)
+}
+func (dst *UnsubscribeUserResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_UnsubscribeUserResponse.Merge(dst, src)
+}
+func (m *UnsubscribeUserResponse) XXX_Size() int {
+	return xxx_messageInfo_UnsubscribeUserResponse.Size(m)
+}
+func (m *UnsubscribeUserResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_UnsubscribeUserResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_UnsubscribeUserResponse proto.InternalMessageInfo
+
+func (m *UnsubscribeUserResponse) GetGateways() int64 {
+	if m != nil {
+		return m.Gateways
+	}
+	return 0
+}
+
+type SubscribeRequest struct {
+	Topic                []string `protobuf:"bytes,1,rep,name=Topic,proto3" json:"Topic,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SubscribeRequest) Reset()         { *m = SubscribeRequest{} }
+func (m *SubscribeRequest) String() string { return proto.CompactTextString(m) }
+func (*SubscribeRequest) ProtoMessage()    {}
+func (*SubscribeRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_topicmanage_426b62343708aee2, []int{16}
+}
+func (m *SubscribeRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SubscribeRequest.Unmarshal(m, b)
+}
+func (m *SubscribeRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SubscribeRequest.Marshal(b, m, deterministic)
+}
+func (dst *SubscribeRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SubscribeRequest.Merge(dst, src)
+}
+func (m *SubscribeRequest) XXX_Size() int {
+	return xxx_messageInfo_SubscribeRequest.Size(m)
+}
+func (m *SubscribeRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_SubscribeRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SubscribeRequest proto.InternalMessageInfo
+
+func (m *SubscribeRequest) GetTopic() []string {
+	if m != nil {
+		return m.Topic
+	}
+	return nil
+}
+
+type PushMessage struct {
+	Topic                string   `protobuf:"bytes,1,opt,name=Topic,proto3" json:"Topic,omitempty"`
+	Data                 []byte   `protobuf:"bytes,2,opt,name=Data,proto3" json:"Data,omitempty"`
+	MessageId            string   `protobuf:"bytes,3,opt,name=MessageId,proto3" json:"MessageId,omitempty"`
+	Source               string   `protobuf:"bytes,4,opt,name=Source,proto3" json:"Source,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PushMessage) Reset()         { *m = PushMessage{} }
+func (m *PushMessage) String() string { return proto.CompactTextString(m) }
+func (*PushMessage) ProtoMessage()    {}
+func (*PushMessage) Descriptor() ([]byte, []int) {
+	return fileDescriptor_topicmanage_426b62343708aee2, []int{17}
+}
+func (m *PushMessage) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PushMessage.Unmarshal(m, b)
+}
+func (m *PushMessage) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PushMessage.Marshal(b, m, deterministic)
+}
+func (dst *PushMessage) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PushMessage.Merge(dst, src)
+}
+func (m *PushMessage) XXX_Size() int {
+	return xxx_messageInfo_PushMessage.Size(m)
+}
+func (m *PushMessage) XXX_DiscardUnknown() {
+	xxx_messageInfo_PushMessage.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PushMessage proto.InternalMessageInfo
+
+func (m *PushMessage) GetTopic() string {
+	if m != nil {
+		return m.Topic
+	}
+	return ""
+}
+
+func (m *PushMessage) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+func (m *PushMessage) GetMessageId() string {
+	if m != nil {
+		return m.MessageId
+	}
+	return ""
+}
+
+func (m *PushMessage) GetSource() string {
+	if m != nil {
+		return m.Source
+	}
+	return ""
+}
+
+type PublishBatchRequest struct {
+	Messages             []*PublishRequest `protobuf:"bytes,1,rep,name=Messages,proto3" json:"Messages,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
+}
+
+func (m *PublishBatchRequest) Reset()         { *m = PublishBatchRequest{} }
+func (m *PublishBatchRequest) String() string { return proto.CompactTextString(m) }
+func (*PublishBatchRequest) ProtoMessage()    {}
+func (*PublishBatchRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_topicmanage_426b62343708aee2, []int{18}
+}
+func (m *PublishBatchRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PublishBatchRequest.Unmarshal(m, b)
+}
+func (m *PublishBatchRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PublishBatchRequest.Marshal(b, m, deterministic)
+}
+func (dst *PublishBatchRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PublishBatchRequest.Merge(dst, src)
+}
+func (m *PublishBatchRequest) XXX_Size() int {
+	return xxx_messageInfo_PublishBatchRequest.Size(m)
+}
+func (m *PublishBatchRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_PublishBatchRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PublishBatchRequest proto.InternalMessageInfo
+
+func (m *PublishBatchRequest) GetMessages() []*PublishRequest {
+	if m != nil {
+		return m.Messages
+	}
+	return nil
+}
+
+type MulticastRequest struct {
+	Topic                []string `protobuf:"bytes,1,rep,name=Topic,proto3" json:"Topic,omitempty"`
+	Data                 []byte   `protobuf:"bytes,2,opt,name=Data,proto3" json:"Data,omitempty"`
+	MessageId            string   `protobuf:"bytes,3,opt,name=MessageId,proto3" json:"MessageId,omitempty"`
+	Source               string   `protobuf:"bytes,4,opt,name=Source,proto3" json:"Source,omitempty"`
+	Ttl                  int64    `protobuf:"varint,5,opt,name=Ttl,proto3" json:"Ttl,omitempty"`
+	Deadline             int64    `protobuf:"varint,6,opt,name=Deadline,proto3" json:"Deadline,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *MulticastRequest) Reset()         { *m = MulticastRequest{} }
+func (m *MulticastRequest) String() string { return proto.CompactTextString(m) }
+func (*MulticastRequest) ProtoMessage()    {}
+func (*MulticastRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_topicmanage_426b62343708aee2, []int{19}
+}
+func (m *MulticastRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_MulticastRequest.Unmarshal(m, b)
+}
+func (m *MulticastRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_MulticastRequest.Marshal(b, m, deterministic)
+}
+func (dst *MulticastRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_MulticastRequest.Merge(dst, src)
+}
+func (m *MulticastRequest) XXX_Size() int {
+	return xxx_messageInfo_MulticastRequest.Size(m)
+}
+func (m *MulticastRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_MulticastRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_MulticastRequest proto.InternalMessageInfo
+
+func (m *MulticastRequest) GetTopic() []string {
+	if m != nil {
+		return m.Topic
+	}
+	return nil
+}
+
+func (m *MulticastRequest) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+func (m *MulticastRequest) GetMessageId() string {
+	if m != nil {
+		return m.MessageId
+	}
+	return ""
+}
+
+func (m *MulticastRequest) GetSource() string {
+	if m != nil {
+		return m.Source
+	}
+	return ""
+}
+
+func (m *MulticastRequest) GetTtl() int64 {
+	if m != nil {
+		return m.Ttl
+	}
+	return 0
+}
+
+func (m *MulticastRequest) GetDeadline() int64 {
+	if m != nil {
+		return m.Deadline
+	}
+	return 0
+}
+
+type PublishResult struct {
+	Topic                string   `protobuf:"bytes,1,opt,name=Topic,proto3" json:"Topic,omitempty"`
+	MessageId            string   `protobuf:"bytes,2,opt,name=MessageId,proto3" json:"MessageId,omitempty"`
+	Ok                   bool     `protobuf:"varint,3,opt,name=Ok,proto3" json:"Ok,omitempty"`
+	Gateways             int64    `protobuf:"varint,4,opt,name=Gateways,proto3" json:"Gateways,omitempty"`
+	Error                string   `protobuf:"bytes,5,opt,name=Error,proto3" json:"Error,omitempty"`
+	Failed               int64    `protobuf:"varint,6,opt,name=Failed,proto3" json:"Failed,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PublishResult) Reset()         { *m = PublishResult{} }
+func (m *PublishResult) String() string { return proto.CompactTextString(m) }
+func (*PublishResult) ProtoMessage()    {}
+func (*PublishResult) Descriptor() ([]byte, []int) {
+	return fileDescriptor_topicmanage_426b62343708aee2, []int{20}
+}
+func (m *PublishResult) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PublishResult.Unmarshal(m, b)
+}
+func (m *PublishResult) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PublishResult.Marshal(b, m, deterministic)
+}
+func (dst *PublishResult) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PublishResult.Merge(dst, src)
+}
+func (m *PublishResult) XXX_Size() int {
+	return xxx_messageInfo_PublishResult.Size(m)
+}
+func (m *PublishResult) XXX_DiscardUnknown() {
+	xxx_messageInfo_PublishResult.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PublishResult proto.InternalMessageInfo
+
+func (m *PublishResult) GetTopic() string {
+	if m != nil {
+		return m.Topic
+	}
+	return ""
+}
+
+func (m *PublishResult) GetMessageId() string {
+	if m != nil {
+		return m.MessageId
+	}
+	return ""
+}
+
+func (m *PublishResult) GetOk() bool {
+	if m != nil {
+		return m.Ok
+	}
+	return false
+}
+
+func (m *PublishResult) GetGateways() int64 {
+	if m != nil {
+		return m.Gateways
+	}
+	return 0
+}
+
+func (m *PublishResult) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+func (m *PublishResult) GetFailed() int64 {
+	if m != nil {
+		return m.Failed
+	}
+	return 0
+}
+
+type PublishBatchResponse struct {
+	Results              []*PublishResult `protobuf:"bytes,1,rep,name=Results,proto3" json:"Results,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}         `json:"-"`
+	XXX_unrecognized     []byte           `json:"-"`
+	XXX_sizecache        int32            `json:"-"`
+}
+
+func (m *PublishBatchResponse) Reset()         { *m = PublishBatchResponse{} }
+func (m *PublishBatchResponse) String() string { return proto.CompactTextString(m) }
+func (*PublishBatchResponse) ProtoMessage()    {}
+func (*PublishBatchResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_topicmanage_426b62343708aee2, []int{21}
+}
+func (m *PublishBatchResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PublishBatchResponse.Unmarshal(m, b)
+}
+func (m *PublishBatchResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PublishBatchResponse.Marshal(b, m, deterministic)
+}
+func (dst *PublishBatchResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PublishBatchResponse.Merge(dst, src)
+}
+func (m *PublishBatchResponse) XXX_Size() int {
+	return xxx_messageInfo_PublishBatchResponse.Size(m)
+}
+func (m *PublishBatchResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_PublishBatchResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PublishBatchResponse proto.InternalMessageInfo
+
+func (m *PublishBatchResponse) GetResults() []*PublishResult {
+	if m != nil {
+		return m.Results
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*GetConnectNumRequest)(nil), "topicproto.GetConnectNumRequest")
 	proto.RegisterType((*GetConnectNumResponse)(nil), "topicproto.GetConnectNumResponse")
@@ -438,6 +1030,18 @@ func init() {
 	proto.RegisterType((*PublishResponse)(nil), "topicproto.PublishResponse")
 	proto.RegisterType((*CheckTopicExistRequest)(nil), "topicproto.CheckTopicExistRequest")
 	proto.RegisterType((*CheckTopicExistResponse)(nil), "topicproto.CheckTopicExistResponse")
+	proto.RegisterType((*KickUserRequest)(nil), "topicproto.KickUserRequest")
+	proto.RegisterType((*KickUserResponse)(nil), "topicproto.KickUserResponse")
+	proto.RegisterType((*RemoveTopicRequest)(nil), "topicproto.RemoveTopicRequest")
+	proto.RegisterType((*RemoveTopicResponse)(nil), "topicproto.RemoveTopicResponse")
+	proto.RegisterType((*UnsubscribeUserRequest)(nil), "topicproto.UnsubscribeUserRequest")
+	proto.RegisterType((*UnsubscribeUserResponse)(nil), "topicproto.UnsubscribeUserResponse")
+	proto.RegisterType((*SubscribeRequest)(nil), "topicproto.SubscribeRequest")
+	proto.RegisterType((*PushMessage)(nil), "topicproto.PushMessage")
+	proto.RegisterType((*PublishBatchRequest)(nil), "topicproto.PublishBatchRequest")
+	proto.RegisterType((*MulticastRequest)(nil), "topicproto.MulticastRequest")
+	proto.RegisterType((*PublishResult)(nil), "topicproto.PublishResult")
+	proto.RegisterType((*PublishBatchResponse)(nil), "topicproto.PublishBatchResponse")
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -457,6 +1061,12 @@ type TopicServiceClient interface {
 	UnSubscribeTopic(ctx context.Context, in *UnSubscribeTopicRequest, opts ...grpc.CallOption) (*UnSubscribeTopicResponse, error)
 	Publish(ctx context.Context, in *PublishRequest, opts ...grpc.CallOption) (*PublishResponse, error)
 	CheckTopicExist(ctx context.Context, in *CheckTopicExistRequest, opts ...grpc.CallOption) (*CheckTopicExistResponse, error)
+	KickUser(ctx context.Context, in *KickUserRequest, opts ...grpc.CallOption) (*KickUserResponse, error)
+	RemoveTopic(ctx context.Context, in *RemoveTopicRequest, opts ...grpc.CallOption) (*RemoveTopicResponse, error)
+	UnsubscribeUser(ctx context.Context, in *UnsubscribeUserRequest, opts ...grpc.CallOption) (*UnsubscribeUserResponse, error)
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (TopicService_SubscribeClient, error)
+	PublishBatch(ctx context.Context, in *PublishBatchRequest, opts ...grpc.CallOption) (*PublishBatchResponse, error)
+	Multicast(ctx context.Context, in *MulticastRequest, opts ...grpc.CallOption) (*PublishBatchResponse, error)
 }
 
 type topicServiceClient struct {
@@ -512,6 +1122,83 @@ func (c *topicServiceClient) CheckTopicExist(ctx context.Context, in *CheckTopic
 	return out, nil
 }
 
+func (c *topicServiceClient) KickUser(ctx context.Context, in *KickUserRequest, opts ...grpc.CallOption) (*KickUserResponse, error) {
+	out := new(KickUserResponse)
+	err := c.cc.Invoke(ctx, "/topicproto.TopicService/KickUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *topicServiceClient) RemoveTopic(ctx context.Context, in *RemoveTopicRequest, opts ...grpc.CallOption) (*RemoveTopicResponse, error) {
+	out := new(RemoveTopicResponse)
+	err := c.cc.Invoke(ctx, "/topicproto.TopicService/RemoveTopic", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *topicServiceClient) UnsubscribeUser(ctx context.Context, in *UnsubscribeUserRequest, opts ...grpc.CallOption) (*UnsubscribeUserResponse, error) {
+	out := new(UnsubscribeUserResponse)
+	err := c.cc.Invoke(ctx, "/topicproto.TopicService/UnsubscribeUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *topicServiceClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (TopicService_SubscribeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_TopicService_serviceDesc.Streams[0], "/topicproto.TopicService/Subscribe", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &topicServiceSubscribeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type TopicService_SubscribeClient interface {
+	Recv() (*PushMessage, error)
+	grpc.ClientStream
+}
+
+type topicServiceSubscribeClient struct {
+	grpc.ClientStream
+}
+
+func (x *topicServiceSubscribeClient) Recv() (*PushMessage, error) {
+	m := new(PushMessage)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *topicServiceClient) PublishBatch(ctx context.Context, in *PublishBatchRequest, opts ...grpc.CallOption) (*PublishBatchResponse, error) {
+	out := new(PublishBatchResponse)
+	err := c.cc.Invoke(ctx, "/topicproto.TopicService/PublishBatch", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *topicServiceClient) Multicast(ctx context.Context, in *MulticastRequest, opts ...grpc.CallOption) (*PublishBatchResponse, error) {
+	out := new(PublishBatchResponse)
+	err := c.cc.Invoke(ctx, "/topicproto.TopicService/Multicast", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // TopicServiceServer is the server API for TopicService service.
 type TopicServiceServer interface {
 	GetConnectNum(context.Context, *GetConnectNumRequest) (*GetConnectNumResponse, error)
@@ -519,6 +1206,12 @@ type TopicServiceServer interface {
 	UnSubscribeTopic(context.Context, *UnSubscribeTopicRequest) (*UnSubscribeTopicResponse, error)
 	Publish(context.Context, *PublishRequest) (*PublishResponse, error)
 	CheckTopicExist(context.Context, *CheckTopicExistRequest) (*CheckTopicExistResponse, error)
+	KickUser(context.Context, *KickUserRequest) (*KickUserResponse, error)
+	RemoveTopic(context.Context, *RemoveTopicRequest) (*RemoveTopicResponse, error)
+	UnsubscribeUser(context.Context, *UnsubscribeUserRequest) (*UnsubscribeUserResponse, error)
+	Subscribe(*SubscribeRequest, TopicService_SubscribeServer) error
+	PublishBatch(context.Context, *PublishBatchRequest) (*PublishBatchResponse, error)
+	Multicast(context.Context, *MulticastRequest) (*PublishBatchResponse, error)
 }
 
 func RegisterTopicServiceServer(s *grpc.Server, srv TopicServiceServer) {
@@ -615,6 +1308,117 @@ func _TopicService_CheckTopicExist_Handler(srv interface{}, ctx context.Context,
 	return interceptor(ctx, in, info, handler)
 }
 
+func _TopicService_KickUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KickUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TopicServiceServer).KickUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/topicproto.TopicService/KickUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TopicServiceServer).KickUser(ctx, req.(*KickUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TopicService_RemoveTopic_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveTopicRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TopicServiceServer).RemoveTopic(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/topicproto.TopicService/RemoveTopic",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TopicServiceServer).RemoveTopic(ctx, req.(*RemoveTopicRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TopicService_UnsubscribeUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UnsubscribeUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TopicServiceServer).UnsubscribeUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/topicproto.TopicService/UnsubscribeUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TopicServiceServer).UnsubscribeUser(ctx, req.(*UnsubscribeUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TopicService_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TopicServiceServer).Subscribe(m, &topicServiceSubscribeServer{stream})
+}
+
+type TopicService_SubscribeServer interface {
+	Send(*PushMessage) error
+	grpc.ServerStream
+}
+
+type topicServiceSubscribeServer struct {
+	grpc.ServerStream
+}
+
+func (x *topicServiceSubscribeServer) Send(m *PushMessage) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _TopicService_PublishBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PublishBatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TopicServiceServer).PublishBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/topicproto.TopicService/PublishBatch",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TopicServiceServer).PublishBatch(ctx, req.(*PublishBatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TopicService_Multicast_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MulticastRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TopicServiceServer).Multicast(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/topicproto.TopicService/Multicast",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TopicServiceServer).Multicast(ctx, req.(*MulticastRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _TopicService_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "topicproto.TopicService",
 	HandlerType: (*TopicServiceServer)(nil),
@@ -639,37 +1443,85 @@ var _TopicService_serviceDesc = grpc.ServiceDesc{
 			MethodName: "CheckTopicExist",
 			Handler:    _TopicService_CheckTopicExist_Handler,
 		},
+		{
+			MethodName: "KickUser",
+			Handler:    _TopicService_KickUser_Handler,
+		},
+		{
+			MethodName: "RemoveTopic",
+			Handler:    _TopicService_RemoveTopic_Handler,
+		},
+		{
+			MethodName: "UnsubscribeUser",
+			Handler:    _TopicService_UnsubscribeUser_Handler,
+		},
+		{
+			MethodName: "PublishBatch",
+			Handler:    _TopicService_PublishBatch_Handler,
+		},
+		{
+			MethodName: "Multicast",
+			Handler:    _TopicService_Multicast_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			Handler:       _TopicService_Subscribe_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "topicmanage.proto",
 }
 
-func init() { proto.RegisterFile("topicmanage.proto", fileDescriptor_topicmanage_fc3522fc6bd4a59f) }
-
-var fileDescriptor_topicmanage_fc3522fc6bd4a59f = []byte{
-	// 381 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x92, 0x4f, 0x4f, 0xf2, 0x40,
-	0x10, 0xc6, 0x5f, 0x5a, 0x5e, 0xde, 0x97, 0x09, 0x16, 0x9d, 0xf0, 0xa7, 0xa9, 0x1e, 0x60, 0xf1,
-	0xa0, 0x89, 0xa9, 0x89, 0x9e, 0x8d, 0x07, 0x30, 0x86, 0x83, 0x60, 0x8a, 0x9a, 0x98, 0x98, 0x98,
-	0xb6, 0x4e, 0xa0, 0x41, 0xda, 0xda, 0x6d, 0x8d, 0x9f, 0xd0, 0xcf, 0x65, 0x58, 0x6a, 0xa1, 0xa5,
-	0xf6, 0xe2, 0x6d, 0x67, 0xf7, 0x99, 0xdf, 0x93, 0x9d, 0x67, 0x60, 0x2f, 0xf4, 0x7c, 0xc7, 0x5e,
-	0x98, 0xae, 0x39, 0x25, 0xdd, 0x0f, 0xbc, 0xd0, 0x43, 0x10, 0x57, 0xe2, 0xcc, 0x4e, 0xa0, 0x71,
-	0x4d, 0x61, 0xdf, 0x73, 0x5d, 0xb2, 0xc3, 0x51, 0xb4, 0x30, 0xe8, 0x2d, 0x22, 0x1e, 0x62, 0x03,
-	0xfe, 0xde, 0x2d, 0x55, 0x6a, 0xa9, 0x53, 0x3a, 0xaa, 0x1a, 0xab, 0x82, 0x9d, 0x42, 0x33, 0xa3,
-	0xe6, 0xbe, 0xe7, 0x72, 0xc2, 0x16, 0x54, 0x46, 0xd1, 0xc2, 0xa2, 0x40, 0xe8, 0x65, 0x23, 0xae,
-	0xd8, 0x05, 0x34, 0x27, 0x91, 0xc5, 0xed, 0xc0, 0xb1, 0x48, 0x20, 0x72, 0xf8, 0x72, 0xc2, 0x47,
-	0x05, 0xa4, 0xa1, 0xaf, 0x4a, 0xc2, 0x52, 0x1a, 0xfa, 0x4c, 0x85, 0x56, 0xb6, 0x7d, 0x65, 0xc8,
-	0x2e, 0xa1, 0x7d, 0xef, 0xfe, 0x06, 0xad, 0x81, 0xba, 0x0d, 0x88, 0xe1, 0x3e, 0x28, 0xb7, 0x91,
-	0xf5, 0xea, 0xf0, 0x59, 0xe1, 0x38, 0x10, 0xa1, 0x3c, 0x30, 0x43, 0x53, 0x50, 0x6b, 0x86, 0x38,
-	0xe3, 0x01, 0x54, 0x6f, 0x88, 0x73, 0x73, 0x4a, 0xc3, 0x17, 0x55, 0x16, 0xea, 0xf5, 0xc5, 0x72,
-	0x4e, 0x13, 0x2f, 0x0a, 0x6c, 0x52, 0xcb, 0xe2, 0x29, 0xae, 0x58, 0x17, 0xea, 0x89, 0x63, 0x3c,
-	0x52, 0x05, 0xa4, 0xf1, 0x5c, 0xf8, 0xfd, 0x37, 0xa4, 0xf1, 0x9c, 0xe9, 0xd0, 0xea, 0xcf, 0xc8,
-	0x9e, 0x0b, 0xeb, 0xab, 0x0f, 0x87, 0x87, 0xc5, 0x59, 0x1d, 0x43, 0x7b, 0x4b, 0x9f, 0x8f, 0x3e,
-	0xfb, 0x94, 0xa1, 0x26, 0x64, 0x13, 0x0a, 0xde, 0x1d, 0x9b, 0xf0, 0x01, 0x76, 0x52, 0x39, 0x63,
-	0x47, 0x5f, 0xef, 0x8c, 0x9e, 0xb7, 0x30, 0x5a, 0xb7, 0x40, 0x11, 0x8f, 0xf5, 0x0f, 0x3e, 0x82,
-	0x92, 0x1e, 0x39, 0xa6, 0xda, 0x72, 0xf3, 0xd4, 0x58, 0x91, 0x24, 0x41, 0x3f, 0xc3, 0x6e, 0x36,
-	0x4f, 0xec, 0x6d, 0x76, 0xfe, 0xb0, 0x2e, 0xda, 0x61, 0xb1, 0x28, 0x31, 0x18, 0xc0, 0xbf, 0x38,
-	0x22, 0xd4, 0x36, 0x5b, 0xd2, 0x9b, 0xa2, 0xed, 0xe7, 0xbe, 0x25, 0x94, 0x27, 0xa8, 0x67, 0x52,
-	0xc1, 0xd4, 0xff, 0xf2, 0x23, 0xd6, 0x7a, 0x85, 0x9a, 0x6f, 0xba, 0x55, 0x11, 0x82, 0xf3, 0xaf,
-	0x00, 0x00, 0x00, 0xff, 0xff, 0x8d, 0x79, 0x34, 0xe9, 0xf5, 0x03, 0x00, 0x00,
+func init() { proto.RegisterFile("topicmanage.proto", fileDescriptor_topicmanage_426b62343708aee2) }
+
+var fileDescriptor_topicmanage_426b62343708aee2 = []byte{
+	// 727 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xc4, 0x55, 0xdd, 0x4e, 0xdb, 0x4c,
+	0x10, 0x25, 0x0e, 0x84, 0x64, 0x80, 0x90, 0x6f, 0x81, 0xc4, 0xdf, 0x16, 0x15, 0x58, 0x7a, 0x41,
+	0xab, 0x2a, 0x6d, 0x41, 0xed, 0x5d, 0x85, 0x54, 0xfe, 0x14, 0xa1, 0x00, 0x72, 0x48, 0xa5, 0x4a,
+	0x95, 0x2a, 0xc7, 0x59, 0x81, 0x95, 0xc4, 0x4e, 0xbd, 0x36, 0x6d, 0x1f, 0xa6, 0x55, 0xef, 0xfb,
+	0x92, 0x95, 0x37, 0xeb, 0xb5, 0xd7, 0xd8, 0x16, 0x52, 0x55, 0xf5, 0xce, 0xe3, 0x3d, 0x3e, 0x33,
+	0xb3, 0x67, 0xe6, 0x18, 0xfe, 0xf3, 0xdd, 0xa9, 0x6d, 0x4d, 0x4c, 0xc7, 0xbc, 0xa1, 0xed, 0xa9,
+	0xe7, 0xfa, 0x2e, 0x02, 0xfe, 0x8a, 0x3f, 0x93, 0xe7, 0xb0, 0x7e, 0x46, 0xfd, 0x23, 0xd7, 0x71,
+	0xa8, 0xe5, 0x5f, 0x04, 0x13, 0x83, 0x7e, 0x0e, 0x28, 0xf3, 0xd1, 0x3a, 0x2c, 0x5c, 0x87, 0x28,
+	0xbd, 0xb4, 0x5d, 0xda, 0xab, 0x19, 0xb3, 0x80, 0xbc, 0x80, 0x8d, 0x14, 0x9a, 0x4d, 0x5d, 0x87,
+	0x51, 0xd4, 0x84, 0xca, 0x45, 0x30, 0x19, 0x50, 0x8f, 0xe3, 0xcb, 0x86, 0x88, 0xc8, 0x5b, 0xd8,
+	0xe8, 0x05, 0x03, 0x66, 0x79, 0xf6, 0x80, 0x72, 0x8a, 0x0c, 0xfe, 0xb2, 0xe4, 0x47, 0x75, 0xd0,
+	0x3a, 0x53, 0x5d, 0xe3, 0x29, 0xb5, 0xce, 0x94, 0xe8, 0xd0, 0x4c, 0x7f, 0x3e, 0x4b, 0x48, 0x0e,
+	0xa1, 0xd5, 0x77, 0xfe, 0x84, 0x1a, 0x83, 0xde, 0x77, 0x72, 0xc8, 0x7f, 0x94, 0xa0, 0x7e, 0x15,
+	0x0c, 0xc6, 0x36, 0xbb, 0x2d, 0xbc, 0x0f, 0x84, 0x60, 0xfe, 0xd8, 0xf4, 0x4d, 0x4e, 0xbb, 0x6c,
+	0xf0, 0x67, 0xb4, 0x09, 0xb5, 0x2e, 0x65, 0xcc, 0xbc, 0xa1, 0x9d, 0xa1, 0x5e, 0xe6, 0xe8, 0xf8,
+	0x45, 0x78, 0x51, 0x3d, 0x37, 0xf0, 0x2c, 0xaa, 0xcf, 0xf3, 0x23, 0x11, 0xa1, 0x06, 0x94, 0xaf,
+	0xfd, 0xb1, 0xbe, 0xc0, 0x6f, 0x2f, 0x7c, 0x44, 0x18, 0xaa, 0xc7, 0xd4, 0x1c, 0x8e, 0x6d, 0x87,
+	0xea, 0x15, 0xfe, 0x5a, 0xc6, 0x64, 0x07, 0x56, 0x65, 0x7d, 0x42, 0x81, 0x3a, 0x68, 0x97, 0x23,
+	0x5e, 0x5d, 0xd5, 0xd0, 0x2e, 0x47, 0xa4, 0x0d, 0xcd, 0xa3, 0x5b, 0x6a, 0x8d, 0x78, 0xa1, 0x27,
+	0x5f, 0x6d, 0xe6, 0x17, 0x4b, 0xfb, 0x14, 0x5a, 0xf7, 0xf0, 0x39, 0xd4, 0x87, 0xb0, 0x7a, 0x6e,
+	0x5b, 0xa3, 0x3e, 0xa3, 0x5e, 0xc4, 0xd9, 0x84, 0x4a, 0x18, 0x76, 0x86, 0x82, 0x54, 0x44, 0x71,
+	0x2e, 0x2d, 0x99, 0xab, 0x0d, 0x8d, 0x98, 0x40, 0x24, 0xc1, 0x50, 0x3d, 0x33, 0x7d, 0xfa, 0xc5,
+	0xfc, 0xc6, 0xc4, 0x0c, 0xc9, 0x98, 0x3c, 0x03, 0x64, 0xd0, 0x89, 0x7b, 0x97, 0xab, 0x73, 0x82,
+	0xfb, 0x15, 0xac, 0x29, 0xd8, 0x07, 0xd0, 0x9f, 0x42, 0xb3, 0xef, 0xb0, 0x68, 0x14, 0x92, 0x6d,
+	0x65, 0xab, 0x1e, 0x37, 0xab, 0x25, 0x9b, 0x25, 0xaf, 0xa1, 0x75, 0x8f, 0xe7, 0x01, 0xe9, 0xf7,
+	0xa0, 0x21, 0xe7, 0xb0, 0x70, 0x86, 0xc9, 0x04, 0x96, 0xae, 0x02, 0x76, 0x2b, 0xa6, 0xe9, 0x6f,
+	0xcf, 0x24, 0xe9, 0xc2, 0x9a, 0x98, 0xb2, 0x77, 0xa6, 0x6f, 0xc9, 0x55, 0x78, 0x03, 0x55, 0xf1,
+	0x2d, 0xe3, 0xe5, 0x2d, 0xed, 0xe3, 0x76, 0xec, 0x28, 0x6d, 0x75, 0x71, 0x0c, 0x89, 0x25, 0x3f,
+	0x4b, 0xd0, 0xe8, 0x06, 0x63, 0xdf, 0xb6, 0x4c, 0xe6, 0x17, 0x36, 0xfa, 0xcf, 0xf6, 0xea, 0x7b,
+	0x09, 0x56, 0xe2, 0xc5, 0x0a, 0xc6, 0x79, 0x13, 0xa0, 0xd4, 0xa2, 0xa5, 0x6b, 0x99, 0xed, 0x4b,
+	0x39, 0xda, 0x17, 0x45, 0xfc, 0x79, 0x55, 0xfc, 0x90, 0xff, 0xc4, 0xf3, 0x5c, 0x8f, 0x57, 0x58,
+	0x33, 0x66, 0x41, 0xd8, 0xcd, 0xa9, 0x69, 0x8f, 0xe9, 0x50, 0x54, 0x28, 0x22, 0x72, 0x0e, 0xeb,
+	0xaa, 0x22, 0x62, 0xbc, 0x0e, 0x60, 0x71, 0x56, 0x6f, 0xa4, 0xc8, 0xff, 0x99, 0x8a, 0x84, 0x08,
+	0x23, 0x42, 0xee, 0xff, 0x5a, 0x84, 0x65, 0xde, 0x4e, 0x8f, 0x7a, 0x77, 0xb6, 0x45, 0xd1, 0x7b,
+	0x58, 0x51, 0xdc, 0x1d, 0x6d, 0x27, 0x59, 0xb2, 0x7e, 0x13, 0x78, 0xa7, 0x00, 0x21, 0xcc, 0x74,
+	0x0e, 0x7d, 0x80, 0xba, 0x6a, 0xb4, 0x48, 0xf9, 0x2c, 0xd3, 0xc5, 0x31, 0x29, 0x82, 0x48, 0xea,
+	0x4f, 0xd0, 0x48, 0xbb, 0x38, 0xda, 0x4d, 0x7e, 0x99, 0xf3, 0x93, 0xc0, 0x4f, 0x8a, 0x41, 0x32,
+	0xc1, 0x31, 0x2c, 0x8a, 0xeb, 0x43, 0x05, 0x53, 0x8e, 0x1f, 0x65, 0x9e, 0x49, 0x96, 0x8f, 0xb0,
+	0x9a, 0x32, 0x57, 0xa4, 0xf4, 0x97, 0xed, 0xd4, 0x78, 0xb7, 0x10, 0x23, 0xd9, 0xcf, 0xa0, 0x1a,
+	0xd9, 0x29, 0x52, 0x0a, 0x49, 0xb9, 0x34, 0xde, 0xcc, 0x3e, 0x94, 0x44, 0x57, 0xb0, 0x94, 0xf0,
+	0x4e, 0xf4, 0x38, 0x09, 0xbf, 0x6f, 0xc0, 0x78, 0x2b, 0xf7, 0x3c, 0xd9, 0x78, 0xca, 0x12, 0xd5,
+	0xc6, 0xb3, 0x7d, 0x17, 0xef, 0x16, 0x62, 0x24, 0xfb, 0x29, 0xd4, 0xa4, 0x70, 0x68, 0x33, 0x73,
+	0x60, 0x22, 0xc6, 0x96, 0x2a, 0x90, 0x34, 0x51, 0x32, 0xf7, 0xb2, 0x84, 0x7a, 0xb0, 0x9c, 0x5c,
+	0x2b, 0xb4, 0x95, 0xa1, 0x66, 0xd2, 0x02, 0xf1, 0x76, 0x3e, 0x40, 0x16, 0xd7, 0x85, 0x9a, 0x74,
+	0x3b, 0xb5, 0xb8, 0xb4, 0x09, 0x3e, 0x84, 0x6e, 0x50, 0xe1, 0xa7, 0x07, 0xbf, 0x07, 0x00, 0x85,
+	0x07, 0xc4, 0xd8, 0xd0, 0x09, 0x00, 0x00,
 }
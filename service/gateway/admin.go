@@ -0,0 +1,304 @@
+package gateway
+
+import (
+	"crypto/subtle"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	json "github.com/json-iterator/go"
+)
+
+var (
+	// AdminAddress gateway管理接口的监听地址 为空时ListenAdmin需要显式传入地址
+	AdminAddress = ""
+	// AdminToken 管理接口的鉴权token 为空时管理接口不可用
+	// 请求需要携带 Authorization: Bearer <token> 请求头
+	AdminToken = ""
+	// AdminMaxTowers 连接列表单次最多返回的连接数
+	AdminMaxTowers = 1000
+)
+
+func loadAdmin() {
+	AdminAddress = configString("admin.Address", "")
+	AdminToken = configString("admin.Token", "")
+	AdminMaxTowers = int(configInt("admin.MaxTowers", 1000))
+}
+
+// TowerInfo 管理接口中一个连接的信息
+type TowerInfo struct {
+	ConnId       uint64    `json:"conn_id"`
+	ClientId     string    `json:"client_id"`
+	UserId       string    `json:"user_id"`
+	StartTime    time.Time `json:"start_time"`
+	Bucket       int64     `json:"bucket"`
+	Topics       []string  `json:"topics"`
+	SendQueue    int       `json:"send_queue"` // 发送队列中等待写出的消息数
+	SendQueueCap int       `json:"send_queue_cap"`
+	ReadQueue    int       `json:"read_queue"` // 读取队列中等待处理的消息数
+	Sent         uint64    `json:"sent"`
+	Dropped      uint64    `json:"dropped"`   // 发送队列已满被丢弃的消息数
+	Expired      uint64    `json:"expired"`   // 写出前已经过期被丢弃的消息数
+	Conflated    uint64    `json:"conflated"` // 排队中被同topic新消息替换的消息数
+}
+
+// TowerList 连接列表
+type TowerList struct {
+	Towers []*TowerInfo `json:"towers"`
+	Total  int          `json:"total"` // 满足过滤条件的连接数 可能大于返回的数量
+}
+
+// BucketStats 一个bucket的统计信息
+type BucketStats struct {
+	Id           int64 `json:"id"`
+	TopicNum     int   `json:"topic_num"`
+	SubscribeNum int   `json:"subscribe_num"` // topic->连接 订阅关系数
+	BuffChanLen  int   `json:"buff_chan_len"`
+	BuffChanCap  int   `json:"buff_chan_cap"`
+	ControlLen   int   `json:"control_chan_len"` // 等待处理的控制消息数
+	ConsumerNum  int   `json:"consumer_num"`
+}
+
+// ManagerStats gateway整体的统计信息
+type ManagerStats struct {
+	TowerNum        int            `json:"tower_num"`
+	TopicNum        int            `json:"topic_num"` // 当前实例有订阅者的topic数
+	CentralChanLen  int            `json:"central_chan_len"`
+	CentralChanCap  int            `json:"central_chan_cap"`
+	ControlChanLen  int            `json:"control_chan_len"`
+	DispatchSkipped uint64         `json:"dispatch_skipped"` // 没有本地订阅者被跳过的消息数
+	Expired         *ExpiredStats  `json:"expired"`          // 各阶段因过期被丢弃的消息数
+	Buckets         []*BucketStats `json:"buckets"`
+}
+
+// info 连接的快照
+func (t *FireTower) info() *TowerInfo {
+	topics := t.Topics()
+	sort.Strings(topics)
+	info := &TowerInfo{
+		ConnId:       t.connId,
+		ClientId:     t.ClientId,
+		UserId:       t.GetUserId(),
+		StartTime:    t.startTime,
+		Topics:       topics,
+		SendQueue:    len(t.sendOut),
+		SendQueueCap: cap(t.sendOut),
+		ReadQueue:    len(t.readIn),
+		Sent:         atomic.LoadUint64(&t.sentNum),
+		Dropped:      atomic.LoadUint64(&t.droppedNum),
+		Expired:      atomic.LoadUint64(&t.expiredNum),
+		Conflated:    atomic.LoadUint64(&t.conflatedNum),
+	}
+	if TM != nil && len(TM.bucket) > 0 {
+		info.Bucket = TM.GetBucket(t).id
+	}
+	return info
+}
+
+// stats bucket的统计快照
+func (b *Bucket) stats() *BucketStats {
+	s := &BucketStats{
+		Id:          b.id,
+		BuffChanLen: len(b.BuffChan),
+		BuffChanCap: cap(b.BuffChan),
+		ControlLen:  len(b.ControlChan),
+		ConsumerNum: b.consumerNum,
+	}
+	b.mu.RLock()
+	s.TopicNum = len(b.topicRelevance)
+	for _, m := range b.topicRelevance {
+		s.SubscribeNum += len(m)
+	}
+	b.mu.RUnlock()
+	return s
+}
+
+// Stats gateway整体与各bucket的统计信息
+func (t *TowerManager) Stats() *ManagerStats {
+	s := &ManagerStats{
+		TowerNum:        t.TowerNum(),
+		CentralChanLen:  len(t.centralChan),
+		CentralChanCap:  cap(t.centralChan),
+		ControlChanLen:  len(t.controlChan),
+		DispatchSkipped: atomic.LoadUint64(&t.skippedNum),
+		Expired:         Expired(),
+		Buckets:         make([]*BucketStats, 0, len(t.bucket)),
+	}
+	t.topicMu.RLock()
+	s.TopicNum = len(t.topicBucket)
+	t.topicMu.RUnlock()
+	for _, b := range t.bucket {
+		s.Buckets = append(s.Buckets, b.stats())
+	}
+	return s
+}
+
+// adminResponse 管理接口返回的数据结构 与manager的管理接口一致
+type adminResponse struct {
+	Meta *adminMeta  `json:"meta"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+type adminMeta struct {
+	Code  int    `json:"code"`
+	Error string `json:"error"`
+}
+
+func writeAdmin(w http.ResponseWriter, status, code int, err string, data interface{}) {
+	b, _ := json.Marshal(&adminResponse{Meta: &adminMeta{Code: code, Error: err}, Data: data})
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+// AdminHandler gateway本地的管理接口 需要设置AdminToken才可用
+//
+// GET  /admin/towers?user_id=&client_id=&topic=&limit= 列出运行中的连接
+// GET  /admin/towers/{connId} 查看单个连接
+// POST /admin/towers/{connId}/close 强制关闭连接
+// POST /admin/towers/{connId}/unsubscribe {"topic":["room_1"]} 让连接退订topic
+// GET  /admin/buckets 各bucket的topic数量、队列深度与消费者数量
+func AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/towers", adminTowersHandler)
+	mux.HandleFunc("GET /admin/towers/{connId}", adminTower(adminTowerHandler))
+	mux.HandleFunc("POST /admin/towers/{connId}/close", adminTower(adminCloseHandler))
+	mux.HandleFunc("POST /admin/towers/{connId}/unsubscribe", adminTower(adminUnsubscribeHandler))
+	mux.HandleFunc("GET /admin/buckets", adminBucketsHandler)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if AdminToken == "" {
+			writeAdmin(w, http.StatusForbidden, 4030, "admin api is disabled", nil)
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(AdminToken)) != 1 {
+			writeAdmin(w, http.StatusUnauthorized, 4010, "unauthorized", nil)
+			return
+		}
+		if TM == nil {
+			writeAdmin(w, http.StatusServiceUnavailable, 5030, "gateway is not inited", nil)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// ListenAdmin 在addr上提供管理接口 addr为空时使用配置 admin.Address
+// 该方法会一直阻塞 直到监听出错
+func ListenAdmin(addr string) error {
+	if addr == "" {
+		addr = AdminAddress
+	}
+	if addr == "" {
+		return ErrorAdminAddressEmpty
+	}
+	return http.ListenAndServe(addr, AdminHandler())
+}
+
+// adminTower 解析路径中的连接id 连接不存在时返回404
+func adminTower(next func(w http.ResponseWriter, r *http.Request, tower *FireTower)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		connId, err := strconv.ParseUint(r.PathValue("connId"), 10, 64)
+		if err != nil {
+			writeAdmin(w, http.StatusBadRequest, 4001, "invalid conn id", nil)
+			return
+		}
+		tower, ok := TM.Tower(connId)
+		if !ok {
+			writeAdmin(w, http.StatusNotFound, 4040, "tower not found", nil)
+			return
+		}
+		next(w, r, tower)
+	}
+}
+
+func adminTowersHandler(w http.ResponseWriter, r *http.Request) {
+	var (
+		query    = r.URL.Query()
+		userId   = query.Get("user_id")
+		clientId = query.Get("client_id")
+		topic    = query.Get("topic")
+		limit    = AdminMaxTowers
+	)
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeAdmin(w, http.StatusBadRequest, 4001, "invalid limit", nil)
+			return
+		}
+		if n < limit {
+			limit = n
+		}
+	}
+	var candidates, towers []*FireTower
+	switch {
+	case userId != "":
+		candidates = TM.TowersByUser(userId)
+	case clientId != "":
+		candidates = TM.TowersByClient(clientId)
+	default:
+		candidates = TM.Towers()
+	}
+	for _, t := range candidates {
+		if (userId == "" || t.GetUserId() == userId) && (clientId == "" || t.ClientId == clientId) && (topic == "" || t.hasTopic(topic)) {
+			towers = append(towers, t)
+		}
+	}
+	sort.Slice(towers, func(i, j int) bool { return towers[i].connId < towers[j].connId })
+	res := &TowerList{Towers: []*TowerInfo{}, Total: len(towers)}
+	for i := 0; i < len(towers) && i < limit; i++ {
+		res.Towers = append(res.Towers, towers[i].info())
+	}
+	writeAdmin(w, http.StatusOK, 0, "", res)
+}
+
+func adminTowerHandler(w http.ResponseWriter, r *http.Request, tower *FireTower) {
+	writeAdmin(w, http.StatusOK, 0, "", tower.info())
+}
+
+// adminCloseHandler 强制关闭连接 与连接断开一样会退订所有topic并触发下线回调
+func adminCloseHandler(w http.ResponseWriter, r *http.Request, tower *FireTower) {
+	tower.Close()
+	writeAdmin(w, http.StatusOK, 0, "", nil)
+}
+
+// adminUnsubscribeHandler 让连接退订topic 对每个退订的topic触发onSystemRemove回调
+func adminUnsubscribeHandler(w http.ResponseWriter, r *http.Request, tower *FireTower) {
+	var req struct {
+		Topic []string `json:"topic"`
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, HTTPMaxBodySize))
+	if err == nil {
+		err = json.Unmarshal(body, &req)
+	}
+	if err != nil {
+		writeAdmin(w, http.StatusBadRequest, 4001, err.Error(), nil)
+		return
+	}
+	if len(req.Topic) == 0 {
+		writeAdmin(w, http.StatusBadRequest, 4001, "topic is empty", nil)
+		return
+	}
+	delTopic, err := tower.unbindTopic(req.Topic)
+	if err != nil {
+		writeAdmin(w, http.StatusInternalServerError, 5001, err.Error(), nil)
+		return
+	}
+	if tower.onSystemRemove != nil {
+		for _, topic := range delTopic {
+			tower.onSystemRemove(topic)
+		}
+	}
+	if delTopic == nil {
+		delTopic = []string{}
+	}
+	writeAdmin(w, http.StatusOK, 0, "", map[string][]string{"topic": delTopic})
+}
+
+func adminBucketsHandler(w http.ResponseWriter, r *http.Request) {
+	writeAdmin(w, http.StatusOK, 0, "", TM.Stats())
+}
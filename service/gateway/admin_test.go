@@ -0,0 +1,244 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/OSMeteor/firetower/grpc/manager"
+	"github.com/OSMeteor/firetower/socket"
+
+	json "github.com/json-iterator/go"
+	"google.golang.org/grpc"
+)
+
+// subscribeManagerClient 订阅与退订总是成功的manager客户端
+type subscribeManagerClient struct {
+	pb.TopicServiceClient
+}
+
+func (subscribeManagerClient) SubscribeTopic(ctx context.Context, in *pb.SubscribeTopicRequest, opts ...grpc.CallOption) (*pb.SubscribeTopicResponse, error) {
+	return &pb.SubscribeTopicResponse{}, nil
+}
+
+func (subscribeManagerClient) UnSubscribeTopic(ctx context.Context, in *pb.UnSubscribeTopicRequest, opts ...grpc.CallOption) (*pb.UnSubscribeTopicResponse, error) {
+	return &pb.UnSubscribeTopicResponse{}, nil
+}
+
+// setupSubscribeTest 在setupTransportTest的基础上允许连接订阅topic
+func setupSubscribeTest(t *testing.T) {
+	t.Helper()
+	setupTransportTest(t)
+	manage := topicManage
+	server, client := net.Pipe()
+	topicManageGrpc = subscribeManagerClient{}
+	topicManage = &socket.TcpClient{Conn: client}
+	t.Cleanup(func() {
+		server.Close()
+		client.Close()
+		topicManage = manage
+	})
+}
+
+// startTower 在新协程中运行tower 测试结束时关闭tower并等待Run返回
+func startTower(t *testing.T, tower *FireTower) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		tower.Run()
+		close(done)
+	}()
+	t.Cleanup(func() {
+		tower.Close()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Error("tower did not stop after close")
+		}
+	})
+}
+
+// runPipeTower 启动一个以Pipe为底层连接的tower 返回客户端一端
+func runPipeTower(t *testing.T, clientId, userId string) (*FireTower, Conn) {
+	t.Helper()
+	server, client := Pipe(16)
+	tower := BuildTower(server, clientId)
+	tower.UserId = userId
+	startTower(t, tower)
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, ok := TM.Tower(tower.ConnId()); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("tower was not registered")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return tower, client
+}
+
+func adminRequest(t *testing.T, srv *httptest.Server, method, path, body string, data interface{}) int {
+	t.Helper()
+	req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer secret")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var out struct {
+		Meta *adminMeta      `json:"meta"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if data != nil && len(out.Data) > 0 {
+		if err := json.Unmarshal(out.Data, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return res.StatusCode
+}
+
+func newGatewayAdminServer(t *testing.T) *httptest.Server {
+	AdminToken = "secret"
+	srv := httptest.NewServer(AdminHandler())
+	t.Cleanup(func() {
+		srv.Close()
+		AdminToken = ""
+	})
+	return srv
+}
+
+func TestGatewayAdminAuth(t *testing.T) {
+	setupTransportTest(t)
+	srv := newGatewayAdminServer(t)
+	res, err := http.Get(srv.URL + "/admin/towers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 without token, got %d", res.StatusCode)
+	}
+	AdminToken = ""
+	if status := adminRequest(t, srv, http.MethodGet, "/admin/towers", "", nil); status != http.StatusForbidden {
+		t.Errorf("admin api should be disabled without a token, got %d", status)
+	}
+}
+
+func TestGatewayAdminTowers(t *testing.T) {
+	setupSubscribeTest(t)
+	srv := newGatewayAdminServer(t)
+	t1, _ := runPipeTower(t, "c1", "u1")
+	t2, _ := runPipeTower(t, "c2", "u2")
+	if _, err := t1.bindTopic([]string{"room_2", "room_1"}); err != nil {
+		t.Fatal(err)
+	}
+	t2.bindTopic([]string{"room_1"})
+
+	var list TowerList
+	adminRequest(t, srv, http.MethodGet, "/admin/towers", "", &list)
+	if list.Total != 2 || len(list.Towers) != 2 || list.Towers[0].ConnId != t1.ConnId() {
+		t.Fatalf("unexpected towers %+v", list)
+	}
+	list = TowerList{}
+	adminRequest(t, srv, http.MethodGet, "/admin/towers?user_id=u2", "", &list)
+	if len(list.Towers) != 1 || list.Towers[0].ClientId != "c2" {
+		t.Errorf("unexpected filter by user %+v", list.Towers)
+	}
+	list = TowerList{}
+	adminRequest(t, srv, http.MethodGet, "/admin/towers?topic=room_2&limit=1", "", &list)
+	if len(list.Towers) != 1 || list.Towers[0].ConnId != t1.ConnId() {
+		t.Errorf("unexpected filter by topic %+v", list.Towers)
+	}
+
+	var info TowerInfo
+	adminRequest(t, srv, http.MethodGet, fmt.Sprintf("/admin/towers/%d", t1.ConnId()), "", &info)
+	if info.UserId != "u1" || fmt.Sprint(info.Topics) != "[room_1 room_2]" || info.SendQueueCap != 16 || info.StartTime.IsZero() {
+		t.Errorf("unexpected tower info %+v", info)
+	}
+	if status := adminRequest(t, srv, http.MethodGet, "/admin/towers/999999", "", nil); status != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", status)
+	}
+
+	var stats ManagerStats
+	adminRequest(t, srv, http.MethodGet, "/admin/buckets", "", &stats)
+	if stats.TowerNum != 2 || len(stats.Buckets) != 1 || stats.Buckets[0].TopicNum != 2 || stats.Buckets[0].SubscribeNum != 3 {
+		t.Errorf("unexpected stats %+v %+v", stats, stats.Buckets[0])
+	}
+}
+
+func TestGatewayAdminControl(t *testing.T) {
+	setupSubscribeTest(t)
+	srv := newGatewayAdminServer(t)
+	tower, client := runPipeTower(t, "c1", "u1")
+	removed := make(chan string, 2)
+	tower.SetOnSystemRemove(func(topic string) { removed <- topic })
+	tower.bindTopic([]string{"room_1", "room_2"})
+
+	var res struct {
+		Topic []string `json:"topic"`
+	}
+	path := fmt.Sprintf("/admin/towers/%d", tower.ConnId())
+	adminRequest(t, srv, http.MethodPost, path+"/unsubscribe", `{"topic":["room_1","nobody"]}`, &res)
+	if fmt.Sprint(res.Topic) != "[room_1]" || fmt.Sprint(tower.Topics()) != "[room_2]" || <-removed != "room_1" {
+		t.Fatalf("unexpected unsubscribe %v %v", res.Topic, tower.Topics())
+	}
+	if TM.TopicSubscribers("room_1") != 0 {
+		t.Error("bucket should drop the subscription")
+	}
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+path+"/close", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	if res, err := http.DefaultClient.Do(req); err != nil || res.StatusCode != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405, got %v %v", res, err)
+	}
+
+	adminRequest(t, srv, http.MethodPost, path+"/close", "", nil)
+	if _, ok := TM.Tower(tower.ConnId()); ok {
+		t.Error("closed tower should be unregistered")
+	}
+	if _, _, err := client.ReadMessage(); err == nil {
+		t.Error("client should be disconnected")
+	}
+}
+
+// TestGatewayAdminTowersSetUserId 查看连接列表时 业务可以同时修改连接的UserId
+func TestGatewayAdminTowersSetUserId(t *testing.T) {
+	setupSubscribeTest(t)
+	srv := newGatewayAdminServer(t)
+	tower, _ := runPipeTower(t, "c1", "u1")
+
+	stop, done := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				tower.SetUserId("u2")
+				return
+			default:
+			}
+			tower.SetUserId(fmt.Sprintf("u%d", i%2+1))
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		var list TowerList
+		adminRequest(t, srv, http.MethodGet, "/admin/towers?user_id=u1", "", &list)
+		adminRequest(t, srv, http.MethodGet, fmt.Sprintf("/admin/towers/%d", tower.ConnId()), "", nil)
+	}
+	close(stop)
+	<-done
+	var info TowerInfo
+	adminRequest(t, srv, http.MethodGet, fmt.Sprintf("/admin/towers/%d", tower.ConnId()), "", &info)
+	if info.UserId != "u2" || tower.GetUserId() != "u2" {
+		t.Errorf("expected the last UserId u2, got %q %q", info.UserId, tower.GetUserId())
+	}
+}
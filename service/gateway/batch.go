@@ -0,0 +1,141 @@
+package gateway
+
+import (
+	"sync/atomic"
+
+	"github.com/OSMeteor/firetower/socket"
+
+	"github.com/gorilla/websocket"
+	json "github.com/json-iterator/go"
+)
+
+// 批量写出
+// sendLoop取到一条消息后 会把发送队列中已经排队的消息一起取出(最多SendBatchSize条或SendBatchBytes字节)
+// 整批只设置一次写入截止时间 实现了BatchWriter的连接(例如原生TCP)合并为一次写入
+// 开启了SetBatchFrame的连接 连续的json文本消息合并为一个json数组帧 [msg1,msg2,...]
+
+var (
+	// SendBatchSize sendLoop单次最多写出的消息数 小于等于1表示不合并
+	SendBatchSize = 64
+	// SendBatchBytes sendLoop单次最多写出的内容字节数 达到后剩余的消息留到下一批 0表示不限制
+	SendBatchBytes = 64 * 1024
+)
+
+func loadSendBatch() {
+	SendBatchSize = int(configInt("send.BatchSize", 64))
+	SendBatchBytes = int(configInt("send.BatchBytes", 64*1024))
+}
+
+// BatchWriter 可选接口 能够将多条消息合并写出的连接实现该接口
+type BatchWriter interface {
+	WriteBatch(messages []*socket.SendMessage) error
+}
+
+// SetBatchFrame 开启后同一批写出的json消息合并为一个json数组帧
+// 只应对能够解析数组帧的客户端开启 例如连接时携带了约定的参数
+func (t *FireTower) SetBatchFrame(enable bool) {
+	t.batchFrame = enable
+}
+
+// collect 从first开始取出发送队列中已经排队的消息
+// 合并推送的占位消息替换为最新的消息 过期的消息直接丢弃
+func (t *FireTower) collect(batch []*socket.SendMessage, first *socket.SendMessage) []*socket.SendMessage {
+	var (
+		size    int
+		message = first
+	)
+	for {
+		if message = t.prepare(message); message != nil {
+			batch = append(batch, message)
+			size += len(message.Data)
+		}
+		if len(batch) >= SendBatchSize || (SendBatchBytes > 0 && size >= SendBatchBytes) {
+			return batch
+		}
+		select {
+		case message = <-t.sendOut:
+		default:
+			return batch
+		}
+	}
+}
+
+// prepare 取出发送队列中的消息后的处理 返回nil表示该消息不需要写出
+func (t *FireTower) prepare(message *socket.SendMessage) *socket.SendMessage {
+	if message == nil {
+		towerLog(t, "ERROR", "sendLoop received nil message")
+		return nil
+	}
+	if message.Type == conflateMarker {
+		if message = t.takeConflated(message.Topic); message == nil {
+			return nil
+		}
+	}
+	if expired(message, expireSend) {
+		atomic.AddUint64(&t.expiredNum, 1)
+		return nil
+	}
+	if message.MessageType == 0 {
+		message.MessageType = websocket.TextMessage // 文本格式
+	}
+	return message
+}
+
+// writeBatch 写出一批消息
+func (t *FireTower) writeBatch(batch []*socket.SendMessage) error {
+	if len(batch) == 1 {
+		return t.write(batch[0])
+	}
+	if _, ok := t.ws.(FrameWriter); !ok && t.batchFrame {
+		return t.writeArray(batch)
+	}
+	if w, ok := t.ws.(BatchWriter); ok {
+		return w.WriteBatch(batch)
+	}
+	for _, message := range batch {
+		if err := t.write(message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeArray 连续的json文本消息合并为一个数组帧写出 其他消息单独写出
+func (t *FireTower) writeArray(batch []*socket.SendMessage) error {
+	var (
+		frame []byte
+		num   int
+	)
+	flush := func() error {
+		if num == 0 {
+			return nil
+		}
+		frame = append(frame, ']')
+		if num == 1 {
+			// 只有一条时不需要数组
+			frame = frame[1 : len(frame)-1]
+		}
+		err := t.ws.WriteMessage(websocket.TextMessage, frame)
+		frame, num = frame[:0], 0
+		return err
+	}
+	for _, message := range batch {
+		if message.MessageType != websocket.TextMessage || !json.Valid(message.Data) {
+			if err := flush(); err != nil {
+				return err
+			}
+			if err := t.write(message); err != nil {
+				return err
+			}
+			continue
+		}
+		if num == 0 {
+			frame = append(frame, '[')
+		} else {
+			frame = append(frame, ',')
+		}
+		frame = append(frame, message.Data...)
+		num++
+	}
+	return flush()
+}
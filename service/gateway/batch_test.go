@@ -0,0 +1,143 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/OSMeteor/firetower/socket"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestCollect(t *testing.T) {
+	defer func(size, limit int) { SendBatchSize, SendBatchBytes = size, limit }(SendBatchSize, SendBatchBytes)
+	SendBatchSize, SendBatchBytes = 3, 0
+	tower := newMockTower("c1", 16)
+	for _, data := range []string{"2", "3", "4", "5"} {
+		tower.sendOut <- controlMessage(socket.PublishKey, "chat", data)
+	}
+	batch := tower.collect(nil, controlMessage(socket.PublishKey, "chat", "1"))
+	if len(batch) != 3 || string(batch[2].Data) != "3" || len(tower.sendOut) != 2 {
+		t.Fatalf("expected the first 3 messages, got %d with %d left", len(batch), len(tower.sendOut))
+	}
+
+	SendBatchSize, SendBatchBytes = 64, 2
+	batch = tower.collect(batch[:0], <-tower.sendOut)
+	if len(batch) != 2 || len(tower.sendOut) != 0 {
+		t.Fatalf("byte limit should stop after 2 messages, got %d", len(batch))
+	}
+}
+
+func TestBatchFrame(t *testing.T) {
+	setupSubscribeTest(t)
+	server, client := Pipe(16)
+	tower := BuildTower(server, "c1")
+	tower.SetBatchFrame(true)
+
+	// 连接还没有开始写出 消息都在发送队列中排队
+	for _, data := range []string{`{"v":1}`, `{"v":2}`, `text`, `{"v":3}`} {
+		tower.Send(controlMessage(socket.PublishKey, "chat", data))
+	}
+	startTower(t, tower)
+	// 非json消息单独写出 前后的json消息各自合并
+	for _, want := range []string{`[{"v":1},{"v":2}]`, `text`, `{"v":3}`} {
+		if _, data, err := client.ReadMessage(); err != nil || string(data) != want {
+			t.Fatalf("expected %s, got %q %v", want, data, err)
+		}
+	}
+	// 计数在整批写出之后更新
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadUint64(&tower.sentNum) != 4 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := atomic.LoadUint64(&tower.sentNum); n != 4 {
+		t.Errorf("expected 4 sent, got %d", n)
+	}
+}
+
+// writeCounter 记录底层连接的写入次数
+type writeCounter struct {
+	net.Conn
+	writes int
+	buf    bytes.Buffer
+}
+
+func (w *writeCounter) Write(b []byte) (int, error) {
+	w.writes++
+	return w.buf.Write(b)
+}
+
+func TestTCPWriteBatch(t *testing.T) {
+	w := &writeCounter{}
+	c := &tcpConn{conn: w}
+	batch := []*socket.SendMessage{
+		controlMessage(socket.PublishKey, "room_1", "a"),
+		controlMessage(socket.PublishKey, "room_2", "b"),
+	}
+	if err := c.WriteBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+	if w.writes != 1 {
+		t.Errorf("expected a single write, got %d", w.writes)
+	}
+	reader := bufio.NewReader(&w.buf)
+	for _, want := range batch {
+		frame, err := socket.ReadFrame(reader, 0)
+		if err != nil || frame.Topic != want.Topic || string(frame.Data) != string(want.Data) {
+			t.Fatalf("unexpected frame %v %v", frame, err)
+		}
+	}
+}
+
+func TestWebsocketWriteBatch(t *testing.T) {
+	conns := make(chan *websocket.Conn, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conns <- ws
+	}))
+	defer server.Close()
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	ws := <-conns
+	defer ws.Close()
+
+	tower := &FireTower{ws: NewWebsocketConn(ws)}
+	batch := []*socket.SendMessage{
+		{MessageType: websocket.TextMessage, Data: []byte("a")},
+		{MessageType: websocket.BinaryMessage, Data: []byte(strings.Repeat("b", 300))},
+		{MessageType: websocket.TextMessage, Data: []byte(strings.Repeat("c", 70000))},
+	}
+	if err := tower.writeBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range batch {
+		client.SetReadDeadline(time.Now().Add(time.Second))
+		mt, data, err := client.ReadMessage()
+		if err != nil || mt != want.MessageType || !bytes.Equal(data, want.Data) {
+			t.Fatalf("unexpected message %d len %d %v", mt, len(data), err)
+		}
+	}
+
+	// 关闭帧发出后 gorilla拒绝继续写出数据帧
+	if err := tower.ws.(CloseWriter).WriteClose(websocket.CloseNormalClosure, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := tower.writeBatch(batch); err != websocket.ErrCloseSent {
+		t.Errorf("expected ErrCloseSent after the close frame, got %v", err)
+	}
+}
@@ -1,10 +1,13 @@
 package gateway
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"sync/atomic"
 
+	pb "github.com/OSMeteor/firetower/grpc/manager"
 	"github.com/OSMeteor/firetower/socket"
 )
 
@@ -18,6 +21,18 @@ var (
 type TowerManager struct {
 	bucket      []*Bucket
 	centralChan chan *socket.SendMessage // 中心处理队列
+	controlChan chan *socket.SendMessage // 控制消息队列 优先于centralChan处理
+
+	indexMu sync.RWMutex
+	towers  map[uint64]*FireTower            // connId -> 当前实例上运行中的连接
+	users   map[string]map[uint64]*FireTower // UserId -> connId -> 连接
+	clients map[string]map[uint64]*FireTower // ClientId -> connId -> 连接
+
+	topicMu     sync.RWMutex
+	topicBucket map[string]bucketSet // topic -> 持有该topic订阅者的bucket
+	skippedNum  uint64               // 当前实例没有订阅者 未投递到任何bucket的消息数
+
+	quotaMu [quotaLockNum]sync.Mutex // 开启MaxSubscribersPerTopic时 按topic分段 检查订阅数与添加订阅在同一段锁内完成
 }
 
 // Bucket 的作用是将一个实例的连接均匀的分布在多个bucket中来达到并发推送的目的
@@ -25,53 +40,44 @@ type Bucket struct {
 	mu             sync.RWMutex // 读写锁，可并发读不可并发读写
 	id             int64
 	len            int64
-	topicRelevance map[string]map[string]*FireTower // topic -> websocket clientid -> websocket conn
+	topicRelevance map[string]map[uint64]*FireTower // topic -> connId -> websocket conn
 	BuffChan       chan *socket.SendMessage         // bucket的消息处理队列
+	ControlChan    chan *socket.SendMessage         // bucket的控制消息队列 消费者总是先处理该队列
+	consumerNum    int
+	index          int           // 在manager.bucket中的下标
+	manager        *TowerManager // 所属的管理中心 为空时不维护topic位图
 }
 
 func buildBuckets() {
 	bucketNum := int(ConfigTree.Get("bucket.Num").(int64))
 	TM = &TowerManager{
-		bucket:      make([]*Bucket, bucketNum),
+		bucket:      make([]*Bucket, 0, bucketNum),
 		centralChan: make(chan *socket.SendMessage, ConfigTree.Get("bucket.CentralChanCount").(int64)),
+		controlChan: make(chan *socket.SendMessage, configInt("bucket.ControlChanCount", 1024)),
 	}
 
 	for i := 0; i < bucketNum; i++ {
-		TM.bucket[i] = newBucket()
-	}
-
-	// 执行中心处理器 将所有推送消息推送到bucketNum个bucket中
-	go func() {
-		defer func() {
-			if err := recover(); err != nil {
-				fmt.Printf("PANIC: towerManager central processor recovered: %v\n", err)
-			}
-		}()
-		for {
-			select {
-			case message := <-TM.centralChan:
-				for i := 0; i < bucketNum; i++ {
-					TM.bucket[i].BuffChan <- message
-				}
-				message.Info("Sended")
-				message.Recycling()
-			}
-		}
-	}()
+		TM.addBucket(newBucket())
+	}
+
+	// 执行中心处理器 将推送消息分发到订阅了该topic的bucket中
+	go TM.dispatchLoop()
 }
 
 func newBucket() *Bucket {
 	b := &Bucket{
 		id:             getNewBucketId(),
 		len:            0,
-		topicRelevance: make(map[string]map[string]*FireTower),
+		topicRelevance: make(map[string]map[uint64]*FireTower),
 		BuffChan:       make(chan *socket.SendMessage, ConfigTree.Get("bucket.BuffChanCount").(int64)),
+		ControlChan:    make(chan *socket.SendMessage, configInt("bucket.ControlChanCount", 1024)),
 	}
 
 	ConsumerNum := int(ConfigTree.Get("bucket.ConsumerNum").(int64))
 	if ConsumerNum == 0 {
 		ConsumerNum = 1
 	}
+	b.consumerNum = ConsumerNum
 	// 每个bucket启动ConsumerNum个消费者(并发处理)
 	for i := 0; i < ConsumerNum; i++ {
 		go b.consumer()
@@ -110,35 +116,47 @@ func (b *Bucket) consumer() {
 		}
 	}()
 	for {
+		// 控制消息优先 推送积压时踢人等操作也能立即执行
+		select {
+		case message := <-b.ControlChan:
+			b.handle(message)
+			continue
+		default:
+		}
 		select {
+		case message := <-b.ControlChan:
+			b.handle(message)
 		case message := <-b.BuffChan:
-			switch message.Type {
-			case socket.PublishKey:
-				b.push(message)
-			case socket.OfflineTopicByUserIdKey:
-				// 需要退订的topic和user_id
-				b.unSubscribeByUserId(message)
-			case socket.OfflineTopicKey:
-				b.unSubscribeAll(message)
-			case socket.OfflineUserKey:
-				b.offlineUsers(message)
-			}
-			if message.Type == "push" {
-
-			}
-
+			b.handle(message)
 		}
 	}
 }
 
+func (b *Bucket) handle(message *socket.SendMessage) {
+	switch message.Type {
+	case socket.PublishKey:
+		b.push(message)
+	case socket.OfflineTopicByUserIdKey:
+		// 需要退订的topic和user_id
+		b.unSubscribeByUserId(message)
+	case socket.OfflineTopicKey:
+		b.unSubscribeAll(message)
+	case socket.OfflineUserKey:
+		b.offlineUsers(message)
+	}
+}
+
 // AddSubscribe 添加当前实例中的topic->conn的订阅关系
 func (b *Bucket) AddSubscribe(topic string, bt *FireTower) {
 	b.mu.Lock()
 	if m, ok := b.topicRelevance[topic]; ok {
-		m[bt.ClientId] = bt
+		m[bt.connId] = bt
 	} else {
-		b.topicRelevance[topic] = make(map[string]*FireTower)
-		b.topicRelevance[topic][bt.ClientId] = bt
+		b.topicRelevance[topic] = make(map[uint64]*FireTower)
+		b.topicRelevance[topic][bt.connId] = bt
+		if b.manager != nil {
+			b.manager.markTopic(topic, b.index)
+		}
 	}
 	b.mu.Unlock()
 }
@@ -147,19 +165,30 @@ func (b *Bucket) AddSubscribe(topic string, bt *FireTower) {
 func (b *Bucket) DelSubscribe(topic string, bt *FireTower) {
 	b.mu.Lock()
 	if m, ok := b.topicRelevance[topic]; ok {
-		delete(m, bt.ClientId)
+		delete(m, bt.connId)
 		if len(m) == 0 {
-			delete(b.topicRelevance, topic)
+			b.removeTopic(topic)
 		}
 	}
 	b.mu.Unlock()
 }
 
+// removeTopic topic在当前bucket中已经没有订阅者 调用方持有b.mu
+func (b *Bucket) removeTopic(topic string) {
+	delete(b.topicRelevance, topic)
+	if b.manager != nil {
+		b.manager.unmarkTopic(topic, b.index)
+	}
+}
+
 // Push 桶内进行遍历push
 // 每个bucket有一个Push方法
 // 在推送时每个bucket同时调用Push方法 来达到并发推送
 // 该方法主要通过遍历桶中的topic->conn订阅关系来进行websocket写入
 func (b *Bucket) push(message *socket.SendMessage) error {
+	if expired(message, expireBucket) {
+		return ErrorExpired
+	}
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 	if m, ok := b.topicRelevance[message.Topic]; ok {
@@ -171,59 +200,124 @@ func (b *Bucket) push(message *socket.SendMessage) error {
 	return ErrorTopicEmpty
 }
 
+// userTowers 当前bucket中属于该用户的连接 通过TM的用户索引查找
+func (b *Bucket) userTowers(userId string) []*FireTower {
+	if TM == nil || userId == "" {
+		return nil
+	}
+	var res []*FireTower
+	for _, bt := range TM.TowersByUser(userId) {
+		if TM.GetBucket(bt) == b {
+			res = append(res, bt)
+		}
+	}
+	return res
+}
+
+// unbindTowers 让当前bucket中的一批连接退订同一个topic
+// 订阅关系在各自的锁内修改 通知manager的grpc调用合并为一次 且调用时不持有任何锁
+// 返回实际退订了该topic的连接 grpc调用失败时与unbindTopic一样关闭这些连接
+func (b *Bucket) unbindTowers(topic string, towers []*FireTower) ([]*FireTower, error) {
+	var removed []*FireTower
+	for _, v := range towers {
+		v.topicMu.Lock()
+		if v.topic[topic] {
+			delete(v.topic, topic)
+			removed = append(removed, v)
+		}
+		v.topicMu.Unlock()
+	}
+	if len(removed) == 0 {
+		return nil, nil
+	}
+
+	b.mu.Lock()
+	if m, ok := b.topicRelevance[topic]; ok {
+		for _, v := range removed {
+			delete(m, v.connId)
+		}
+		if len(m) == 0 {
+			b.removeTopic(topic)
+		}
+	}
+	b.mu.Unlock()
+
+	if topicManageGrpc == nil {
+		return removed, errors.New("topicManageGrpc is nil")
+	}
+	if topicManage == nil || topicManage.Conn == nil {
+		return removed, errors.New("topicManage.Conn is nil")
+	}
+	// manager按topic出现的次数递减订阅数 同一个topic重复n次即退订n个连接
+	topics := make([]string, len(removed))
+	for i := range topics {
+		topics[i] = topic
+	}
+	_, err := topicManageGrpc.UnSubscribeTopic(context.Background(), &pb.UnSubscribeTopicRequest{Topic: topics, Ip: topicManage.Conn.LocalAddr().String()})
+	if err != nil {
+		for _, v := range removed {
+			v.Close()
+		}
+	}
+	return removed, err
+}
+
 // UnSubscribeByUserId 服务端指定某个用户退订某个topic
+// 该用户在当前bucket中所有订阅了该topic的连接都会退订
 func (b *Bucket) unSubscribeByUserId(message *socket.SendMessage) error {
-	b.mu.RLock()
-	defer b.mu.RUnlock()
-	if m, ok := b.topicRelevance[message.Topic]; ok {
-		userId := string(message.Data)
-		for _, v := range m {
-			if v.UserId == userId {
-				_, err := v.unbindTopic([]string{message.Topic})
-				v.ToSelf([]byte("{}"))
-				if v.unSubscribeHandler != nil {
-					v.unSubscribeHandler(nil, []string{message.Topic})
-				}
-				if err != nil {
-					return err
-				}
-				return nil
-			}
+	removed, err := b.unbindTowers(message.Topic, b.userTowers(string(message.Data)))
+	if err != nil {
+		return err
+	}
+	if len(removed) == 0 {
+		return ErrorTopicEmpty
+	}
+	for _, v := range removed {
+		v.ToSelf([]byte("{}"))
+		if v.unSubscribeHandler != nil {
+			v.unSubscribeHandler(nil, []string{message.Topic})
 		}
 	}
-	return ErrorTopicEmpty
+	return nil
 }
 
 // UnSubscribeAll 移除所有该topic的订阅关系
+// 在读锁内收集订阅者 退订与回调在锁外进行
 func (b *Bucket) unSubscribeAll(message *socket.SendMessage) error {
 	b.mu.RLock()
-	defer b.mu.RUnlock()
-	if m, ok := b.topicRelevance[message.Topic]; ok {
-		for _, v := range m {
-			_, err := v.unbindTopic([]string{message.Topic})
-			// 移除所有人的应该不需要执行回调方法
-			if v.onSystemRemove != nil {
-				v.onSystemRemove(message.Topic)
-			}
-			if err != nil {
-				return err
-			}
+	m := b.topicRelevance[message.Topic]
+	towers := make([]*FireTower, 0, len(m))
+	for _, v := range m {
+		towers = append(towers, v)
+	}
+	b.mu.RUnlock()
+	if len(towers) == 0 {
+		return ErrorTopicEmpty
+	}
+
+	removed, err := b.unbindTowers(message.Topic, towers)
+	if err != nil {
+		return err
+	}
+	// 移除所有人的应该不需要执行取消订阅的回调方法
+	for _, v := range removed {
+		if v.onSystemRemove != nil {
+			v.onSystemRemove(message.Topic)
 		}
 	}
-	return ErrorTopicEmpty
+	return nil
 }
 
+// offlineUsers 将某个用户踢下线
+// 通过用户索引关闭该用户在当前bucket中的所有连接 与连接订阅了哪些topic无关
+// message.Topic 只用于manager决定通知哪些gateway 管理接口不指定topic踢人时为* 此时manager会通知所有gateway
 func (b *Bucket) offlineUsers(message *socket.SendMessage) error {
-	b.mu.RLock()
-	defer b.mu.RUnlock()
-	if m, ok := b.topicRelevance[message.Topic]; ok {
-		userId := string(message.Data)
-		for _, v := range m {
-			if v.UserId == userId {
-				v.Close()
-				return nil
-			}
-		}
+	towers := b.userTowers(string(message.Data))
+	if len(towers) == 0 {
+		return ErrorTopicEmpty
 	}
-	return ErrorTopicEmpty
+	for _, v := range towers {
+		v.Close()
+	}
+	return nil
 }
@@ -10,9 +10,9 @@ import (
 // Mock FireTower for testing
 func newMockTower(clientId string, sendChanSize int) *FireTower {
 	t := &FireTower{
+		connId:   getConnId(),
 		ClientId: clientId,
 		sendOut:  make(chan *socket.SendMessage, sendChanSize),
-		isClose:  false,
 	}
 	// Important: Initialize closeChan to avoid nil pointer
 	t.closeChan = make(chan struct{}) 
@@ -22,7 +22,7 @@ func newMockTower(clientId string, sendChanSize int) *FireTower {
 func TestBucketPush(t *testing.T) {
 	// Initialize bucket
 	b := &Bucket{
-		topicRelevance: make(map[string]map[string]*FireTower),
+		topicRelevance: make(map[string]map[uint64]*FireTower),
 		BuffChan:       make(chan *socket.SendMessage, 100),
 	}
 
@@ -89,7 +89,7 @@ func TestBucketPush(t *testing.T) {
 
 func BenchmarkBucketPush(b *testing.B) {
 	bucket := &Bucket{
-		topicRelevance: make(map[string]map[string]*FireTower),
+		topicRelevance: make(map[string]map[uint64]*FireTower),
 		BuffChan:       make(chan *socket.SendMessage, 1000),
 	}
 	topic := "bench"
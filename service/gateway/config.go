@@ -27,3 +27,39 @@ func loadConfig(path string) {
 		fmt.Println("config load failed:", err)
 	}
 }
+
+// configInt 读取整型配置 未配置或类型不符时返回默认值
+func configInt(key string, def int64) int64 {
+	if ConfigTree == nil {
+		return def
+	}
+	if v, ok := ConfigTree.Get(key).(int64); ok {
+		return v
+	}
+	return def
+}
+
+// configFloat 读取数值配置 兼容toml中的整数与浮点写法
+func configFloat(key string, def float64) float64 {
+	if ConfigTree == nil {
+		return def
+	}
+	switch v := ConfigTree.Get(key).(type) {
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return def
+}
+
+// configString 读取字符串配置 未配置时返回默认值
+func configString(key string, def string) string {
+	if ConfigTree == nil {
+		return def
+	}
+	if v, ok := ConfigTree.Get(key).(string); ok {
+		return v
+	}
+	return def
+}
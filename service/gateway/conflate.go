@@ -0,0 +1,129 @@
+package gateway
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync/atomic"
+
+	"github.com/OSMeteor/firetower/socket"
+
+	json "github.com/json-iterator/go"
+	"github.com/pelletier/go-toml"
+)
+
+// 按topic合并推送
+// 行情一类的topic只有最新的值有意义 匹配合并规则的推送在连接的发送队列中最多只保留一条
+// 新消息到达时如果同一个topic(或同一个合并key)还有消息在排队 直接替换排队中的消息
+// 慢连接拿到的总是最新的状态 而不是积压的旧数据或因队列已满被丢弃
+
+// ConflateRule 合并规则 对应配置文件中的 [[conflate]]
+type ConflateRule struct {
+	Pattern string // 匹配topic的通配符 path.Match语法 例如 "ticker_*"
+	Key     string // 可选 推送内容(json)中的字段 以"."分隔多级 同一topic下该字段的值相同的消息才合并
+}
+
+// conflateRules 当前生效的合并规则 按顺序匹配第一条
+// 运行时整体替换 读取方每次只取一次快照
+var conflateRules atomic.Pointer[[]ConflateRule]
+
+// conflateMarker 合并推送在发送队列中的占位消息类型 占位消息的Topic为合并key
+const conflateMarker = "\x00conflate"
+
+func loadConflate() {
+	var rules []ConflateRule
+	if ConfigTree != nil {
+		if trees, ok := ConfigTree.Get("conflate").([]*toml.Tree); ok {
+			for _, tree := range trees {
+				pattern, _ := tree.Get("Pattern").(string)
+				key, _ := tree.Get("Key").(string)
+				rules = append(rules, ConflateRule{Pattern: pattern, Key: key})
+			}
+		}
+	}
+	if err := SetConflateRules(rules); err != nil {
+		fmt.Println("conflate rules load failed:", err)
+	}
+}
+
+// SetConflateRules 运行时替换合并规则
+func SetConflateRules(rules []ConflateRule) error {
+	for _, r := range rules {
+		if r.Pattern == "" {
+			return fmt.Errorf("conflate pattern is empty")
+		}
+		if _, err := path.Match(r.Pattern, ""); err != nil {
+			return fmt.Errorf("conflate pattern %q: %v", r.Pattern, err)
+		}
+	}
+	rules = append([]ConflateRule(nil), rules...)
+	conflateRules.Store(&rules)
+	return nil
+}
+
+// ConflateRules 返回当前生效的合并规则 返回值不应被修改
+func ConflateRules() []ConflateRule {
+	if rules := conflateRules.Load(); rules != nil {
+		return *rules
+	}
+	return nil
+}
+
+// conflateKey 返回推送消息的合并key 不需要合并时ok为false
+// 规则设置了Key但内容中没有该字段时不合并
+func conflateKey(message *socket.SendMessage) (key string, ok bool) {
+	if message.Type != socket.PublishKey {
+		return "", false
+	}
+	for _, r := range ConflateRules() {
+		if matched, _ := path.Match(r.Pattern, message.Topic); !matched {
+			continue
+		}
+		if r.Key == "" {
+			return message.Topic, true
+		}
+		fields := strings.Split(r.Key, ".")
+		keys := make([]interface{}, len(fields))
+		for i, f := range fields {
+			keys[i] = f
+		}
+		v := json.Get(message.Data, keys...)
+		if v.LastError() != nil {
+			return "", false
+		}
+		return message.Topic + "\x00" + v.ToString(), true
+	}
+	return "", false
+}
+
+// sendConflated 将需要合并的消息放入发送队列 发送队列已满时返回false
+// 同一个key已经有消息在排队时替换它 否则放入一条占位消息 sendLoop写出时再取最新的消息
+func (t *FireTower) sendConflated(key string, message *socket.SendMessage) bool {
+	t.conflateMu.Lock()
+	defer t.conflateMu.Unlock()
+	if _, ok := t.conflated[key]; ok {
+		t.conflated[key] = message
+		atomic.AddUint64(&t.conflatedNum, 1)
+		return true
+	}
+	if t.conflated == nil {
+		t.conflated = make(map[string]*socket.SendMessage)
+	}
+	t.conflated[key] = message
+	select {
+	case t.sendOut <- &socket.SendMessage{Type: conflateMarker, Topic: key}:
+		return true
+	default:
+		delete(t.conflated, key)
+		return false
+	}
+}
+
+// takeConflated 取出占位消息对应的最新消息
+func (t *FireTower) takeConflated(key string) *socket.SendMessage {
+	t.conflateMu.Lock()
+	defer t.conflateMu.Unlock()
+	message := t.conflated[key]
+	delete(t.conflated, key)
+	return message
+}
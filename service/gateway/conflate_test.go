@@ -0,0 +1,93 @@
+package gateway
+
+import (
+	"testing"
+
+	"github.com/OSMeteor/firetower/socket"
+)
+
+func TestConflateKey(t *testing.T) {
+	if err := SetConflateRules([]ConflateRule{{Pattern: "ticker_*"}, {Pattern: "quote/*", Key: "data.symbol"}}); err != nil {
+		t.Fatal(err)
+	}
+	defer SetConflateRules(nil)
+	if err := SetConflateRules([]ConflateRule{{Pattern: "["}}); err == nil {
+		t.Error("invalid pattern should be rejected")
+	}
+
+	cases := []struct {
+		topic, data, key string
+		ok               bool
+	}{
+		{"ticker_btc", `1`, "ticker_btc", true},
+		{"quote/us", `{"data":{"symbol":"AAPL"}}`, "quote/us\x00AAPL", true},
+		{"quote/us", `{"data":{}}`, "", false},
+		{"chat", `1`, "", false},
+	}
+	for _, c := range cases {
+		key, ok := conflateKey(controlMessage(socket.PublishKey, c.topic, c.data))
+		if key != c.key || ok != c.ok {
+			t.Errorf("conflateKey(%s, %s) = %q %v", c.topic, c.data, key, ok)
+		}
+	}
+	if _, ok := conflateKey(controlMessage(socket.OfflineTopicKey, "ticker_btc", "")); ok {
+		t.Error("only publishes should be conflated")
+	}
+}
+
+func TestConflation(t *testing.T) {
+	SetConflateRules([]ConflateRule{{Pattern: "ticker_*"}, {Pattern: "quote", Key: "symbol"}})
+	defer SetConflateRules(nil)
+	setupSubscribeTest(t)
+	server, client := Pipe(16)
+	tower := BuildTower(server, "c1")
+
+	// 连接还没有开始写出 消息都在发送队列中排队
+	for _, data := range []string{"1", "2", "3"} {
+		tower.Send(controlMessage(socket.PublishKey, "ticker_btc", data))
+	}
+	tower.Send(controlMessage(socket.PublishKey, "chat", "hello"))
+	for _, data := range []string{`{"symbol":"a","v":1}`, `{"symbol":"b","v":1}`, `{"symbol":"a","v":2}`} {
+		tower.Send(controlMessage(socket.PublishKey, "quote", data))
+	}
+	if len(tower.sendOut) != 4 || tower.conflatedNum != 3 {
+		t.Fatalf("expected 4 queued and 3 conflated, got %d %d", len(tower.sendOut), tower.conflatedNum)
+	}
+
+	startTower(t, tower)
+	// 合并后的消息占据最早一条消息的位置
+	for _, want := range []string{"3", "hello", `{"symbol":"a","v":2}`, `{"symbol":"b","v":1}`} {
+		if _, data, err := client.ReadMessage(); err != nil || string(data) != want {
+			t.Fatalf("expected %s, got %q %v", want, data, err)
+		}
+	}
+
+	// 写出之后的新消息重新排队
+	tower.Send(controlMessage(socket.PublishKey, "ticker_btc", "4"))
+	if _, data, _ := client.ReadMessage(); string(data) != "4" {
+		t.Errorf("expected 4, got %q", data)
+	}
+}
+
+func TestConflateRulesConcurrent(t *testing.T) {
+	defer SetConflateRules(nil)
+	message := controlMessage(socket.PublishKey, "ticker_btc", "1")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			conflateKey(message)
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		if i%2 == 0 {
+			SetConflateRules([]ConflateRule{{Pattern: "ticker_*"}})
+		} else {
+			SetConflateRules(nil)
+		}
+	}
+	<-done
+	if len(ConflateRules()) != 0 {
+		t.Errorf("expected the last rules to be empty, got %v", ConflateRules())
+	}
+}
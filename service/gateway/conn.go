@@ -0,0 +1,149 @@
+package gateway
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/OSMeteor/firetower/socket"
+
+	"github.com/gorilla/websocket"
+)
+
+// Conn FireTower依赖的底层连接
+// websocket通过NewWebsocketConn适配 SSE、长轮询与内存管道都实现了该接口
+type Conn interface {
+	ReadMessage() (messageType int, p []byte, err error)
+	WriteMessage(messageType int, data []byte) error
+	SetWriteDeadline(t time.Time) error
+	Close() error
+}
+
+// CloseWriter 可选接口 支持携带close code通知客户端的连接实现该接口
+type CloseWriter interface {
+	WriteClose(code int, reason string) error
+}
+
+// FrameReader 可选接口 自带消息结构的连接(例如TCP帧)实现该接口
+// FireTower会直接使用解析好的消息 不再对内容做json解码
+type FrameReader interface {
+	ReadFrame() (*TopicMessage, error)
+}
+
+// FrameWriter 可选接口 需要消息类型、topic等完整信息才能编码的连接实现该接口
+// FireTower会用它代替WriteMessage写出发送队列中的消息
+type FrameWriter interface {
+	WriteFrame(message *socket.SendMessage) error
+}
+
+// websocketConn gorilla websocket的适配器
+type websocketConn struct {
+	*websocket.Conn
+}
+
+// NewWebsocketConn 将gorilla websocket连接适配为Conn
+func NewWebsocketConn(ws *websocket.Conn) Conn {
+	return &websocketConn{Conn: ws}
+}
+
+// WriteClose 发送websocket关闭帧
+func (c *websocketConn) WriteClose(code int, reason string) error {
+	return c.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+}
+
+// ErrorPipeTimeout 内存管道写入超过截止时间
+var ErrorPipeTimeout = errors.New("pipe write timeout")
+
+type pipeMessage struct {
+	messageType int
+	data        []byte
+}
+
+// pipeShared 管道两端共享的关闭状态
+type pipeShared struct {
+	once   sync.Once
+	closed chan struct{}
+}
+
+// PipeConn 内存管道的一端 用于在不依赖网络的情况下测试FireTower及其回调
+type PipeConn struct {
+	in       chan pipeMessage
+	out      chan pipeMessage
+	shared   *pipeShared
+	mu       sync.Mutex
+	deadline time.Time
+}
+
+// Pipe 创建一对相连的内存连接 一端写入的消息由另一端读取
+// 任意一端关闭后两端都会关闭 buffer为每个方向可以缓存的消息数
+func Pipe(buffer int) (*PipeConn, *PipeConn) {
+	a := make(chan pipeMessage, buffer)
+	b := make(chan pipeMessage, buffer)
+	shared := &pipeShared{closed: make(chan struct{})}
+	return &PipeConn{in: a, out: b, shared: shared}, &PipeConn{in: b, out: a, shared: shared}
+}
+
+// ReadMessage 读取对端写入的消息 缓冲中的消息读完且管道关闭后返回io.EOF
+func (p *PipeConn) ReadMessage() (int, []byte, error) {
+	select {
+	case m := <-p.in:
+		return m.messageType, m.data, nil
+	default:
+	}
+	select {
+	case m := <-p.in:
+		return m.messageType, m.data, nil
+	case <-p.shared.closed:
+		return 0, nil, io.EOF
+	}
+}
+
+// WriteMessage 向对端写入一条消息 缓冲已满时阻塞到截止时间
+func (p *PipeConn) WriteMessage(messageType int, data []byte) error {
+	m := pipeMessage{messageType: messageType, data: append([]byte(nil), data...)}
+	p.mu.Lock()
+	deadline := p.deadline
+	p.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-p.shared.closed:
+		return ErrorClose
+	default:
+	}
+	select {
+	case p.out <- m:
+		return nil
+	case <-p.shared.closed:
+		return ErrorClose
+	case <-timeout:
+		return ErrorPipeTimeout
+	}
+}
+
+// SetWriteDeadline 设置写入截止时间 零值表示不超时
+func (p *PipeConn) SetWriteDeadline(t time.Time) error {
+	p.mu.Lock()
+	p.deadline = t
+	p.mu.Unlock()
+	return nil
+}
+
+// WriteClose 向对端写入websocket格式的关闭帧
+func (p *PipeConn) WriteClose(code int, reason string) error {
+	return p.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason))
+}
+
+// Close 关闭管道两端
+func (p *PipeConn) Close() error {
+	p.shared.once.Do(func() {
+		close(p.shared.closed)
+	})
+	return nil
+}
@@ -0,0 +1,50 @@
+package gateway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestPipe(t *testing.T) {
+	server, client := Pipe(1)
+	if err := client.WriteMessage(websocket.TextMessage, []byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if mt, data, err := server.ReadMessage(); err != nil || mt != websocket.TextMessage || string(data) != "hi" {
+		t.Fatalf("unexpected read %d %q %v", mt, data, err)
+	}
+
+	client.WriteMessage(websocket.TextMessage, []byte("fill"))
+	client.SetWriteDeadline(time.Now().Add(20 * time.Millisecond))
+	if err := client.WriteMessage(websocket.TextMessage, []byte("blocked")); err != ErrorPipeTimeout {
+		t.Errorf("expected write timeout on a full pipe, got %v", err)
+	}
+
+	server.Close()
+	if _, _, err := client.ReadMessage(); err == nil {
+		t.Error("closing one end should close the other")
+	}
+}
+
+func TestTowerOverPipe(t *testing.T) {
+	setupTransportTest(t)
+	server, client := Pipe(16)
+	tower := BuildTower(server, "c1")
+	tower.SetTypeHandler("echo", func(fire *FireInfo) bool {
+		return tower.ToSelf(fire.Message.Data) == nil
+	})
+	startTower(t, tower)
+
+	client.WriteMessage(websocket.TextMessage, []byte(`{"type":"echo","data":{"n":1}}`))
+	if _, data, err := client.ReadMessage(); err != nil || string(data) != `{"n":1}` {
+		t.Fatalf("unexpected echo %q %v", data, err)
+	}
+
+	tower.closeWithCode(websocket.ClosePolicyViolation, "bye")
+	mt, data, err := client.ReadMessage()
+	if err != nil || mt != websocket.CloseMessage || string(data[2:]) != "bye" {
+		t.Errorf("expected a close frame, got %d %q %v", mt, data, err)
+	}
+}
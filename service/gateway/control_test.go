@@ -0,0 +1,75 @@
+package gateway
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/OSMeteor/firetower/grpc/manager"
+	"github.com/OSMeteor/firetower/socket"
+
+	"google.golang.org/grpc"
+)
+
+// countingManagerClient 记录退订调用次数与退订的topic数量
+type countingManagerClient struct {
+	subscribeManagerClient
+	calls, topics int64
+}
+
+func (c *countingManagerClient) UnSubscribeTopic(ctx context.Context, in *pb.UnSubscribeTopicRequest, opts ...grpc.CallOption) (*pb.UnSubscribeTopicResponse, error) {
+	atomic.AddInt64(&c.calls, 1)
+	atomic.AddInt64(&c.topics, int64(len(in.Topic)))
+	return &pb.UnSubscribeTopicResponse{}, nil
+}
+
+func TestUnSubscribeAllLargeTopic(t *testing.T) {
+	setupSubscribeTest(t)
+	client := &countingManagerClient{}
+	topicManageGrpc = client
+
+	const n = 200
+	var removed int64
+	towers := make([]*FireTower, n)
+	for i := range towers {
+		towers[i] = newMockTower("c", 1)
+		towers[i].topic = make(map[string]bool)
+		towers[i].onSystemRemove = func(topic string) { atomic.AddInt64(&removed, 1) }
+		if _, err := towers[i].bindTopic([]string{"big", "small"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- TM.GetBucket(towers[0]).unSubscribeAll(controlMessage(socket.OfflineTopicKey, "big", ""))
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("unSubscribeAll did not finish")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if client.calls != 1 || client.topics != n {
+		t.Errorf("expected 1 batched rpc for %d subscriptions, got %d calls %d topics", n, client.calls, client.topics)
+	}
+	if removed != n {
+		t.Errorf("expected %d onSystemRemove callbacks, got %d", n, removed)
+	}
+	if TM.TopicSubscribers("big") != 0 || TM.TopicSubscribers("small") != n {
+		t.Error("only the removed topic should lose its subscribers")
+	}
+	for _, tower := range towers {
+		if tower.hasTopic("big") || !tower.hasTopic("small") {
+			t.Fatalf("tower %d should only leave big, has %v", tower.ConnId(), tower.Topics())
+		}
+	}
+	if err := TM.GetBucket(towers[0]).unSubscribeAll(controlMessage(socket.OfflineTopicKey, "big", "")); err != ErrorTopicEmpty {
+		t.Errorf("expected ErrorTopicEmpty for a topic without subscribers, got %v", err)
+	}
+}
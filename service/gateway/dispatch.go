@@ -0,0 +1,184 @@
+package gateway
+
+import (
+	"fmt"
+	"math/bits"
+	"sync/atomic"
+
+	"github.com/OSMeteor/firetower/socket"
+)
+
+// 中心队列按topic分发消息
+// TowerManager为每个topic维护一个bucket位图 位i表示第i个bucket中有该topic的订阅者
+// 位图由AddSubscribe/DelSubscribe在bucket中出现第一个订阅者、移除最后一个订阅者时更新
+// 分发时只投递到持有该topic的bucket 当前实例没有订阅者的topic直接跳过
+
+// bucketSet 记录bucket下标的位图
+type bucketSet []uint64
+
+func (s bucketSet) has(i int) bool {
+	return i/64 < len(s) && s[i/64]&(1<<uint(i%64)) != 0
+}
+
+func (s bucketSet) set(i int) bucketSet {
+	for len(s) <= i/64 {
+		s = append(s, 0)
+	}
+	s[i/64] |= 1 << uint(i%64)
+	return s
+}
+
+// clear 清除第i位 返回位图是否已经为空
+func (s bucketSet) clear(i int) bool {
+	if i/64 < len(s) {
+		s[i/64] &^= 1 << uint(i%64)
+	}
+	for _, w := range s {
+		if w != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// addBucket 将bucket加入管理中心 bucket在位图中的位置即其在t.bucket中的下标
+func (t *TowerManager) addBucket(b *Bucket) {
+	b.index = len(t.bucket)
+	b.manager = t
+	t.bucket = append(t.bucket, b)
+}
+
+// markTopic bucket中出现了topic的第一个订阅者 调用方持有该bucket的锁
+func (t *TowerManager) markTopic(topic string, index int) {
+	t.topicMu.Lock()
+	if t.topicBucket == nil {
+		t.topicBucket = make(map[string]bucketSet)
+	}
+	t.topicBucket[topic] = t.topicBucket[topic].set(index)
+	t.topicMu.Unlock()
+}
+
+// unmarkTopic bucket中topic的最后一个订阅者被移除 调用方持有该bucket的锁
+func (t *TowerManager) unmarkTopic(topic string, index int) {
+	t.topicMu.Lock()
+	if s, ok := t.topicBucket[topic]; ok && s.clear(index) {
+		delete(t.topicBucket, topic)
+	}
+	t.topicMu.Unlock()
+}
+
+// topicBuckets 将持有该topic订阅者的bucket追加到dst中
+func (t *TowerManager) topicBuckets(topic string, dst []*Bucket) []*Bucket {
+	t.topicMu.RLock()
+	defer t.topicMu.RUnlock()
+	for i, w := range t.topicBucket[topic] {
+		for w != 0 {
+			dst = append(dst, t.bucket[i*64+bits.TrailingZeros64(w)])
+			w &= w - 1
+		}
+	}
+	return dst
+}
+
+// userBuckets 将该用户的连接所在的bucket追加到dst中
+func (t *TowerManager) userBuckets(userId string, dst []*Bucket) []*Bucket {
+	var s bucketSet
+	for _, bt := range t.TowersByUser(userId) {
+		b := t.GetBucket(bt)
+		if !s.has(b.index) {
+			s = s.set(b.index)
+			dst = append(dst, b)
+		}
+	}
+	return dst
+}
+
+// receive 接收来自topicManager的消息 控制消息进入优先队列
+func (t *TowerManager) receive(message *socket.SendMessage) {
+	if socket.IsControl(message.Type) {
+		t.controlChan <- message
+		return
+	}
+	t.centralChan <- message
+}
+
+// dispatch 将消息投递到需要处理它的bucket 返回投递到的bucket
+// 控制消息进入bucket的ControlChan 推送消息进入BuffChan
+// buckets作为缓冲复用 避免每条消息分配
+func (t *TowerManager) dispatch(message *socket.SendMessage, buckets []*Bucket) []*Bucket {
+	switch message.Type {
+	case socket.PublishKey, socket.OfflineTopicKey, socket.OfflineTopicByUserIdKey:
+		buckets = t.topicBuckets(message.Topic, buckets[:0])
+	case socket.OfflineUserKey:
+		buckets = t.userBuckets(string(message.Data), buckets[:0])
+	default:
+		buckets = append(buckets[:0], t.bucket...)
+	}
+	if len(buckets) == 0 {
+		atomic.AddUint64(&t.skippedNum, 1)
+		return buckets
+	}
+	control := socket.IsControl(message.Type)
+	for _, b := range buckets {
+		if control {
+			b.ControlChan <- message
+		} else {
+			t.deliver(b, message)
+		}
+	}
+	return buckets
+}
+
+// deliver 将推送消息放入bucket队列 队列已满等待时继续分发控制消息
+// 某个bucket的推送积压不会延迟踢人等操作
+func (t *TowerManager) deliver(b *Bucket, message *socket.SendMessage) {
+	for {
+		select {
+		case b.BuffChan <- message:
+			return
+		case ctl := <-t.controlChan:
+			t.handle(ctl, nil)
+		}
+	}
+}
+
+// handle 分发一条消息并回收
+func (t *TowerManager) handle(message *socket.SendMessage, buckets []*Bucket) []*Bucket {
+	if expired(message, expireDispatch) {
+		message.Info("Expired")
+		message.Recycling()
+		return buckets[:0]
+	}
+	buckets = t.dispatch(message, buckets)
+	if len(buckets) == 0 {
+		message.Info("Skipped")
+	} else {
+		message.Info("Sended")
+	}
+	message.Recycling()
+	return buckets
+}
+
+// dispatchLoop 中心处理器 将centralChan中的消息分发到各个bucket
+func (t *TowerManager) dispatchLoop() {
+	defer func() {
+		if err := recover(); err != nil {
+			fmt.Printf("PANIC: towerManager central processor recovered: %v\n", err)
+		}
+	}()
+	var buckets []*Bucket
+	for {
+		select {
+		case message := <-t.controlChan:
+			buckets = t.handle(message, buckets)
+			continue
+		default:
+		}
+		select {
+		case message := <-t.controlChan:
+			buckets = t.handle(message, buckets)
+		case message := <-t.centralChan:
+			buckets = t.handle(message, buckets)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package gateway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/OSMeteor/firetower/socket"
+)
+
+// newDispatchManager 构建不启动消费者的管理中心 便于检查各bucket收到的消息
+func newDispatchManager(bucketNum int) *TowerManager {
+	tm := &TowerManager{}
+	for i := 0; i < bucketNum; i++ {
+		tm.addBucket(&Bucket{
+			topicRelevance: make(map[string]map[uint64]*FireTower),
+			BuffChan:       make(chan *socket.SendMessage, 8),
+			ControlChan:    make(chan *socket.SendMessage, 8),
+		})
+	}
+	return tm
+}
+
+// queued 各bucket队列中等待处理的消息数
+func queued(tm *TowerManager) []int {
+	res := make([]int, len(tm.bucket))
+	for i, b := range tm.bucket {
+		res[i] = len(b.BuffChan)
+	}
+	return res
+}
+
+func TestBucketSet(t *testing.T) {
+	var s bucketSet
+	s = s.set(3).set(70)
+	if !s.has(3) || !s.has(70) || s.has(4) || s.has(200) {
+		t.Fatalf("unexpected bits %b", s)
+	}
+	if s.clear(3) || !s.clear(70) {
+		t.Error("clear should report empty only after the last bit")
+	}
+}
+
+func TestTopicAwareDispatch(t *testing.T) {
+	tm := newDispatchManager(70)
+	a, b := newMockTower("a", 1), newMockTower("b", 1)
+	tm.bucket[2].AddSubscribe("room_1", a)
+	tm.bucket[67].AddSubscribe("room_1", b)
+	tm.bucket[67].AddSubscribe("room_2", b)
+
+	buckets := tm.dispatch(controlMessage(socket.PublishKey, "room_1", "hi"), nil)
+	if len(buckets) != 2 || buckets[0] != tm.bucket[2] || buckets[1] != tm.bucket[67] {
+		t.Fatalf("expected dispatch to buckets 2 and 67, got %v", buckets)
+	}
+	if q := queued(tm); q[2] != 1 || q[67] != 1 || q[0] != 0 {
+		t.Errorf("unexpected queue lengths %v", q)
+	}
+
+	if buckets = tm.dispatch(controlMessage(socket.PublishKey, "nobody", "hi"), buckets); len(buckets) != 0 || tm.skippedNum != 1 {
+		t.Errorf("topics without local subscribers should be skipped, got %d buckets", len(buckets))
+	}
+
+	// 移除bucket中最后一个订阅者后不再投递
+	tm.bucket[2].DelSubscribe("room_1", a)
+	if buckets = tm.dispatch(controlMessage(socket.OfflineTopicKey, "room_1", ""), buckets); len(buckets) != 1 || buckets[0] != tm.bucket[67] {
+		t.Errorf("expected dispatch to bucket 67 only, got %v", buckets)
+	}
+	tm.bucket[67].DelSubscribe("room_1", b)
+	if _, ok := tm.topicBucket["room_1"]; ok {
+		t.Error("topic without subscribers should leave the bitmap")
+	}
+	if _, ok := tm.topicBucket["room_2"]; !ok {
+		t.Error("other topics of the bucket should stay")
+	}
+}
+
+func TestDispatchOfflineUser(t *testing.T) {
+	setupSubscribeTest(t)
+	TM = newDispatchManager(4)
+	tower, _ := runPipeTower(t, "c1", "u1")
+
+	buckets := TM.dispatch(controlMessage(socket.OfflineUserKey, "*", "u1"), nil)
+	if len(buckets) != 1 || buckets[0] != TM.GetBucket(tower) {
+		t.Errorf("kick should only reach the bucket of the user's tower, got %v", buckets)
+	}
+	if buckets = TM.dispatch(controlMessage(socket.OfflineUserKey, "*", "nobody"), buckets); len(buckets) != 0 {
+		t.Errorf("kicking an offline user should be skipped, got %v", buckets)
+	}
+}
+
+func TestControlPriority(t *testing.T) {
+	tm := newDispatchManager(1)
+	tm.controlChan = make(chan *socket.SendMessage, 1)
+	bucket := tm.bucket[0]
+	bucket.AddSubscribe("room_1", newMockTower("a", 1))
+	for len(bucket.BuffChan) < cap(bucket.BuffChan) {
+		bucket.BuffChan <- controlMessage(socket.PublishKey, "room_1", "backlog")
+	}
+
+	// bucket的推送队列已满 分发器阻塞在推送消息上
+	done := make(chan struct{})
+	go func() {
+		tm.dispatch(controlMessage(socket.PublishKey, "room_1", "hi"), nil)
+		close(done)
+	}()
+	tm.receive(controlMessage(socket.OfflineTopicKey, "room_1", ""))
+	select {
+	case m := <-bucket.ControlChan:
+		if m.Type != socket.OfflineTopicKey {
+			t.Errorf("unexpected control message %s", m.Type)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("control message should not wait behind a stuck publish")
+	}
+
+	<-bucket.BuffChan
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("publish should be delivered once the bucket has room")
+	}
+}
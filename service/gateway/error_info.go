@@ -7,4 +7,22 @@ var (
 	ErrorClose = errors.New("firetower is collapsed")
 	// ErrorTopicEmpty topic不存在的错误信息
 	ErrorTopicEmpty = errors.New("topic is empty")
+	// ErrorTCPAddressEmpty 未配置原生TCP接入的监听地址
+	ErrorTCPAddressEmpty = errors.New("tcp address is empty")
+	// ErrorAdminAddressEmpty 未配置管理接口的监听地址
+	ErrorAdminAddressEmpty = errors.New("admin address is empty")
+	// ErrorExpired 消息已经过期
+	ErrorExpired = errors.New("message expired")
+)
+
+// 下发给客户端的错误帧code
+const (
+	// ErrorCodeRateLimited 客户端上行消息触发限流
+	ErrorCodeRateLimited = "rate_limited"
+	// ErrorCodeTopicInvalid topic名称为空、过长或包含不允许的字符
+	ErrorCodeTopicInvalid = "topic_invalid"
+	// ErrorCodeTopicQuota 超出单个连接可订阅的topic数量
+	ErrorCodeTopicQuota = "topic_quota_exceeded"
+	// ErrorCodeTopicFull 该topic在当前gateway上的订阅数已达上限
+	ErrorCodeTopicFull = "topic_full"
 )
@@ -0,0 +1,47 @@
+package gateway
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/OSMeteor/firetower/socket"
+)
+
+// 过期消息的丢弃
+// 推送可以携带过期时间(socket.SendMessage.Deadline) 消息在中心队列分发、bucket推送以及连接写出前各检查一次
+// 已经过期的消息直接丢弃并计数 负载高时不再推送早已失效的数据(例如行情)
+
+// 消息被丢弃的位置
+const (
+	expireDispatch = iota // 中心队列分发
+	expireBucket          // bucket推送
+	expireSend            // 连接写出
+)
+
+var expiredNum [3]uint64
+
+// ExpiredStats 各阶段因过期被丢弃的消息数
+// Bucket按bucket计数 Send按连接计数
+type ExpiredStats struct {
+	Dispatch uint64 `json:"dispatch"`
+	Bucket   uint64 `json:"bucket"`
+	Send     uint64 `json:"send"`
+}
+
+// expired 消息已经过期时计数并返回true
+func expired(message *socket.SendMessage, stage int) bool {
+	if message.Deadline <= 0 || !message.Expired(time.Now()) {
+		return false
+	}
+	atomic.AddUint64(&expiredNum[stage], 1)
+	return true
+}
+
+// Expired 当前实例各阶段因过期被丢弃的消息数
+func Expired() *ExpiredStats {
+	return &ExpiredStats{
+		Dispatch: atomic.LoadUint64(&expiredNum[expireDispatch]),
+		Bucket:   atomic.LoadUint64(&expiredNum[expireBucket]),
+		Send:     atomic.LoadUint64(&expiredNum[expireSend]),
+	}
+}
@@ -0,0 +1,55 @@
+package gateway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/OSMeteor/firetower/socket"
+)
+
+func expiredMessage(topic, data string, deadline time.Time) *socket.SendMessage {
+	message := controlMessage(socket.PublishKey, topic, data)
+	message.Deadline = deadline.UnixMilli()
+	return message
+}
+
+func TestExpiredDispatchAndPush(t *testing.T) {
+	before := *Expired()
+	tm := newDispatchManager(1)
+	bucket := tm.bucket[0]
+	tower := newMockTower("a", 4)
+	bucket.AddSubscribe("ticks", tower)
+
+	tm.handle(expiredMessage("ticks", "old", time.Now().Add(-time.Second)), nil)
+	if len(bucket.BuffChan) != 0 {
+		t.Error("expired message should not be dispatched")
+	}
+	if err := bucket.push(expiredMessage("ticks", "old", time.Now().Add(-time.Second))); err != ErrorExpired {
+		t.Errorf("expected ErrorExpired, got %v", err)
+	}
+	if err := bucket.push(expiredMessage("ticks", "fresh", time.Now().Add(time.Minute))); err != nil || len(tower.sendOut) != 1 {
+		t.Errorf("fresh message should be pushed, got %v", err)
+	}
+	after := Expired()
+	if after.Dispatch-before.Dispatch != 1 || after.Bucket-before.Bucket != 1 {
+		t.Errorf("unexpected expired counters %+v", after)
+	}
+}
+
+func TestExpiredBeforeWrite(t *testing.T) {
+	setupSubscribeTest(t)
+	tower, client := runPipeTower(t, "c1", "")
+
+	tower.Send(expiredMessage("ticks", "stale", time.Now().Add(-time.Second)))
+	tower.Send(expiredMessage("ticks", "fresh", time.Now().Add(time.Minute)))
+	if _, data, err := client.ReadMessage(); err != nil || string(data) != "fresh" {
+		t.Fatalf("expected only the fresh message, got %q %v", data, err)
+	}
+	info := tower.info()
+	for deadline := time.Now().Add(time.Second); info.Sent == 0 && time.Now().Before(deadline); info = tower.info() {
+		time.Sleep(time.Millisecond)
+	}
+	if info.Expired != 1 || info.Sent != 1 {
+		t.Errorf("expected 1 expired and 1 sent, got %d %d", info.Expired, info.Sent)
+	}
+}
@@ -0,0 +1,51 @@
+package gateway
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HTTPMaxBodySize 通过HTTP POST提交的单条客户端消息的最大字节数
+// SSE与长轮询传输共用 在Init时从配置 http.MaxBodySize 加载 兼容旧的配置项 sse.MaxBodySize
+var HTTPMaxBodySize int64 = 64 * 1024
+
+func loadHTTPTransport() {
+	HTTPMaxBodySize = configInt("http.MaxBodySize", configInt("sse.MaxBodySize", 64*1024))
+	loadSSE()
+	loadLongPoll()
+}
+
+// newSessionId 生成一个不可猜测的会话id 会话id同时作为提交消息的凭证
+func newSessionId() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(IdWorker.GetId(), 10)
+	}
+	return hex.EncodeToString(b)
+}
+
+// deliverHTTPMessage 读取POST提交的客户端消息并交给会话的readIn
+// 与websocket一样 readLoop消费过慢时最多等待3秒
+func deliverHTTPMessage(w http.ResponseWriter, r *http.Request, readIn chan []byte, closed chan struct{}) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, HTTPMaxBodySize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if len(data) == 0 {
+		http.Error(w, "empty message", http.StatusBadRequest)
+		return
+	}
+	select {
+	case readIn <- data:
+		w.WriteHeader(http.StatusAccepted)
+	case <-closed:
+		http.Error(w, ErrorClose.Error(), http.StatusGone)
+	case <-time.After(3 * time.Second):
+		http.Error(w, "read timeout", http.StatusServiceUnavailable)
+	}
+}
@@ -0,0 +1,122 @@
+package gateway
+
+// 当前实例上运行中的连接索引
+// 连接在Run时登记 Close时注销 控制消息(踢人、按用户退订)通过索引直接找到用户的所有连接
+// 而不依赖连接订阅了哪些topic
+
+// addTower 登记一个开始运行的连接
+// ClientId已有运行中的连接时按DuplicateClientPolicy处理
+// 返回需要被替换(关闭)的旧连接 ok为false表示新连接被拒绝 没有登记
+func (t *TowerManager) addTower(bt *FireTower) (replaced []*FireTower, ok bool) {
+	t.indexMu.Lock()
+	defer t.indexMu.Unlock()
+	if t.towers == nil {
+		t.towers = make(map[uint64]*FireTower)
+		t.users = make(map[string]map[uint64]*FireTower)
+		t.clients = make(map[string]map[uint64]*FireTower)
+	}
+	if exist := t.clients[bt.ClientId]; len(exist) > 0 {
+		switch DuplicateClientPolicy {
+		case DuplicateClientReject:
+			return nil, false
+		case DuplicateClientReplace:
+			replaced = towerSlice(exist)
+		}
+	}
+	t.towers[bt.connId] = bt
+	bt.indexUser, bt.indexClient = bt.UserId, bt.ClientId
+	addIndex(t.users, bt.indexUser, bt)
+	addIndex(t.clients, bt.indexClient, bt)
+	return replaced, true
+}
+
+// delTower 连接关闭时注销
+func (t *TowerManager) delTower(bt *FireTower) {
+	t.indexMu.Lock()
+	defer t.indexMu.Unlock()
+	if t.towers[bt.connId] != bt {
+		return
+	}
+	delete(t.towers, bt.connId)
+	delIndex(t.users, bt.indexUser, bt)
+	delIndex(t.clients, bt.indexClient, bt)
+}
+
+// setUserId 修改连接的UserId并更新用户索引
+func (t *TowerManager) setUserId(bt *FireTower, userId string) {
+	t.indexMu.Lock()
+	defer t.indexMu.Unlock()
+	bt.UserId = userId
+	if t.towers[bt.connId] != bt {
+		// 还没有运行的连接在Run时按最新的UserId登记
+		return
+	}
+	delIndex(t.users, bt.indexUser, bt)
+	bt.indexUser = userId
+	addIndex(t.users, userId, bt)
+}
+
+func addIndex(index map[string]map[uint64]*FireTower, key string, bt *FireTower) {
+	if key == "" {
+		return
+	}
+	m, ok := index[key]
+	if !ok {
+		m = make(map[uint64]*FireTower)
+		index[key] = m
+	}
+	m[bt.connId] = bt
+}
+
+func delIndex(index map[string]map[uint64]*FireTower, key string, bt *FireTower) {
+	if m, ok := index[key]; ok {
+		delete(m, bt.connId)
+		if len(m) == 0 {
+			delete(index, key)
+		}
+	}
+}
+
+func towerSlice(m map[uint64]*FireTower) []*FireTower {
+	res := make([]*FireTower, 0, len(m))
+	for _, bt := range m {
+		res = append(res, bt)
+	}
+	return res
+}
+
+// Tower 按连接id查找当前实例上运行中的连接
+func (t *TowerManager) Tower(connId uint64) (*FireTower, bool) {
+	t.indexMu.RLock()
+	defer t.indexMu.RUnlock()
+	bt, ok := t.towers[connId]
+	return bt, ok
+}
+
+// Towers 当前实例上运行中的所有连接
+func (t *TowerManager) Towers() []*FireTower {
+	t.indexMu.RLock()
+	defer t.indexMu.RUnlock()
+	return towerSlice(t.towers)
+}
+
+// TowerNum 当前实例上运行中的连接数
+func (t *TowerManager) TowerNum() int {
+	t.indexMu.RLock()
+	defer t.indexMu.RUnlock()
+	return len(t.towers)
+}
+
+// TowersByUser 当前实例上属于该用户的所有连接
+func (t *TowerManager) TowersByUser(userId string) []*FireTower {
+	t.indexMu.RLock()
+	defer t.indexMu.RUnlock()
+	return towerSlice(t.users[userId])
+}
+
+// TowersByClient 当前实例上使用该ClientId的所有连接
+func (t *TowerManager) TowersByClient(clientId string) []*FireTower {
+	t.indexMu.RLock()
+	defer t.indexMu.RUnlock()
+	return towerSlice(t.clients[clientId])
+}
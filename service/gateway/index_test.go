@@ -0,0 +1,123 @@
+package gateway
+
+import (
+	"testing"
+
+	"github.com/OSMeteor/firetower/socket"
+)
+
+func controlMessage(pushType, topic, data string) *socket.SendMessage {
+	message := socket.GetSendMessage("0", "system")
+	message.Type, message.Topic, message.Data = pushType, topic, []byte(data)
+	return message
+}
+
+func TestTowerIndex(t *testing.T) {
+	setupSubscribeTest(t)
+	a, _ := runPipeTower(t, "c1", "u1")
+	b, _ := runPipeTower(t, "c1", "u1")
+	c, _ := runPipeTower(t, "c2", "")
+
+	if towers := TM.TowersByUser("u1"); len(towers) != 2 {
+		t.Fatalf("expected 2 towers for u1, got %d", len(towers))
+	}
+	if towers := TM.TowersByClient("c2"); len(towers) != 1 || towers[0] != c {
+		t.Fatalf("unexpected towers for c2 %v", towers)
+	}
+	if TM.TowerNum() != 3 {
+		t.Errorf("expected 3 towers, got %d", TM.TowerNum())
+	}
+
+	// 连接运行后登录
+	c.SetUserId("u2")
+	if towers := TM.TowersByUser("u2"); len(towers) != 1 || towers[0] != c || c.UserId != "u2" {
+		t.Errorf("user index should follow SetUserId, got %v", towers)
+	}
+	b.SetUserId("u2")
+	if len(TM.TowersByUser("u1")) != 1 || len(TM.TowersByUser("u2")) != 2 {
+		t.Error("changing user id should move the tower between users")
+	}
+
+	a.Close()
+	if len(TM.TowersByUser("u1")) != 0 || len(TM.TowersByClient("c1")) != 1 {
+		t.Error("closed tower should leave the indexes")
+	}
+}
+
+func TestOfflineUserWithoutSubscription(t *testing.T) {
+	setupSubscribeTest(t)
+	a, ca := runPipeTower(t, "c1", "u1")
+	b, cb := runPipeTower(t, "c2", "u1")
+	other, _ := runPipeTower(t, "c3", "u2")
+	a.bindTopic([]string{"room_1"})
+
+	bucket := TM.bucket[0]
+	if err := bucket.offlineUsers(controlMessage(socket.OfflineUserKey, "room_1", "u1")); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []Conn{ca, cb} {
+		if _, _, err := c.ReadMessage(); err == nil {
+			t.Error("every connection of the user should be closed")
+		}
+	}
+	if _, ok := TM.Tower(b.ConnId()); ok {
+		t.Error("kicked tower should be unregistered")
+	}
+	if _, ok := TM.Tower(other.ConnId()); !ok {
+		t.Error("other users should stay online")
+	}
+	if err := bucket.offlineUsers(controlMessage(socket.OfflineUserKey, "*", "nobody")); err != ErrorTopicEmpty {
+		t.Errorf("expected ErrorTopicEmpty for an unknown user, got %v", err)
+	}
+}
+
+// TestOfflineUserAllTopics manager的管理接口不指定topic踢人时 发给gateway的控制帧topic为*
+func TestOfflineUserAllTopics(t *testing.T) {
+	setupSubscribeTest(t)
+	a, ca := runPipeTower(t, "c1", "u1")
+	b, cb := runPipeTower(t, "c2", "u1")
+	other, _ := runPipeTower(t, "c3", "u2")
+	a.bindTopic([]string{"room_1"})
+	b.bindTopic([]string{"room_2"})
+	other.bindTopic([]string{"room_1"})
+
+	TM.bucket[0].handle(controlMessage(socket.OfflineUserKey, "*", "u1"))
+	for _, c := range []Conn{ca, cb} {
+		if _, _, err := c.ReadMessage(); err == nil {
+			t.Error("connections of the user on every topic should be closed")
+		}
+	}
+	if TM.TopicSubscribers("room_1") != 1 || TM.TopicSubscribers("room_2") != 0 {
+		t.Errorf("only the kicked user should leave its topics, got %d %d", TM.TopicSubscribers("room_1"), TM.TopicSubscribers("room_2"))
+	}
+	if _, ok := TM.Tower(other.ConnId()); !ok || !other.hasTopic("room_1") {
+		t.Error("other users should stay online and subscribed")
+	}
+}
+
+func TestUnSubscribeByUserIdAllConnections(t *testing.T) {
+	setupSubscribeTest(t)
+	var towers []*FireTower
+	unsubscribed := make(chan []string, 4)
+	for _, clientId := range []string{"c1", "c2"} {
+		tower, _ := runPipeTower(t, clientId, "u1")
+		tower.SetUnSubscribeHandler(func(context *FireLife, topic []string) bool {
+			unsubscribed <- topic
+			return true
+		})
+		tower.bindTopic([]string{"room_1", "room_2"})
+		towers = append(towers, tower)
+	}
+
+	if err := TM.bucket[0].unSubscribeByUserId(controlMessage(socket.OfflineTopicByUserIdKey, "room_1", "u1")); err != nil {
+		t.Fatal(err)
+	}
+	for _, tower := range towers {
+		if tower.hasTopic("room_1") || !tower.hasTopic("room_2") {
+			t.Errorf("tower %d should only leave room_1, has %v", tower.ConnId(), tower.Topics())
+		}
+	}
+	if len(unsubscribed) != 2 || TM.TopicSubscribers("room_1") != 0 {
+		t.Errorf("expected both connections to unsubscribe, got %d callbacks", len(unsubscribed))
+	}
+}
@@ -0,0 +1,263 @@
+package gateway
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	json "github.com/json-iterator/go"
+)
+
+var (
+	// LongPollTimeout 单次轮询在没有消息时的最长等待时间
+	LongPollTimeout = 25 * time.Second
+	// LongPollIdleTimeout 会话在该时间内没有任何请求则过期并关闭对应的FireTower
+	LongPollIdleTimeout = 60 * time.Second
+	// LongPollQueueSize 每个会话缓存的下行消息上限 超出时丢弃最旧的消息
+	LongPollQueueSize = 1000
+
+	pollSessions sync.Map // session id -> *pollConn
+)
+
+func loadLongPoll() {
+	LongPollTimeout = time.Duration(configInt("longpoll.Timeout", 25)) * time.Second
+	LongPollIdleTimeout = time.Duration(configInt("longpoll.IdleTimeout", 60)) * time.Second
+	LongPollQueueSize = int(configInt("longpoll.QueueSize", 1000))
+}
+
+// PollResponse 轮询请求的返回内容
+type PollResponse struct {
+	Session  string            `json:"session"`
+	Messages []json.RawMessage `json:"messages"`
+	Dropped  int64             `json:"dropped,omitempty"` // 因队列已满被丢弃的消息数
+	Closed   bool              `json:"closed,omitempty"`  // 会话已经关闭 客户端需要重新建立
+}
+
+// pollConn 将一个长轮询会话适配为FireTower的底层连接
+// 下行消息缓存在queue中 等待客户端下一次轮询取走
+type pollConn struct {
+	id      string
+	tower   *FireTower
+	mu      sync.Mutex
+	queue   [][]byte
+	dropped int64
+	notify  chan struct{}
+	polls   uint64 // 轮询编号 新的轮询会让正在等待的旧轮询立即返回
+	idle    *time.Timer
+	readIn  chan []byte
+	closed  chan struct{}
+	isClose bool
+}
+
+func newPollConn(id string) *pollConn {
+	return &pollConn{
+		id:     id,
+		notify: make(chan struct{}, 1),
+		readIn: make(chan []byte, 16),
+		closed: make(chan struct{}),
+	}
+}
+
+// ReadMessage 读取客户端通过POST提交的消息
+func (c *pollConn) ReadMessage() (int, []byte, error) {
+	select {
+	case data := <-c.readIn:
+		return websocket.TextMessage, data, nil
+	case <-c.closed:
+		return 0, nil, io.EOF
+	}
+}
+
+// WriteMessage 将消息放入会话队列
+func (c *pollConn) WriteMessage(messageType int, data []byte) error {
+	c.mu.Lock()
+	if c.isClose {
+		c.mu.Unlock()
+		return ErrorClose
+	}
+	c.queue = append(c.queue, append([]byte(nil), data...))
+	if LongPollQueueSize > 0 && len(c.queue) > LongPollQueueSize {
+		n := len(c.queue) - LongPollQueueSize
+		c.queue = c.queue[n:]
+		c.dropped += int64(n)
+	}
+	c.mu.Unlock()
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// SetWriteDeadline 写入只是入队 不需要截止时间
+func (c *pollConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// Close 关闭会话 等待中的轮询会立即返回
+func (c *pollConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.isClose {
+		c.isClose = true
+		close(c.closed)
+		if c.idle != nil {
+			c.idle.Stop()
+		}
+		pollSessions.Delete(c.id)
+	}
+	return nil
+}
+
+// touch 每次请求都会重置会话的过期时间
+func (c *pollConn) touch() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.isClose {
+		return
+	}
+	if c.idle != nil {
+		c.idle.Reset(LongPollIdleTimeout)
+		return
+	}
+	c.idle = time.AfterFunc(LongPollIdleTimeout, func() {
+		if c.tower != nil {
+			c.tower.Close()
+		}
+	})
+}
+
+// take 取走当前队列中的全部消息
+func (c *pollConn) take() ([][]byte, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	queue, dropped := c.queue, c.dropped
+	c.queue, c.dropped = nil, 0
+	return queue, dropped
+}
+
+// poll 等待消息到达或超时
+func (c *pollConn) poll(r *http.Request, timeout time.Duration) *PollResponse {
+	seq := atomic.AddUint64(&c.polls, 1)
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		queue, dropped := c.take()
+		if len(queue) > 0 || dropped > 0 {
+			return c.response(queue, dropped)
+		}
+		select {
+		case <-c.notify:
+			if atomic.LoadUint64(&c.polls) != seq {
+				// 同一会话发起了新的轮询 把通知还给新的轮询
+				select {
+				case c.notify <- struct{}{}:
+				default:
+				}
+				return c.response(nil, 0)
+			}
+		case <-c.closed:
+			queue, dropped = c.take()
+			res := c.response(queue, dropped)
+			res.Closed = true
+			return res
+		case <-timer.C:
+			return c.response(nil, 0)
+		case <-r.Context().Done():
+			return nil
+		}
+	}
+}
+
+func (c *pollConn) response(queue [][]byte, dropped int64) *PollResponse {
+	res := &PollResponse{Session: c.id, Messages: make([]json.RawMessage, 0, len(queue)), Dropped: dropped}
+	for _, data := range queue {
+		if !json.Valid(data) {
+			// 心跳等非json内容以字符串形式返回
+			data, _ = json.Marshal(string(data))
+		}
+		res.Messages = append(res.Messages, data)
+	}
+	return res
+}
+
+func writePollResponse(w http.ResponseWriter, status int, res *PollResponse) {
+	b, _ := json.Marshal(res)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+// LongPollHandler 返回一个基于HTTP长轮询的传输入口 语义与websocket连接一致
+//
+// POST 不带session参数时新建会话 返回 {"session":"id"}
+// GET  ?session=id[&timeout=秒] 取走缓存的下行消息 没有消息时最多等待LongPollTimeout
+// POST ?session=id 提交客户端消息 内容与websocket上行消息格式相同(subscribe/unSubscribe/publish等)
+//
+// build 在新会话建立时调用 业务在这里鉴权并设置回调 返回false则拒绝连接
+func LongPollHandler(build func(tower *FireTower, r *http.Request) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Query().Get("session")
+		if r.Method == http.MethodPost && id == "" {
+			createPollSession(w, r, build)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		value, ok := pollSessions.Load(id)
+		if !ok {
+			writePollResponse(w, http.StatusNotFound, &PollResponse{Session: id, Messages: []json.RawMessage{}, Closed: true})
+			return
+		}
+		c := value.(*pollConn)
+		c.touch()
+		if r.Method == http.MethodPost {
+			deliverHTTPMessage(w, r, c.readIn, c.closed)
+			return
+		}
+
+		timeout := LongPollTimeout
+		if v, err := strconv.Atoi(r.URL.Query().Get("timeout")); err == nil && v >= 0 && time.Duration(v)*time.Second < timeout {
+			timeout = time.Duration(v) * time.Second
+		}
+		res := c.poll(r, timeout)
+		if res == nil {
+			return
+		}
+		c.touch()
+		writePollResponse(w, http.StatusOK, res)
+	})
+}
+
+func createPollSession(w http.ResponseWriter, r *http.Request, build func(tower *FireTower, r *http.Request) bool) {
+	if topicManageGrpc == nil {
+		http.Error(w, "gateway is not inited", http.StatusServiceUnavailable)
+		return
+	}
+	c := newPollConn(newSessionId())
+	clientId := r.URL.Query().Get("client_id")
+	if clientId == "" {
+		clientId = c.id
+	}
+	tower := buildNewTower(c, clientId)
+	c.tower = tower
+	if build != nil && !build(tower, r) {
+		// build中可能已经订阅了topic或设置了UserId 关闭以释放订阅关系与限流器
+		tower.Close()
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	pollSessions.Store(c.id, c)
+	c.touch()
+	go tower.Run()
+	writePollResponse(w, http.StatusOK, &PollResponse{Session: c.id, Messages: []json.RawMessage{}})
+}
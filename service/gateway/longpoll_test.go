@@ -0,0 +1,118 @@
+package gateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	json "github.com/json-iterator/go"
+)
+
+func decodePoll(t *testing.T, res *http.Response) *PollResponse {
+	t.Helper()
+	defer res.Body.Close()
+	poll := new(PollResponse)
+	if err := json.NewDecoder(res.Body).Decode(poll); err != nil {
+		t.Fatal(err)
+	}
+	return poll
+}
+
+func TestLongPollSession(t *testing.T) {
+	setupTransportTest(t)
+	RegisterRPCHandler("ping", func(ctx context.Context, fire *FireInfo) (interface{}, error) {
+		return "pong", nil
+	})
+	defer RegisterRPCHandler("ping", nil)
+
+	var tower *FireTower
+	srv := httptest.NewServer(LongPollHandler(func(ft *FireTower, r *http.Request) bool {
+		tower = ft
+		return true
+	}))
+	defer srv.Close()
+
+	res, err := http.Post(srv.URL, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := decodePoll(t, res).Session
+	if session == "" {
+		t.Fatal("expected a session id")
+	}
+
+	// 没有消息时等待到超时并返回空列表
+	start := time.Now()
+	res, err = http.Get(srv.URL + "?timeout=0&session=" + session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if poll := decodePoll(t, res); len(poll.Messages) != 0 || time.Since(start) > time.Second {
+		t.Fatalf("expected an empty poll, got %+v", poll)
+	}
+
+	// 轮询等待期间到达的消息会立即返回
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		http.Post(srv.URL+"?session="+session, "application/json", strings.NewReader(`{"type":"rpc","id":"1","method":"ping"}`))
+	}()
+	res, err = http.Get(srv.URL + "?timeout=5&session=" + session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	poll := decodePoll(t, res)
+	if len(poll.Messages) != 1 || !strings.Contains(string(poll.Messages[0]), `"pong"`) {
+		t.Fatalf("expected the rpc response, got %+v", poll)
+	}
+
+	tower.Close()
+	res, err = http.Get(srv.URL + "?session=" + session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusNotFound || !decodePoll(t, res).Closed {
+		t.Error("closed session should not be found")
+	}
+}
+
+func TestLongPollQueueOverflow(t *testing.T) {
+	LongPollQueueSize = 2
+	defer func() { LongPollQueueSize = 1000 }()
+
+	c := newPollConn("s")
+	for _, m := range []string{`1`, `2`, `heartbeat`} {
+		c.WriteMessage(1, []byte(m))
+	}
+	queue, dropped := c.take()
+	res := c.response(queue, dropped)
+	if res.Dropped != 1 || len(res.Messages) != 2 || string(res.Messages[1]) != `"heartbeat"` {
+		t.Errorf("unexpected response %+v", res)
+	}
+}
+
+func TestLongPollRejectedSession(t *testing.T) {
+	setupTransportTest(t)
+	closed := make(chan struct{})
+	srv := httptest.NewServer(LongPollHandler(func(ft *FireTower, r *http.Request) bool {
+		ft.SetOnOfflineHandler(func() { close(closed) })
+		return false
+	}))
+	defer srv.Close()
+
+	res, err := http.Post(srv.URL, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", res.StatusCode)
+	}
+	select {
+	case <-closed:
+	default:
+		t.Error("rejected tower should be closed")
+	}
+}
@@ -34,10 +34,9 @@ func buildManagerClient() {
 		topicManageGrpc = pb.NewTopicServiceClient(conn)
 		topicManage = socket.NewClient(ConfigTree.Get("topicServiceAddr").(string))
 
-		topicManage.OnPush(func(sendMessage *socket.SendMessage) {
-			TM.centralChan <- sendMessage
-		})
-		
+		topicManage.OnPush(TM.receive)
+		topicManage.OnControl(TM.receive)
+
 		// Reset sleep time for next phase
 		sleepTime = time.Second
 	ConnectTcp:
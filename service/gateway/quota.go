@@ -0,0 +1,149 @@
+package gateway
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"sync/atomic"
+)
+
+// SubscribeQuota 订阅配额与topic命名规则 对应配置文件中的 [subscribe]
+// 数值为0表示不限制 TopicPattern为空表示不校验字符
+type SubscribeQuota struct {
+	MaxTopicsPerConn       int    // 单个连接最多订阅的topic数量
+	MaxSubscribersPerTopic int    // 单个topic在当前gateway上最多的订阅连接数
+	MaxTopicLength         int    // topic名称的最大长度(字节)
+	TopicPattern           string // topic名称需要匹配的正则
+}
+
+// subscribeRules 订阅配额与编译好的topic正则 运行时整体替换
+type subscribeRules struct {
+	quota   SubscribeQuota
+	pattern *regexp.Regexp
+}
+
+// currentQuota 当前生效的订阅配额 在Init时加载 读取方每次只取一次快照
+var currentQuota atomic.Pointer[subscribeRules]
+
+func loadQuota() {
+	quota := SubscribeQuota{
+		MaxTopicsPerConn:       int(configInt("subscribe.MaxTopicsPerConn", 0)),
+		MaxSubscribersPerTopic: int(configInt("subscribe.MaxSubscribersPerTopic", 0)),
+		MaxTopicLength:         int(configInt("subscribe.MaxTopicLength", 0)),
+		TopicPattern:           configString("subscribe.TopicPattern", ""),
+	}
+	if err := SetSubscribeQuota(quota); err != nil {
+		fmt.Println("subscribe quota load failed:", err)
+	}
+}
+
+// SetSubscribeQuota 运行时替换订阅配额
+func SetSubscribeQuota(q SubscribeQuota) error {
+	var re *regexp.Regexp
+	if q.TopicPattern != "" {
+		var err error
+		if re, err = regexp.Compile(q.TopicPattern); err != nil {
+			return err
+		}
+	}
+	currentQuota.Store(&subscribeRules{quota: q, pattern: re})
+	return nil
+}
+
+// GetSubscribeQuota 返回当前生效的订阅配额
+func GetSubscribeQuota() SubscribeQuota {
+	return loadSubscribeRules().quota
+}
+
+func loadSubscribeRules() *subscribeRules {
+	if r := currentQuota.Load(); r != nil {
+		return r
+	}
+	return &subscribeRules{}
+}
+
+// validTopic 校验topic名称是否合法
+func (r *subscribeRules) validTopic(topic string) bool {
+	if topic == "" {
+		return false
+	}
+	if r.quota.MaxTopicLength > 0 && len(topic) > r.quota.MaxTopicLength {
+		return false
+	}
+	if r.pattern != nil && !r.pattern.MatchString(topic) {
+		return false
+	}
+	return true
+}
+
+// quotaLockNum 检查topic订阅数时使用的分段锁数量
+const quotaLockNum = 64
+
+// quotaLock 返回topic对应的分段锁 不同topic的订阅大多落在不同的段上 互不阻塞
+func (t *TowerManager) quotaLock(topic string) *sync.Mutex {
+	h := uint32(2166136261) // fnv-1a
+	for i := 0; i < len(topic); i++ {
+		h ^= uint32(topic[i])
+		h *= 16777619
+	}
+	return &t.quotaMu[h%quotaLockNum]
+}
+
+// TopicSubscribers 当前gateway上订阅了该topic的连接数
+func (t *TowerManager) TopicSubscribers(topic string) int {
+	var num int
+	for _, b := range t.topicBuckets(topic, nil) {
+		b.mu.RLock()
+		num += len(b.topicRelevance[topic])
+		b.mu.RUnlock()
+	}
+	return num
+}
+
+// checkSubscribe 按命名规则过滤客户端请求订阅的topic 并去掉重复的topic
+// 不合法的topic通过错误帧告知客户端 配额在bindTopic添加订阅时检查
+func (t *FireTower) checkSubscribe(topic []string) []string {
+	var (
+		allowed []string
+		invalid []string
+		seen    = make(map[string]bool, len(topic))
+		rules   = loadSubscribeRules()
+	)
+	for _, v := range topic {
+		if seen[v] {
+			continue
+		}
+		seen[v] = true
+		if !rules.validTopic(v) {
+			invalid = append(invalid, v)
+			continue
+		}
+		allowed = append(allowed, v)
+	}
+	if len(invalid) > 0 {
+		t.sendError("", ErrorCodeTopicInvalid, "invalid topic name", invalid)
+	}
+	return allowed
+}
+
+// admitTopic 检查连接能否再订阅一个topic 返回拒绝时的错误码
+// 调用方持有t.topicMu 开启MaxSubscribersPerTopic时还需持有TM.quotaLock(topic) 检查通过后在同一个临界区内添加订阅
+func (t *FireTower) admitTopic(quota SubscribeQuota, topic string) string {
+	if quota.MaxTopicsPerConn > 0 && len(t.topic) >= quota.MaxTopicsPerConn {
+		return ErrorCodeTopicQuota
+	}
+	if quota.MaxSubscribersPerTopic > 0 && TM.TopicSubscribers(topic) >= quota.MaxSubscribersPerTopic {
+		return ErrorCodeTopicFull
+	}
+	return ""
+}
+
+// quotaErrors 通过错误帧告知客户端因配额被拒绝的topic
+func (t *FireTower) quotaErrors(quota SubscribeQuota, rejected map[string][]string) {
+	if topics := rejected[ErrorCodeTopicQuota]; len(topics) > 0 {
+		t.sendError("", ErrorCodeTopicQuota, fmt.Sprintf("too many topics, limit %d per connection", quota.MaxTopicsPerConn), topics)
+	}
+	if topics := rejected[ErrorCodeTopicFull]; len(topics) > 0 {
+		t.sendError("", ErrorCodeTopicFull, "topic subscribers reached the limit", topics)
+	}
+}
@@ -0,0 +1,157 @@
+package gateway
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	json "github.com/json-iterator/go"
+)
+
+func setQuota(t *testing.T, q SubscribeQuota) {
+	t.Helper()
+	if err := SetSubscribeQuota(q); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetSubscribeQuota(SubscribeQuota{}) })
+}
+
+// errorCodes 取出发送队列中错误帧的错误码
+func errorCodes(t *testing.T, tower *FireTower) map[string]bool {
+	t.Helper()
+	codes := make(map[string]bool)
+	for len(tower.sendOut) > 0 {
+		msg := <-tower.sendOut
+		var frame struct {
+			Type string     `json:"type"`
+			Data ErrorFrame `json:"data"`
+		}
+		if err := json.Unmarshal(msg.Data, &frame); err != nil {
+			t.Fatal(err)
+		}
+		codes[frame.Data.Code] = true
+	}
+	return codes
+}
+
+func TestCheckSubscribe(t *testing.T) {
+	setQuota(t, SubscribeQuota{MaxTopicLength: 8, TopicPattern: `^[a-z0-9_]+$`})
+	tower := newMockTower("c1", 10)
+	allowed := tower.checkSubscribe([]string{"old", "Bad!", "too_long_topic", "a", "a"})
+	if fmt.Sprint(allowed) != "[old a]" {
+		t.Fatalf("unexpected allowed topics: %v", allowed)
+	}
+	if codes := errorCodes(t, tower); len(codes) != 1 || !codes[ErrorCodeTopicInvalid] {
+		t.Errorf("expected a single invalid topic error, got %v", codes)
+	}
+}
+
+func TestSubscribeQuota(t *testing.T) {
+	setupSubscribeTest(t)
+	setQuota(t, SubscribeQuota{MaxTopicsPerConn: 2, MaxSubscribersPerTopic: 1})
+	TM.bucket[0].AddSubscribe("full", newMockTower("other", 1))
+
+	tower := newMockTower("c1", 10)
+	if _, err := tower.bindTopic([]string{"old"}); err != nil {
+		t.Fatal(err)
+	}
+	added, err := tower.bindTopic([]string{"old", "full", "a", "b"})
+	if err != nil || fmt.Sprint(added) != "[a]" {
+		t.Fatalf("unexpected added topics: %v %v", added, err)
+	}
+	codes := errorCodes(t, tower)
+	for _, code := range []string{ErrorCodeTopicQuota, ErrorCodeTopicFull} {
+		if !codes[code] {
+			t.Errorf("expected an error frame with code %s", code)
+		}
+	}
+}
+
+// TestSubscribeQuotaConcurrent 并发订阅同一个topic时 订阅数不能超过配额
+func TestSubscribeQuotaConcurrent(t *testing.T) {
+	setupSubscribeTest(t)
+	setQuota(t, SubscribeQuota{MaxTopicsPerConn: 3, MaxSubscribersPerTopic: 5})
+
+	var wg sync.WaitGroup
+	one := newMockTower("one", 64)
+	for i := 0; i < 20; i++ {
+		tower := newMockTower(fmt.Sprintf("c%d", i), 64)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			tower.bindTopic([]string{"room_1"})
+		}()
+		go func(topic string) {
+			defer wg.Done()
+			one.bindTopic([]string{topic})
+		}(fmt.Sprintf("topic_%d", i))
+	}
+	wg.Wait()
+	if n := TM.TopicSubscribers("room_1"); n != 5 {
+		t.Errorf("expected 5 subscribers, got %d", n)
+	}
+	if n := len(one.Topics()); n != 3 {
+		t.Errorf("expected 3 topics on one connection, got %d", n)
+	}
+}
+
+// TestSetSubscribeQuotaConcurrent 运行时替换配额时 正在校验的订阅请求读取的是完整的快照
+func TestSetSubscribeQuotaConcurrent(t *testing.T) {
+	setQuota(t, SubscribeQuota{})
+	tower := newMockTower("c1", 1024)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 500; i++ {
+			tower.checkSubscribe([]string{"room_1"})
+		}
+	}()
+	for i := 0; i < 500; i++ {
+		SetSubscribeQuota(SubscribeQuota{MaxTopicLength: 8 + i%2, TopicPattern: `^[a-z0-9_]+$`})
+	}
+	<-done
+	if q := GetSubscribeQuota(); q.MaxTopicLength != 9 || q.TopicPattern != `^[a-z0-9_]+$` {
+		t.Errorf("unexpected quota %+v", q)
+	}
+}
+
+// TestSubscribeQuotaLockPerTopic 某个topic的配额检查被阻塞时 其他topic的订阅不受影响
+func TestSubscribeQuotaLockPerTopic(t *testing.T) {
+	setupSubscribeTest(t)
+	setQuota(t, SubscribeQuota{MaxSubscribersPerTopic: 5})
+
+	other := "room_2"
+	for i := 3; TM.quotaLock(other) == TM.quotaLock("room_1"); i++ {
+		other = fmt.Sprintf("room_%d", i)
+	}
+	first, second := newMockTower("c1", 10), newMockTower("c2", 10)
+	mu := TM.quotaLock("room_1")
+	mu.Lock()
+	blocked := make(chan struct{})
+	go func() {
+		defer close(blocked)
+		first.bindTopic([]string{"room_1"})
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		second.bindTopic([]string{other})
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("subscribing another topic should not wait for room_1")
+	}
+	select {
+	case <-blocked:
+		t.Fatal("room_1 should wait for its quota lock")
+	default:
+	}
+	mu.Unlock()
+	<-blocked
+	if n := TM.TopicSubscribers("room_1"); n != 1 {
+		t.Errorf("expected 1 subscriber on room_1, got %d", n)
+	}
+}
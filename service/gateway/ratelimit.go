@@ -0,0 +1,286 @@
+package gateway
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// RateLimitPublish 客户端推送(非订阅类)消息的限流维度
+	RateLimitPublish = "publish"
+	// RateLimitSubscribe 订阅/取消订阅消息的限流维度
+	RateLimitSubscribe = "subscribe"
+	// RateLimitBytes 客户端上行字节数的限流维度
+	RateLimitBytes = "bytes"
+
+	// RateLimitScopeConn 单连接维度的限流
+	RateLimitScopeConn = "conn"
+	// RateLimitScopeUser 同一UserId所有连接共享的限流
+	RateLimitScopeUser = "user"
+
+	// RateLimitDrop 丢弃超限消息并向客户端返回错误帧
+	RateLimitDrop = "drop"
+	// RateLimitThrottle 暂停读取直到令牌足够 依靠tcp背压减缓客户端
+	RateLimitThrottle = "throttle"
+	// RateLimitDisconnect 以 policy violation(1008) 关闭连接
+	RateLimitDisconnect = "disconnect"
+)
+
+// RateLimitConfig 限流配置
+// Rate为每秒补充的令牌数 Burst为令牌桶容量 Rate为0表示不限制该维度
+type RateLimitConfig struct {
+	PublishRate    float64
+	PublishBurst   float64
+	SubscribeRate  float64
+	SubscribeBurst float64
+	BytesRate      float64
+	BytesBurst     float64
+}
+
+var (
+	// RateLimitAction 触发限流后的处理方式 drop | throttle | disconnect
+	RateLimitAction = RateLimitDrop
+	// ConnRateLimit 单连接限流配置 在Init时从配置文件 [ratelimit.conn] 加载
+	ConnRateLimit RateLimitConfig
+	// UserRateLimit 单用户限流配置 在Init时从配置文件 [ratelimit.user] 加载
+	UserRateLimit RateLimitConfig
+
+	userLimiters   = make(map[string]*userLimiter)
+	userLimitersMu sync.Mutex
+)
+
+func loadRateLimit() {
+	RateLimitAction = configString("ratelimit.Action", RateLimitDrop)
+	ConnRateLimit = readRateLimitConfig("ratelimit.conn")
+	UserRateLimit = readRateLimitConfig("ratelimit.user")
+}
+
+func readRateLimitConfig(prefix string) RateLimitConfig {
+	return RateLimitConfig{
+		PublishRate:    configFloat(prefix+".PublishRate", 0),
+		PublishBurst:   configFloat(prefix+".PublishBurst", 0),
+		SubscribeRate:  configFloat(prefix+".SubscribeRate", 0),
+		SubscribeBurst: configFloat(prefix+".SubscribeBurst", 0),
+		BytesRate:      configFloat(prefix+".BytesRate", 0),
+		BytesBurst:     configFloat(prefix+".BytesBurst", 0),
+	}
+}
+
+// tokenBucket 令牌桶
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate, burst float64) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = rate
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+// allow 令牌足够时扣除并返回true 不足时不扣除
+// 单次消耗超过桶容量时按桶容量计算 避免超大消息永远无法通过
+func (b *tokenBucket) allow(n float64) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if n > b.burst {
+		n = b.burst
+	}
+	b.refill(time.Now())
+	if b.tokens < n {
+		return false
+	}
+	b.tokens -= n
+	return true
+}
+
+// refund 退回allow扣除的令牌 不超过桶容量
+func (b *tokenBucket) refund(n float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if n > b.burst {
+		n = b.burst
+	}
+	if b.tokens += n; b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// reserve 无条件扣除令牌(允许透支) 返回需要等待多久才能还清
+func (b *tokenBucket) reserve(n float64) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if n > b.burst {
+		n = b.burst
+	}
+	b.refill(time.Now())
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// readLimiter 一组按维度划分的令牌桶
+type readLimiter struct {
+	publish   *tokenBucket
+	subscribe *tokenBucket
+	bytes     *tokenBucket
+}
+
+func newReadLimiter(c RateLimitConfig) *readLimiter {
+	l := &readLimiter{
+		publish:   newTokenBucket(c.PublishRate, c.PublishBurst),
+		subscribe: newTokenBucket(c.SubscribeRate, c.SubscribeBurst),
+		bytes:     newTokenBucket(c.BytesRate, c.BytesBurst),
+	}
+	if l.publish == nil && l.subscribe == nil && l.bytes == nil {
+		return nil
+	}
+	return l
+}
+
+func (l *readLimiter) bucket(kind string) *tokenBucket {
+	if l == nil {
+		return nil
+	}
+	switch kind {
+	case RateLimitPublish:
+		return l.publish
+	case RateLimitSubscribe:
+		return l.subscribe
+	case RateLimitBytes:
+		return l.bytes
+	}
+	return nil
+}
+
+type userLimiter struct {
+	refs    int
+	limiter *readLimiter
+}
+
+// acquireUserLimiter 获取某个用户共享的限流器 引用计数为0时回收
+func acquireUserLimiter(userId string) *readLimiter {
+	userLimitersMu.Lock()
+	defer userLimitersMu.Unlock()
+	u, ok := userLimiters[userId]
+	if !ok {
+		l := newReadLimiter(UserRateLimit)
+		if l == nil {
+			return nil
+		}
+		u = &userLimiter{limiter: l}
+		userLimiters[userId] = u
+	}
+	u.refs++
+	return u.limiter
+}
+
+func releaseUserLimiter(userId string) {
+	userLimitersMu.Lock()
+	defer userLimitersMu.Unlock()
+	if u, ok := userLimiters[userId]; ok {
+		u.refs--
+		if u.refs <= 0 {
+			delete(userLimiters, userId)
+		}
+	}
+}
+
+// limiters 返回当前连接需要检查的连接级与用户级限流器
+// UserId 通常在BuildTower之后才由业务设置 所以用户级限流器在第一次检查时才绑定
+func (t *FireTower) limiters() (conn, user *readLimiter) {
+	t.limitMu.Lock()
+	defer t.limitMu.Unlock()
+	if t.limitUser == "" && t.UserId != "" && !t.closed() {
+		t.limitUser = t.UserId
+		t.userLimiter = acquireUserLimiter(t.UserId)
+	}
+	return t.connLimiter, t.userLimiter
+}
+
+func (t *FireTower) releaseLimiters() {
+	t.limitMu.Lock()
+	defer t.limitMu.Unlock()
+	if t.limitUser != "" {
+		releaseUserLimiter(t.limitUser)
+		t.limitUser = ""
+		t.userLimiter = nil
+	}
+}
+
+// limitRead 对客户端上行消息做限流检查
+// 返回false表示该消息不应继续处理
+func (t *FireTower) limitRead(fire *FireInfo, kind string, n int) bool {
+	conn, user := t.limiters()
+	if conn == nil && user == nil {
+		return true
+	}
+	cost := float64(n)
+	scope := ""
+	connBucket, userBucket := conn.bucket(kind), user.bucket(kind)
+	if connBucket != nil && !connBucket.allow(cost) {
+		scope = RateLimitScopeConn
+	} else if userBucket != nil && !userBucket.allow(cost) {
+		scope = RateLimitScopeUser
+		if connBucket != nil && RateLimitAction != RateLimitThrottle {
+			// 被用户级限流拒绝的消息不会被处理 退回已经扣除的连接级令牌
+			connBucket.refund(cost)
+		}
+	}
+	if scope == "" {
+		return true
+	}
+
+	if t.rateLimitHandler != nil {
+		t.rateLimitHandler(fire, kind, scope)
+	}
+	switch RateLimitAction {
+	case RateLimitThrottle:
+		var wait time.Duration
+		if scope == RateLimitScopeConn {
+			wait = connBucket.reserve(cost)
+		} else {
+			wait = userBucket.reserve(cost)
+		}
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			return true
+		case <-t.closeChan:
+			return false
+		}
+	case RateLimitDisconnect:
+		fire.Error("rate limit exceeded, disconnect: " + kind)
+		t.closeWithCode(websocket.ClosePolicyViolation, "rate limit exceeded")
+		return false
+	default:
+		fire.Error("rate limit exceeded, drop: " + kind)
+		t.sendError(fire.Message.Topic, ErrorCodeRateLimited, kind+" rate limit exceeded", nil)
+		return false
+	}
+}
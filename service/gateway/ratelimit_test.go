@@ -0,0 +1,131 @@
+package gateway
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketAllow(t *testing.T) {
+	b := newTokenBucket(10, 3)
+	for i := 0; i < 3; i++ {
+		if !b.allow(1) {
+			t.Fatalf("allow #%d should pass within burst", i)
+		}
+	}
+	if b.allow(1) {
+		t.Error("allow should fail once burst is exhausted")
+	}
+
+	b.last = b.last.Add(-200 * time.Millisecond) // 模拟过去200ms 补充2个令牌
+	if !b.allow(2) {
+		t.Error("allow should pass after refill")
+	}
+
+	if newTokenBucket(0, 10) != nil {
+		t.Error("zero rate should disable the bucket")
+	}
+}
+
+func TestTokenBucketReserve(t *testing.T) {
+	b := newTokenBucket(10, 1)
+	if wait := b.reserve(1); wait != 0 {
+		t.Errorf("first reserve should not wait, got %v", wait)
+	}
+	wait := b.reserve(1)
+	if wait < 90*time.Millisecond || wait > 110*time.Millisecond {
+		t.Errorf("second reserve should wait about 100ms, got %v", wait)
+	}
+}
+
+func TestLimitReadDrop(t *testing.T) {
+	FireLogger = fireLog
+	DefaultErrorWriter = io.Discard
+	RateLimitAction = RateLimitDrop
+	ConnRateLimit = RateLimitConfig{PublishRate: 1, PublishBurst: 1}
+	defer func() { ConnRateLimit = RateLimitConfig{} }()
+
+	tower := newMockTower("c1", 10)
+	tower.connLimiter = newReadLimiter(ConnRateLimit)
+	var hits []string
+	tower.SetRateLimitHandler(func(fire *FireInfo, kind, scope string) {
+		hits = append(hits, kind+"/"+scope)
+	})
+	fire := &FireInfo{Context: new(FireLife), Message: &TopicMessage{Topic: "t"}}
+
+	if !tower.limitRead(fire, RateLimitPublish, 1) {
+		t.Fatal("first publish should pass")
+	}
+	if tower.limitRead(fire, RateLimitPublish, 1) {
+		t.Fatal("second publish should be dropped")
+	}
+	if len(hits) != 1 || hits[0] != "publish/conn" {
+		t.Errorf("unexpected rate limit callbacks: %v", hits)
+	}
+	select {
+	case msg := <-tower.sendOut:
+		if string(msg.Data) == "" {
+			t.Error("error frame should not be empty")
+		}
+	default:
+		t.Error("expected an error frame in sendOut")
+	}
+	if !tower.limitRead(fire, RateLimitSubscribe, 1) {
+		t.Error("subscribe is not limited and should pass")
+	}
+}
+
+func TestUserLimiterShared(t *testing.T) {
+	UserRateLimit = RateLimitConfig{SubscribeRate: 1, SubscribeBurst: 1}
+	defer func() { UserRateLimit = RateLimitConfig{} }()
+
+	a := acquireUserLimiter("u1")
+	b := acquireUserLimiter("u1")
+	if a == nil || a != b {
+		t.Fatal("connections of the same user should share one limiter")
+	}
+	releaseUserLimiter("u1")
+	releaseUserLimiter("u1")
+	if _, ok := userLimiters["u1"]; ok {
+		t.Error("user limiter should be released when no connection references it")
+	}
+}
+
+// TestLimitReadUserRefund 被用户级限流丢弃的消息不占用连接级的令牌
+func TestLimitReadUserRefund(t *testing.T) {
+	FireLogger = fireLog
+	DefaultErrorWriter = io.Discard
+	RateLimitAction = RateLimitDrop
+
+	tower := newMockTower("c1", 10)
+	tower.connLimiter = newReadLimiter(RateLimitConfig{PublishRate: 1, PublishBurst: 2})
+	tower.userLimiter = newReadLimiter(RateLimitConfig{PublishRate: 1, PublishBurst: 1})
+	tower.limitUser = "u1"
+	var hits []string
+	tower.SetRateLimitHandler(func(fire *FireInfo, kind, scope string) {
+		hits = append(hits, kind+"/"+scope)
+	})
+	fire := &FireInfo{Context: new(FireLife), Message: &TopicMessage{Topic: "t"}}
+
+	if !tower.limitRead(fire, RateLimitPublish, 1) {
+		t.Fatal("first publish should pass")
+	}
+	if tower.limitRead(fire, RateLimitPublish, 1) {
+		t.Fatal("second publish should be dropped by the user limiter")
+	}
+	if len(hits) != 1 || hits[0] != "publish/user" {
+		t.Errorf("unexpected rate limit callbacks: %v", hits)
+	}
+	if b := tower.connLimiter.publish; b.tokens < 0.99 {
+		t.Errorf("connection tokens should be refunded, got %v", b.tokens)
+	}
+}
+
+func TestTokenBucketRefund(t *testing.T) {
+	b := newTokenBucket(1, 2)
+	b.allow(2)
+	b.refund(5)
+	if b.tokens != 2 {
+		t.Errorf("refund should not exceed the burst, got %v", b.tokens)
+	}
+}
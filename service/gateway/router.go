@@ -0,0 +1,266 @@
+package gateway
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/OSMeteor/firetower/socket"
+)
+
+// MessageHandler 处理一条客户端消息
+// 返回false表示需要关闭当前连接(与ReadHandler的语义一致)
+type MessageHandler func(fire *FireInfo) bool
+
+// InboundMiddleware 客户端消息的中间件 类似grpc的拦截器
+// 调用next把消息交给下一层处理 不调用next并返回true即表示丢弃该消息
+type InboundMiddleware func(fire *FireInfo, next MessageHandler) bool
+
+// SendHandler 向客户端写出一条消息
+type SendHandler func(message *socket.SendMessage) error
+
+// OutboundMiddleware 包裹Send的中间件 可以用来做改写、过滤或统计
+// Bucket把同一条推送交给所有订阅的连接 中间件拿到的message是当前连接的浅拷贝
+// 改写时替换message的字段(例如重新赋值Data) 不要原地修改Data的内容
+type OutboundMiddleware func(message *socket.SendMessage, next SendHandler) error
+
+var (
+	routerMu     sync.RWMutex
+	typeHandlers = make(map[string]MessageHandler)
+	inbound      []InboundMiddleware
+	outbound     []OutboundMiddleware
+	// middlewareVersion 全局中间件每次变更后加一 连接据此判断缓存的中间件链是否需要重建
+	middlewareVersion uint64
+)
+
+// RegisterTypeHandler 注册gateway全局的消息类型处理函数
+// subscribe、unSubscribe与rpc为内置类型 不能被覆盖
+func RegisterTypeHandler(msgType string, fn MessageHandler) {
+	routerMu.Lock()
+	defer routerMu.Unlock()
+	if fn == nil {
+		delete(typeHandlers, msgType)
+		return
+	}
+	typeHandlers[msgType] = fn
+}
+
+// UseInbound 追加gateway全局的入站中间件 先注册的在外层
+func UseInbound(mw ...InboundMiddleware) {
+	routerMu.Lock()
+	defer routerMu.Unlock()
+	inbound = append(inbound, mw...)
+	atomic.AddUint64(&middlewareVersion, 1)
+}
+
+// UseOutbound 追加gateway全局的出站中间件 先注册的在外层
+func UseOutbound(mw ...OutboundMiddleware) {
+	routerMu.Lock()
+	defer routerMu.Unlock()
+	outbound = append(outbound, mw...)
+	atomic.AddUint64(&middlewareVersion, 1)
+}
+
+// towerRouter 连接自己的消息路由与中间件 读循环与写循环会并发读取 修改时加锁
+// 包裹好的中间件链在第一次使用时构建 之后只在连接或全局的中间件变更时重建
+type towerRouter struct {
+	mu           sync.RWMutex
+	typeHandlers map[string]MessageHandler // 当前连接注册的消息类型处理函数
+	inbound      []InboundMiddleware       // 当前连接的入站中间件
+	outbound     []OutboundMiddleware      // 当前连接的出站中间件
+
+	inChain    MessageHandler // 已经包裹好的入站处理链 为nil时需要重建
+	inVersion  uint64         // 构建inChain时的middlewareVersion
+	outChain   SendHandler    // 已经包裹好的出站发送链 为nil时需要重建
+	outVersion uint64         // 构建outChain时的middlewareVersion
+}
+
+// SetTypeHandler 注册只对当前连接生效的消息类型处理函数 优先于全局注册
+func (t *FireTower) SetTypeHandler(msgType string, fn MessageHandler) {
+	t.router.mu.Lock()
+	defer t.router.mu.Unlock()
+	if t.router.typeHandlers == nil {
+		t.router.typeHandlers = make(map[string]MessageHandler)
+	}
+	if fn == nil {
+		delete(t.router.typeHandlers, msgType)
+		return
+	}
+	t.router.typeHandlers[msgType] = fn
+}
+
+// UseInbound 追加当前连接的入站中间件 位于全局中间件之内
+func (t *FireTower) UseInbound(mw ...InboundMiddleware) {
+	t.router.mu.Lock()
+	defer t.router.mu.Unlock()
+	t.router.inbound = append(t.router.inbound, mw...)
+	t.router.inChain = nil
+}
+
+// UseOutbound 追加当前连接的出站中间件 位于全局中间件之内
+func (t *FireTower) UseOutbound(mw ...OutboundMiddleware) {
+	t.router.mu.Lock()
+	defer t.router.mu.Unlock()
+	t.router.outbound = append(t.router.outbound, mw...)
+	t.router.outChain = nil
+}
+
+// dispatch 让消息依次经过入站中间件后交给路由处理
+func (t *FireTower) dispatch(fire *FireInfo) bool {
+	return t.inboundChain()(fire)
+}
+
+// inboundChain 返回经过入站中间件包裹后的处理函数
+func (t *FireTower) inboundChain() MessageHandler {
+	version := atomic.LoadUint64(&middlewareVersion)
+	t.router.mu.RLock()
+	handler := t.router.inChain
+	ok := handler != nil && t.router.inVersion == version
+	t.router.mu.RUnlock()
+	if ok {
+		return handler
+	}
+
+	routerMu.RLock()
+	global := inbound
+	version = atomic.LoadUint64(&middlewareVersion)
+	routerMu.RUnlock()
+	t.router.mu.Lock()
+	defer t.router.mu.Unlock()
+	handler = t.route
+	for i := len(t.router.inbound) - 1; i >= 0; i-- {
+		handler = wrapInbound(t.router.inbound[i], handler)
+	}
+	for i := len(global) - 1; i >= 0; i-- {
+		handler = wrapInbound(global[i], handler)
+	}
+	t.router.inChain, t.router.inVersion = handler, version
+	return handler
+}
+
+func wrapInbound(mw InboundMiddleware, next MessageHandler) MessageHandler {
+	return func(fire *FireInfo) bool {
+		return mw(fire, next)
+	}
+}
+
+// route 按消息类型分发
+func (t *FireTower) route(fire *FireInfo) bool {
+	switch fire.Message.Type {
+	case RPCKey:
+		// rpc调用不依赖topic 结果只写回调用方
+		t.handleRPC(fire)
+		return true
+	case "subscribe": // 客户端订阅topic
+		return t.handleSubscribe(fire)
+	case "unSubscribe": // 客户端取消订阅topic
+		return t.handleUnSubscribe(fire)
+	}
+
+	t.router.mu.RLock()
+	fn, ok := t.router.typeHandlers[fire.Message.Type]
+	t.router.mu.RUnlock()
+	if !ok {
+		routerMu.RLock()
+		fn, ok = typeHandlers[fire.Message.Type]
+		routerMu.RUnlock()
+	}
+	if ok {
+		return fn(fire)
+	}
+
+	if fire.Message.Topic == "" {
+		fire.Panic(fmt.Sprintf("%s:topic is empty, ClintId:%s, UserId:%s", fire.Message.Type, t.ClientId, t.UserId))
+		return true
+	}
+	if t.readHandler != nil {
+		return t.readHandler(fire)
+	}
+	return true
+}
+
+func (t *FireTower) handleSubscribe(fire *FireInfo) bool {
+	if fire.Message.Topic == "" {
+		fire.Panic(fmt.Sprintf("%s:topic is empty, ClintId:%s, UserId:%s", fire.Message.Type, t.ClientId, t.UserId))
+		return true
+	}
+	addTopic := strings.Split(fire.Message.Topic, ",")
+	// 如果设置了订阅前触发事件则调用
+	if t.beforeSubscribeHandler != nil {
+		var ok bool
+		addTopic, ok = t.beforeSubscribeHandler(fire.Context, addTopic)
+		if !ok {
+			return true
+		}
+	}
+	// 按命名规则过滤 配额在bindTopic中检查 被拒绝的topic会通过错误帧告知客户端
+	addTopic = t.checkSubscribe(addTopic)
+	// 增加messageId 方便追踪
+	addTopic, err := t.bindTopic(addTopic)
+	if err != nil {
+		fire.Error(err.Error())
+	} else if t.subscribeHandler != nil {
+		t.subscribeHandler(fire.Context, addTopic)
+	}
+	return true
+}
+
+func (t *FireTower) handleUnSubscribe(fire *FireInfo) bool {
+	if fire.Message.Topic == "" {
+		fire.Panic(fmt.Sprintf("%s:topic is empty, ClintId:%s, UserId:%s", fire.Message.Type, t.ClientId, t.UserId))
+		return true
+	}
+	delTopic, err := t.unbindTopic(strings.Split(fire.Message.Topic, ","))
+	if err != nil {
+		fire.Error(err.Error())
+	} else if t.unSubscribeHandler != nil {
+		t.unSubscribeHandler(fire.Context, delTopic)
+	}
+	return true
+}
+
+// outboundChain 返回经过出站中间件包裹后的发送函数
+func (t *FireTower) outboundChain() SendHandler {
+	version := atomic.LoadUint64(&middlewareVersion)
+	t.router.mu.RLock()
+	handler := t.router.outChain
+	ok := handler != nil && t.router.outVersion == version
+	t.router.mu.RUnlock()
+	if ok {
+		return handler
+	}
+
+	routerMu.RLock()
+	global := outbound
+	version = atomic.LoadUint64(&middlewareVersion)
+	routerMu.RUnlock()
+	t.router.mu.Lock()
+	defer t.router.mu.Unlock()
+	handler = t.send
+	for i := len(t.router.outbound) - 1; i >= 0; i-- {
+		handler = wrapOutbound(t.router.outbound[i], handler)
+	}
+	for i := len(global) - 1; i >= 0; i-- {
+		handler = wrapOutbound(global[i], handler)
+	}
+	if len(global)+len(t.router.outbound) > 0 {
+		handler = cloneOutbound(handler)
+	}
+	t.router.outChain, t.router.outVersion = handler, version
+	return handler
+}
+
+// cloneOutbound 出站中间件链处理的是消息的浅拷贝 改写不会影响共享同一条消息的其他连接
+func cloneOutbound(next SendHandler) SendHandler {
+	return func(message *socket.SendMessage) error {
+		clone := *message
+		return next(&clone)
+	}
+}
+
+func wrapOutbound(mw OutboundMiddleware, next SendHandler) SendHandler {
+	return func(message *socket.SendMessage) error {
+		return mw(message, next)
+	}
+}
@@ -0,0 +1,154 @@
+package gateway
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/OSMeteor/firetower/socket"
+)
+
+// resetMiddleware 清除全局中间件
+func resetMiddleware() {
+	routerMu.Lock()
+	defer routerMu.Unlock()
+	inbound, outbound = nil, nil
+	atomic.AddUint64(&middlewareVersion, 1)
+}
+
+func TestDispatchMiddlewareOrder(t *testing.T) {
+	var trace []string
+	UseInbound(func(fire *FireInfo, next MessageHandler) bool {
+		trace = append(trace, "global")
+		return next(fire)
+	})
+	defer resetMiddleware()
+	RegisterTypeHandler("typing", func(fire *FireInfo) bool {
+		trace = append(trace, "global-typing")
+		return true
+	})
+	defer RegisterTypeHandler("typing", nil)
+
+	tower := newMockTower("c1", 10)
+	tower.UseInbound(func(fire *FireInfo, next MessageHandler) bool {
+		trace = append(trace, "tower")
+		if fire.Message.Type == "blocked" {
+			return true
+		}
+		return next(fire)
+	})
+	tower.SetTypeHandler("read_receipt", func(fire *FireInfo) bool {
+		trace = append(trace, "read_receipt")
+		return false
+	})
+
+	if !tower.dispatch(&FireInfo{Message: &TopicMessage{Type: "typing"}}) {
+		t.Error("typing handler should return true")
+	}
+	if tower.dispatch(&FireInfo{Message: &TopicMessage{Type: "read_receipt"}}) {
+		t.Error("read_receipt handler should return false")
+	}
+	tower.dispatch(&FireInfo{Message: &TopicMessage{Type: "blocked"}})
+
+	want := []string{"global", "tower", "global-typing", "global", "tower", "read_receipt", "global", "tower"}
+	if len(trace) != len(want) {
+		t.Fatalf("trace = %v, want %v", trace, want)
+	}
+	for i := range want {
+		if trace[i] != want[i] {
+			t.Fatalf("trace = %v, want %v", trace, want)
+		}
+	}
+}
+
+func TestSendOutboundMiddleware(t *testing.T) {
+	tower := newMockTower("c1", 10)
+	tower.UseOutbound(func(message *socket.SendMessage, next SendHandler) error {
+		if message.Topic == "secret" {
+			return errors.New("filtered")
+		}
+		message.Data = append([]byte("wrapped:"), message.Data...)
+		return next(message)
+	})
+
+	if err := tower.Send(&socket.SendMessage{Topic: "secret", Data: []byte("x")}); err == nil {
+		t.Error("expected the middleware to filter the message")
+	}
+	if err := tower.Send(&socket.SendMessage{Topic: "news", Data: []byte("x")}); err != nil {
+		t.Fatal(err)
+	}
+	if msg := <-tower.sendOut; string(msg.Data) != "wrapped:x" {
+		t.Errorf("unexpected data %q", msg.Data)
+	}
+	if len(tower.sendOut) != 0 {
+		t.Error("filtered message should not be queued")
+	}
+}
+
+// TestMiddlewareChainCache 中间件链只在中间件变更时重建 变更与收发消息可以并发
+func TestMiddlewareChainCache(t *testing.T) {
+	defer resetMiddleware()
+	tower := newMockTower("c1", 1024)
+	var calls int64
+	count := func(message *socket.SendMessage, next SendHandler) error {
+		atomic.AddInt64(&calls, 1)
+		return next(message)
+	}
+	tower.UseOutbound(count)
+	tower.Send(&socket.SendMessage{Topic: "news"})
+	if tower.router.outChain == nil || tower.router.outVersion != atomic.LoadUint64(&middlewareVersion) {
+		t.Error("outbound chain should be built once and cached")
+	}
+	UseOutbound(count)
+	if tower.Send(&socket.SendMessage{Topic: "news"}); atomic.LoadInt64(&calls) != 3 {
+		t.Errorf("global middleware should apply to a cached chain, got %d calls", calls)
+	}
+
+	typing := func(fire *FireInfo) bool { return true }
+	tower.SetTypeHandler("typing", typing)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				tower.Send(&socket.SendMessage{Topic: "news"})
+				tower.dispatch(&FireInfo{Message: &TopicMessage{Type: "typing"}})
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			tower.SetTypeHandler("typing", typing)
+			tower.UseInbound(func(fire *FireInfo, next MessageHandler) bool { return next(fire) })
+			tower.UseOutbound(count)
+		}()
+	}
+	wg.Wait()
+}
+
+// TestOutboundRewriteIsolated 同一条推送发给多个连接时 一个连接的出站改写不影响其他连接
+func TestOutboundRewriteIsolated(t *testing.T) {
+	rewritten, plain := newMockTower("c1", 10), newMockTower("c2", 10)
+	rewritten.UseOutbound(func(message *socket.SendMessage, next SendHandler) error {
+		message.Data = []byte("rewritten")
+		message.Topic = "private"
+		return next(message)
+	})
+
+	message := &socket.SendMessage{Topic: "news", Data: []byte("x")}
+	for _, tower := range []*FireTower{rewritten, plain} {
+		if err := tower.Send(message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if msg := <-rewritten.sendOut; string(msg.Data) != "rewritten" || msg.Topic != "private" {
+		t.Errorf("rewrite should apply to its own connection, got %s %q", msg.Topic, msg.Data)
+	}
+	if msg := <-plain.sendOut; string(msg.Data) != "x" || msg.Topic != "news" {
+		t.Errorf("rewrite leaked to another connection, got %s %q", msg.Topic, msg.Data)
+	}
+	if string(message.Data) != "x" {
+		t.Errorf("shared message should not be modified, got %q", message.Data)
+	}
+}
@@ -0,0 +1,184 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/OSMeteor/firetower/socket"
+
+	"github.com/gorilla/websocket"
+	json "github.com/json-iterator/go"
+)
+
+// RPCKey 客户端发起请求/响应调用时使用的消息类型
+const RPCKey = "rpc"
+
+// RPCHandler rpc方法的处理函数
+// 返回值会被json序列化后带上相同的请求id写回调用方 ctx在调用超时或连接关闭时取消
+type RPCHandler func(ctx context.Context, fire *FireInfo) (interface{}, error)
+
+// RPCError 可以由RPCHandler返回 用来指定写回客户端的错误code
+type RPCError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// RPCResponse 写回客户端的rpc响应帧
+type RPCResponse struct {
+	Type   string      `json:"type"`
+	Id     string      `json:"id"`
+	Method string      `json:"method"`
+	Data   interface{} `json:"data,omitempty"`
+	Error  *RPCError   `json:"error,omitempty"`
+}
+
+var (
+	// RPCTimeout 单次rpc调用的超时时间 在Init时从配置 rpc.Timeout(毫秒) 加载
+	RPCTimeout = 5 * time.Second
+	// RPCMaxConcurrent 单个连接同时执行中的rpc调用上限
+	RPCMaxConcurrent = 16
+	// RPCMaxAbandoned 单个连接已超时但处理函数还未返回的rpc调用上限
+	// 调用超时后并发名额转到这里计数 该计数满时超时的调用继续占用并发名额直到处理函数返回
+	RPCMaxAbandoned = 16
+
+	rpcHandlers   = make(map[string]RPCHandler)
+	rpcHandlersMu sync.RWMutex
+)
+
+func loadRPC() {
+	RPCTimeout = time.Duration(configInt("rpc.Timeout", 5000)) * time.Millisecond
+	RPCMaxConcurrent = int(configInt("rpc.MaxConcurrent", 16))
+	RPCMaxAbandoned = int(configInt("rpc.MaxAbandoned", 16))
+}
+
+// RegisterRPCHandler 注册gateway全局的rpc方法 所有连接都可以调用
+func RegisterRPCHandler(method string, fn RPCHandler) {
+	rpcHandlersMu.Lock()
+	defer rpcHandlersMu.Unlock()
+	if fn == nil {
+		delete(rpcHandlers, method)
+		return
+	}
+	rpcHandlers[method] = fn
+}
+
+// SetRPCHandler 注册只对当前连接生效的rpc方法 优先于全局注册的同名方法
+func (t *FireTower) SetRPCHandler(method string, fn RPCHandler) {
+	t.rpcMu.Lock()
+	defer t.rpcMu.Unlock()
+	if t.rpcHandlers == nil {
+		t.rpcHandlers = make(map[string]RPCHandler)
+	}
+	if fn == nil {
+		delete(t.rpcHandlers, method)
+		return
+	}
+	t.rpcHandlers[method] = fn
+}
+
+func (t *FireTower) rpcHandler(method string) RPCHandler {
+	t.rpcMu.Lock()
+	fn, ok := t.rpcHandlers[method]
+	t.rpcMu.Unlock()
+	if ok {
+		return fn
+	}
+	rpcHandlersMu.RLock()
+	defer rpcHandlersMu.RUnlock()
+	return rpcHandlers[method]
+}
+
+// handleRPC 处理客户端的rpc请求
+// 处理函数在独立的协程中执行 不会阻塞readDispose
+// 调用超时后立即释放并发名额 还未返回的处理函数改由rpcAbandon计数
+func (t *FireTower) handleRPC(fire *FireInfo) {
+	id, method := fire.Message.Id, fire.Message.Method
+	if id == "" || method == "" {
+		t.replyRPC(id, method, nil, &RPCError{Code: "rpc_bad_request", Message: "id and method are required"})
+		return
+	}
+	fn := t.rpcHandler(method)
+	if fn == nil {
+		t.replyRPC(id, method, nil, &RPCError{Code: "rpc_not_found", Message: "method not found"})
+		return
+	}
+	sem, abandon := t.rpcSem, t.rpcAbandon
+	select {
+	case sem <- struct{}{}:
+	default:
+		t.replyRPC(id, method, nil, &RPCError{Code: "rpc_busy", Message: "too many concurrent calls"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), RPCTimeout)
+	type result struct {
+		data interface{}
+		err  error
+	}
+	done := make(chan result, 1)
+	// abandoned 1表示超时后名额已经从sem转到abandon 2表示处理函数已经返回
+	var abandoned int32
+	go func() {
+		defer func() {
+			if atomic.SwapInt32(&abandoned, 2) == 1 {
+				<-abandon
+			} else {
+				<-sem
+			}
+			if err := recover(); err != nil {
+				fire.Error(fmt.Sprintf("rpc %s panic: %v", method, err))
+				done <- result{err: &RPCError{Code: "rpc_error", Message: "internal error"}}
+			}
+		}()
+		data, err := fn(ctx, fire)
+		done <- result{data: data, err: err}
+	}()
+	go func() {
+		defer cancel()
+		select {
+		case r := <-done:
+			if r.err != nil {
+				rpcErr, ok := r.err.(*RPCError)
+				if !ok {
+					rpcErr = &RPCError{Code: "rpc_error", Message: r.err.Error()}
+				}
+				t.replyRPC(id, method, nil, rpcErr)
+				return
+			}
+			t.replyRPC(id, method, r.data, nil)
+		case <-ctx.Done():
+			select {
+			case abandon <- struct{}{}:
+				if atomic.CompareAndSwapInt32(&abandoned, 0, 1) {
+					<-sem
+				} else {
+					<-abandon
+				}
+			default:
+			}
+			t.replyRPC(id, method, nil, &RPCError{Code: "rpc_timeout", Message: "call timeout"})
+		case <-t.closeChan:
+		}
+	}()
+}
+
+// replyRPC 将rpc结果写回调用方
+func (t *FireTower) replyRPC(id, method string, data interface{}, rpcErr *RPCError) error {
+	b, err := json.Marshal(&RPCResponse{Type: RPCKey, Id: id, Method: method, Data: data, Error: rpcErr})
+	if err != nil {
+		b, _ = json.Marshal(&RPCResponse{Type: RPCKey, Id: id, Method: method, Error: &RPCError{Code: "rpc_error", Message: err.Error()}})
+	}
+	sendMessage := socket.GetSendMessage(id, "system")
+	sendMessage.Type = RPCKey
+	sendMessage.Topic = ""
+	sendMessage.MessageType = websocket.TextMessage
+	sendMessage.Data = b
+	return t.Send(sendMessage)
+}
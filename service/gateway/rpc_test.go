@@ -0,0 +1,144 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	json "github.com/json-iterator/go"
+)
+
+func readRPCResponse(t *testing.T, tower *FireTower) *RPCResponse {
+	t.Helper()
+	select {
+	case msg := <-tower.sendOut:
+		res := new(RPCResponse)
+		if err := json.Unmarshal(msg.Data, res); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	case <-time.After(time.Second):
+		t.Fatal("rpc response timeout")
+	}
+	return nil
+}
+
+func newRPCFire(id, method string) *FireInfo {
+	return &FireInfo{Context: new(FireLife), Message: &TopicMessage{Type: RPCKey, Id: id, Method: method}}
+}
+
+func TestHandleRPC(t *testing.T) {
+	tower := newMockTower("c1", 10)
+	tower.rpcSem = make(chan struct{}, 1)
+
+	RegisterRPCHandler("echo", func(ctx context.Context, fire *FireInfo) (interface{}, error) {
+		return "global", nil
+	})
+	defer RegisterRPCHandler("echo", nil)
+	tower.SetRPCHandler("fail", func(ctx context.Context, fire *FireInfo) (interface{}, error) {
+		return nil, errors.New("boom")
+	})
+
+	tower.handleRPC(newRPCFire("1", "echo"))
+	res := readRPCResponse(t, tower)
+	if res.Id != "1" || res.Error != nil || res.Data != "global" {
+		t.Errorf("unexpected echo response: %+v", res)
+	}
+
+	tower.SetRPCHandler("echo", func(ctx context.Context, fire *FireInfo) (interface{}, error) {
+		return "local", nil
+	})
+	tower.handleRPC(newRPCFire("2", "echo"))
+	if res = readRPCResponse(t, tower); res.Data != "local" {
+		t.Errorf("connection handler should override the global one, got %+v", res)
+	}
+
+	tower.handleRPC(newRPCFire("3", "fail"))
+	if res = readRPCResponse(t, tower); res.Error == nil || res.Error.Code != "rpc_error" {
+		t.Errorf("expected rpc_error, got %+v", res)
+	}
+
+	tower.handleRPC(newRPCFire("4", "missing"))
+	if res = readRPCResponse(t, tower); res.Error == nil || res.Error.Code != "rpc_not_found" {
+		t.Errorf("expected rpc_not_found, got %+v", res)
+	}
+}
+
+func TestHandleRPCTimeoutAndBusy(t *testing.T) {
+	RPCTimeout = 50 * time.Millisecond
+	defer func() { RPCTimeout = 5 * time.Second }()
+
+	tower := newMockTower("c1", 10)
+	tower.rpcSem = make(chan struct{}, 1)
+	release := make(chan struct{})
+	tower.SetRPCHandler("slow", func(ctx context.Context, fire *FireInfo) (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+
+	tower.handleRPC(newRPCFire("1", "slow"))
+	tower.handleRPC(newRPCFire("2", "slow"))
+	if res := readRPCResponse(t, tower); res.Id != "2" || res.Error.Code != "rpc_busy" {
+		t.Errorf("expected rpc_busy for the second call, got %+v", res)
+	}
+	if res := readRPCResponse(t, tower); res.Id != "1" || res.Error.Code != "rpc_timeout" {
+		t.Errorf("expected rpc_timeout for the first call, got %+v", res)
+	}
+	close(release)
+}
+
+func TestHandleRPCTimeoutReleasesSlot(t *testing.T) {
+	RPCTimeout = 50 * time.Millisecond
+	defer func() { RPCTimeout = 5 * time.Second }()
+
+	tower := newMockTower("c1", 10)
+	tower.rpcSem = make(chan struct{}, 1)
+	tower.rpcAbandon = make(chan struct{}, 1)
+	release := make(chan struct{})
+	returned := make(chan struct{}, 2)
+	tower.SetRPCHandler("slow", func(ctx context.Context, fire *FireInfo) (interface{}, error) {
+		defer func() { returned <- struct{}{} }()
+		<-release
+		return nil, nil
+	})
+	tower.SetRPCHandler("fast", func(ctx context.Context, fire *FireInfo) (interface{}, error) {
+		return "ok", nil
+	})
+
+	// 超时后名额转到rpcAbandon 新的调用可以继续执行
+	tower.handleRPC(newRPCFire("1", "slow"))
+	if res := readRPCResponse(t, tower); res.Id != "1" || res.Error == nil || res.Error.Code != "rpc_timeout" {
+		t.Fatalf("expected rpc_timeout for the first call, got %+v", res)
+	}
+	tower.handleRPC(newRPCFire("2", "fast"))
+	if res := readRPCResponse(t, tower); res.Id != "2" || res.Error != nil || res.Data != "ok" {
+		t.Fatalf("slot should be released after a timeout, got %+v", res)
+	}
+
+	// rpcAbandon已满 超时的调用继续占用名额
+	tower.handleRPC(newRPCFire("3", "slow"))
+	if res := readRPCResponse(t, tower); res.Id != "3" || res.Error == nil || res.Error.Code != "rpc_timeout" {
+		t.Fatalf("expected rpc_timeout for the third call, got %+v", res)
+	}
+	tower.handleRPC(newRPCFire("4", "fast"))
+	if res := readRPCResponse(t, tower); res.Id != "4" || res.Error == nil || res.Error.Code != "rpc_busy" {
+		t.Fatalf("expected rpc_busy once the abandon limit is reached, got %+v", res)
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-returned:
+		case <-time.After(time.Second):
+			t.Fatal("slow handler did not return")
+		}
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(tower.rpcSem) != 0 || len(tower.rpcAbandon) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("slots leaked: sem=%d abandon=%d", len(tower.rpcSem), len(tower.rpcAbandon))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,92 @@
+package gateway
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/OSMeteor/firetower/socket"
+)
+
+// 同一个ClientId在当前gateway上已有运行中的连接时 新连接的处理方式
+const (
+	// DuplicateClientAllow 两个连接同时在线 互不影响
+	DuplicateClientAllow = "allow"
+	// DuplicateClientReplace 关闭旧连接 以新连接为准 适用于客户端重连时旧连接还没有断开的情况
+	DuplicateClientReplace = "replace"
+	// DuplicateClientReject 拒绝新连接
+	DuplicateClientReject = "reject"
+)
+
+// 因ClientId重复被关闭的连接使用的close code
+const (
+	// CloseCodeReplaced 旧连接被使用相同ClientId的新连接替换
+	CloseCodeReplaced = 4001
+	// CloseCodeDuplicate 新连接的ClientId已经在线 连接被拒绝
+	CloseCodeDuplicate = 4002
+)
+
+var (
+	// DuplicateClientPolicy ClientId重复时的处理方式 在Init时从配置 session.DuplicateClientId 加载
+	DuplicateClientPolicy = DuplicateClientAllow
+)
+
+func loadSession() {
+	policy := configString("session.DuplicateClientId", DuplicateClientAllow)
+	switch policy {
+	case DuplicateClientAllow, DuplicateClientReplace, DuplicateClientReject:
+		DuplicateClientPolicy = policy
+	default:
+		fmt.Println("unknown session.DuplicateClientId:", policy)
+		DuplicateClientPolicy = DuplicateClientAllow
+	}
+}
+
+// Session 同一用户在当前gateway上的所有连接 每个连接可以看作用户的一个设备
+type Session struct {
+	UserId string
+	Towers []*FireTower // 按连接建立的先后排序
+}
+
+// Session 返回用户当前的会话 用户不在线时Towers为空
+func (t *TowerManager) Session(userId string) *Session {
+	towers := t.TowersByUser(userId)
+	sort.Slice(towers, func(i, j int) bool { return towers[i].connId < towers[j].connId })
+	return &Session{UserId: userId, Towers: towers}
+}
+
+// Len 在线的设备数
+func (s *Session) Len() int {
+	return len(s.Towers)
+}
+
+// ClientIds 在线设备的ClientId
+func (s *Session) ClientIds() []string {
+	res := make([]string, 0, len(s.Towers))
+	for _, bt := range s.Towers {
+		res = append(res, bt.ClientId)
+	}
+	return res
+}
+
+// Send 向用户的所有设备发送消息 返回成功放入发送队列的连接数
+func (s *Session) Send(messageType int, pushType, topic string, data []byte) int {
+	var n int
+	for _, bt := range s.Towers {
+		message := socket.GetSendMessage("0", "system")
+		message.MessageType = messageType
+		message.Type = pushType
+		message.Topic = topic
+		message.Data = data
+		if bt.Send(message) == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// Close 关闭用户的所有设备
+func (s *Session) Close() {
+	for _, bt := range s.Towers {
+		bt.Close()
+	}
+}
@@ -0,0 +1,104 @@
+package gateway
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/OSMeteor/firetower/socket"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestSubscribersKeyedByConnId(t *testing.T) {
+	b := &Bucket{topicRelevance: make(map[string]map[uint64]*FireTower)}
+	older, newer := newMockTower("c1", 1), newMockTower("c1", 1)
+	b.AddSubscribe("room_1", older)
+	b.AddSubscribe("room_1", newer)
+	if len(b.topicRelevance["room_1"]) != 2 {
+		t.Fatal("connections sharing a client id should not overwrite each other")
+	}
+
+	b.DelSubscribe("room_1", older)
+	b.push(&socket.SendMessage{Topic: "room_1", Data: []byte("hi")})
+	select {
+	case <-newer.sendOut:
+	default:
+		t.Error("closing the old connection should keep the new subscription")
+	}
+}
+
+// expectClose 读取客户端收到的close帧
+func expectClose(t *testing.T, c Conn, code int) {
+	t.Helper()
+	for {
+		mt, data, err := c.ReadMessage()
+		if err != nil {
+			t.Fatalf("expected close code %d, got %v", code, err)
+		}
+		if mt != websocket.CloseMessage {
+			continue
+		}
+		if got := int(data[0])<<8 | int(data[1]); got != code {
+			t.Errorf("expected close code %d, got %d", code, got)
+		}
+		return
+	}
+}
+
+func TestDuplicateClientPolicy(t *testing.T) {
+	setupSubscribeTest(t)
+	defer func() { DuplicateClientPolicy = DuplicateClientAllow }()
+
+	DuplicateClientPolicy = DuplicateClientAllow
+	runPipeTower(t, "allow", "")
+	runPipeTower(t, "allow", "")
+	if n := len(TM.TowersByClient("allow")); n != 2 {
+		t.Errorf("allow policy should keep both connections, got %d", n)
+	}
+
+	DuplicateClientPolicy = DuplicateClientReplace
+	old, oldClient := runPipeTower(t, "replace", "")
+	replacement, _ := runPipeTower(t, "replace", "")
+	expectClose(t, oldClient, CloseCodeReplaced)
+	if towers := TM.TowersByClient("replace"); len(towers) != 1 || towers[0] != replacement {
+		t.Errorf("replace policy should keep only the new connection, got %v", towers)
+	}
+	if _, ok := TM.Tower(old.ConnId()); ok {
+		t.Error("replaced connection should be unregistered")
+	}
+
+	DuplicateClientPolicy = DuplicateClientReject
+	first, _ := runPipeTower(t, "reject", "")
+	server, client := Pipe(16)
+	second := BuildTower(server, "reject")
+	second.Run() // 被拒绝时Run直接返回
+	expectClose(t, client, CloseCodeDuplicate)
+	if towers := TM.TowersByClient("reject"); len(towers) != 1 || towers[0] != first {
+		t.Errorf("reject policy should keep the first connection, got %v", towers)
+	}
+}
+
+func TestSession(t *testing.T) {
+	setupSubscribeTest(t)
+	_, phone := runPipeTower(t, "phone", "u1")
+	_, laptop := runPipeTower(t, "laptop", "u1")
+	runPipeTower(t, "other", "u2")
+
+	s := TM.Session("u1")
+	if s.Len() != 2 || fmt.Sprint(s.ClientIds()) != "[phone laptop]" {
+		t.Fatalf("unexpected session %v", s.ClientIds())
+	}
+	if n := s.Send(websocket.TextMessage, "notice", "", []byte("hello")); n != 2 {
+		t.Errorf("expected 2 deliveries, got %d", n)
+	}
+	for _, c := range []Conn{phone, laptop} {
+		if _, data, err := c.ReadMessage(); err != nil || string(data) != "hello" {
+			t.Errorf("unexpected message %q %v", data, err)
+		}
+	}
+
+	s.Close()
+	if TM.Session("u1").Len() != 0 || TM.Session("u2").Len() != 1 {
+		t.Error("closing a session should only close the user's devices")
+	}
+}
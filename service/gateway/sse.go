@@ -0,0 +1,291 @@
+package gateway
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	// SSEReplaySize 每个SSE会话保留的最近事件数 用于断线重连时按 Last-Event-ID 补发
+	SSEReplaySize = 256
+	// SSEIdleTimeout 会话没有事件流连接时的最长保留时间 超时后关闭对应的FireTower
+	SSEIdleTimeout = 30 * time.Second
+
+	sseSessions sync.Map // session id -> *sseConn
+)
+
+func loadSSE() {
+	SSEReplaySize = int(configInt("sse.ReplaySize", 256))
+	SSEIdleTimeout = time.Duration(configInt("sse.IdleTimeout", 30)) * time.Second
+}
+
+type sseEvent struct {
+	id    uint64
+	event string
+	data  []byte
+}
+
+// sseConn 将一个SSE会话适配为FireTower的底层连接
+// 下行消息先写入环形缓冲 再由当前挂载的事件流写出 因此sendLoop不会被http写入阻塞
+// 上行消息由POST请求写入readIn 由readLoop通过ReadMessage读取
+type sseConn struct {
+	id      string
+	tower   *FireTower
+	mu      sync.Mutex
+	events  []sseEvent    // 最近的事件 按id递增
+	lastId  uint64        // 最后一个事件的id
+	notify  chan struct{} // 有新事件时通知事件流
+	stream  uint64        // 当前挂载的事件流编号 0表示没有事件流
+	streams uint64        // 事件流编号生成器
+	idle    *time.Timer   // 没有事件流时的过期计时器
+	readIn  chan []byte
+	closed  chan struct{}
+	isClose bool
+}
+
+func newSSEConn(id string) *sseConn {
+	return &sseConn{
+		id:     id,
+		notify: make(chan struct{}, 1),
+		readIn: make(chan []byte, 16),
+		closed: make(chan struct{}),
+	}
+}
+
+// ReadMessage 读取客户端通过POST提交的消息
+func (c *sseConn) ReadMessage() (int, []byte, error) {
+	select {
+	case data := <-c.readIn:
+		return websocket.TextMessage, data, nil
+	case <-c.closed:
+		return 0, nil, io.EOF
+	}
+}
+
+// WriteMessage 写入一个SSE事件
+func (c *sseConn) WriteMessage(messageType int, data []byte) error {
+	return c.push("", data)
+}
+
+// WriteClose 以close事件告知客户端关闭原因
+func (c *sseConn) WriteClose(code int, reason string) error {
+	return c.push("close", []byte(strconv.Itoa(code)+" "+reason))
+}
+
+// SetWriteDeadline SSE写入是异步的 不需要截止时间
+func (c *sseConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// Close 关闭会话 正在进行的事件流与ReadMessage都会返回
+func (c *sseConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.isClose {
+		c.isClose = true
+		close(c.closed)
+		if c.idle != nil {
+			c.idle.Stop()
+		}
+		sseSessions.Delete(c.id)
+	}
+	return nil
+}
+
+func (c *sseConn) push(event string, data []byte) error {
+	c.mu.Lock()
+	if c.isClose {
+		c.mu.Unlock()
+		return ErrorClose
+	}
+	c.lastId++
+	c.events = append(c.events, sseEvent{id: c.lastId, event: event, data: append([]byte(nil), data...)})
+	if len(c.events) > SSEReplaySize && SSEReplaySize > 0 {
+		c.events = c.events[len(c.events)-SSEReplaySize:]
+	}
+	c.mu.Unlock()
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// since 返回id大于lastId的事件
+func (c *sseConn) since(lastId uint64) []sseEvent {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var res []sseEvent
+	for _, e := range c.events {
+		if e.id > lastId {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+// attach 挂载一个新的事件流 旧的事件流会随之退出
+func (c *sseConn) attach() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.streams++
+	c.stream = c.streams
+	if c.idle != nil {
+		c.idle.Stop()
+		c.idle = nil
+	}
+	return c.stream
+}
+
+// detach 事件流断开 会话在SSEIdleTimeout内没有重新挂载则关闭
+func (c *sseConn) detach(stream uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stream != stream || c.isClose {
+		return
+	}
+	c.stream = 0
+	c.idle = time.AfterFunc(SSEIdleTimeout, func() {
+		c.mu.Lock()
+		expired := c.stream == 0
+		c.mu.Unlock()
+		if expired && c.tower != nil {
+			c.tower.Close()
+		}
+	})
+}
+
+func (c *sseConn) current(stream uint64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stream == stream
+}
+
+func writeSSEEvent(w io.Writer, e sseEvent) {
+	fmt.Fprintf(w, "id: %d\n", e.id)
+	if e.event != "" {
+		fmt.Fprintf(w, "event: %s\n", e.event)
+	}
+	for _, line := range bytes.Split(e.data, []byte{'\n'}) {
+		fmt.Fprintf(w, "data: %s\n", line)
+	}
+	io.WriteString(w, "\n")
+}
+
+// SSEHandler 返回一个基于 Server-Sent Events 的传输入口 语义与websocket连接一致
+//
+// GET  不带session参数时新建会话 第一个事件为 `event: session` 数据为会话id
+// GET  ?session=id 重新挂载已有会话 按 Last-Event-ID 补发断线期间的事件
+// POST ?session=id 提交客户端消息 内容与websocket上行消息格式相同(subscribe/unSubscribe/publish等)
+//
+// build 在新会话建立时调用 业务在这里鉴权并设置回调 返回false则拒绝连接
+func SSEHandler(build func(tower *FireTower, r *http.Request) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			serveSSEStream(w, r, build)
+		case http.MethodPost:
+			value, ok := sseSessions.Load(r.URL.Query().Get("session"))
+			if !ok {
+				http.Error(w, "session not found", http.StatusNotFound)
+				return
+			}
+			c := value.(*sseConn)
+			deliverHTTPMessage(w, r, c.readIn, c.closed)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func serveSSEStream(w http.ResponseWriter, r *http.Request, build func(tower *FireTower, r *http.Request) bool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	var (
+		c      *sseConn
+		lastId uint64
+	)
+	if id := r.URL.Query().Get("session"); id != "" {
+		value, ok := sseSessions.Load(id)
+		if !ok {
+			http.Error(w, "session not found", http.StatusNotFound)
+			return
+		}
+		c = value.(*sseConn)
+		lastEventId := r.Header.Get("Last-Event-ID")
+		if lastEventId == "" {
+			lastEventId = r.URL.Query().Get("last_event_id")
+		}
+		lastId, _ = strconv.ParseUint(lastEventId, 10, 64)
+	} else {
+		if topicManageGrpc == nil {
+			http.Error(w, "gateway is not inited", http.StatusServiceUnavailable)
+			return
+		}
+		c = newSSEConn(newSessionId())
+		clientId := r.URL.Query().Get("client_id")
+		if clientId == "" {
+			clientId = c.id
+		}
+		tower := buildNewTower(c, clientId)
+		c.tower = tower
+		if build != nil && !build(tower, r) {
+			// build中可能已经订阅了topic或设置了UserId 关闭以释放订阅关系与限流器
+			tower.Close()
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		sseSessions.Store(c.id, c)
+		c.push("session", []byte(c.id))
+		go tower.Run()
+	}
+
+	stream := c.attach()
+	defer c.detach(stream)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		for _, e := range c.since(lastId) {
+			writeSSEEvent(w, e)
+			lastId = e.id
+		}
+		flusher.Flush()
+		select {
+		case <-c.notify:
+			if !c.current(stream) {
+				// 同一会话挂载了新的事件流 把通知还给新的事件流
+				select {
+				case c.notify <- struct{}{}:
+				default:
+				}
+				return
+			}
+		case <-c.closed:
+			for _, e := range c.since(lastId) {
+				writeSSEEvent(w, e)
+			}
+			flusher.Flush()
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/OSMeteor/firetower/grpc/manager"
+
+	"github.com/holdno/snowFlakeByGo"
+	"github.com/pelletier/go-toml"
+)
+
+type fakeManagerClient struct {
+	pb.TopicServiceClient
+}
+
+// setupTransportTest 准备不依赖manager的最小运行环境
+// 测试结束时关闭仍在运行的连接 等待它们的协程全部退出后还原被替换的全局变量
+func setupTransportTest(t *testing.T) {
+	t.Helper()
+	config, idWorker, writer, errorWriter := ConfigTree, IdWorker, DefaultWriter, DefaultErrorWriter
+	towerLogger, fireLogger, grpcClient, tm := TowerLogger, FireLogger, topicManageGrpc, TM
+	t.Cleanup(func() {
+		for _, tower := range TM.Towers() {
+			tower.Close()
+		}
+		waitTowers(t)
+		ConfigTree, IdWorker, DefaultWriter, DefaultErrorWriter = config, idWorker, writer, errorWriter
+		TowerLogger, FireLogger, topicManageGrpc, TM = towerLogger, fireLogger, grpcClient, tm
+	})
+
+	var err error
+	if ConfigTree, err = toml.Load("chanLens = 16\nheartbeat = 30"); err != nil {
+		t.Fatal(err)
+	}
+	IdWorker, _ = snowFlakeByGo.NewWorker(1)
+	DefaultWriter, DefaultErrorWriter = io.Discard, io.Discard
+	TowerLogger, FireLogger = towerLog, fireLog
+	topicManageGrpc = fakeManagerClient{}
+	TM = &TowerManager{}
+	TM.addBucket(&Bucket{topicRelevance: make(map[string]map[uint64]*FireTower)})
+}
+
+// waitTowers 等待所有tower的协程退出
+func waitTowers(t *testing.T) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		runningTowers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Error("tower goroutines are still running")
+	}
+}
+
+type sseReader struct {
+	*bufio.Reader
+}
+
+// next 读取下一个事件 返回id、事件名与数据
+func (r sseReader) next(t *testing.T) (id, event, data string) {
+	t.Helper()
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read event: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "":
+			return
+		case strings.HasPrefix(line, "id: "):
+			id = line[4:]
+		case strings.HasPrefix(line, "event: "):
+			event = line[7:]
+		case strings.HasPrefix(line, "data: "):
+			data = line[6:]
+		}
+	}
+}
+
+func TestSSESession(t *testing.T) {
+	setupTransportTest(t)
+	RegisterRPCHandler("ping", func(ctx context.Context, fire *FireInfo) (interface{}, error) {
+		return "pong", nil
+	})
+	defer RegisterRPCHandler("ping", nil)
+
+	towers := make(chan *FireTower, 2)
+	srv := httptest.NewServer(SSEHandler(func(ft *FireTower, r *http.Request) bool {
+		towers <- ft
+		return r.URL.Query().Get("token") == "ok"
+	}))
+	defer srv.Close()
+
+	if res, err := http.Get(srv.URL + "?token=bad"); err != nil || res.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected forbidden, got %v %v", res, err)
+	}
+	select {
+	case <-(<-towers).closeChan:
+	default:
+		t.Error("rejected tower should be closed")
+	}
+
+	res, err := http.Get(srv.URL + "?token=ok")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	tower := <-towers
+	stream := sseReader{bufio.NewReader(res.Body)}
+	_, event, session := stream.next(t)
+	if event != "session" || session == "" {
+		t.Fatalf("first event should carry the session id, got %q %q", event, session)
+	}
+
+	post, err := http.Post(srv.URL+"?session="+session, "application/json", strings.NewReader(`{"type":"rpc","id":"1","method":"ping"}`))
+	if err != nil || post.StatusCode != http.StatusAccepted {
+		t.Fatalf("post failed: %v %v", post, err)
+	}
+	id, _, data := stream.next(t)
+	if !strings.Contains(data, `"pong"`) {
+		t.Fatalf("expected rpc response, got %q", data)
+	}
+	res.Body.Close()
+
+	// 断线重连 从Last-Event-ID之后补发
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"?session="+session, nil)
+	req.Header.Set("Last-Event-ID", "1")
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	stream = sseReader{bufio.NewReader(res.Body)}
+	if replayId, _, replay := stream.next(t); replayId != id || replay != data {
+		t.Fatalf("expected replay of event %s, got %s %q", id, replayId, replay)
+	}
+
+	tower.Close()
+	select {
+	case <-tower.closeChan:
+	case <-time.After(time.Second):
+		t.Fatal("tower should be closed")
+	}
+	if _, ok := sseSessions.Load(session); ok {
+		t.Error("session should be removed after close")
+	}
+}
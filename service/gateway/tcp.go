@@ -0,0 +1,261 @@
+package gateway
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/OSMeteor/firetower/socket"
+
+	"github.com/gorilla/websocket"
+)
+
+// TCP客户端协议中用到的帧类型
+const (
+	// TCPAuthKey 连接建立后的第一个帧 topic为clientId 内容为鉴权凭证
+	// 网关以同类型的帧应答 内容为 ok 或 forbidden
+	TCPAuthKey = "auth"
+	// TCPMessageKey 没有类型信息的下行内容(例如ToSelf写入的数据)使用的帧类型
+	TCPMessageKey = "message"
+	// TCPCloseKey 网关主动关闭连接前下发的帧 内容为 "code reason"
+	TCPCloseKey = "close"
+	// tcpEmptyTopic 帧格式要求topic不能为空 没有topic时以该值占位
+	tcpEmptyTopic = "-"
+)
+
+var (
+	// TCPAddress 原生TCP接入的监听地址 为空时ListenTCP需要显式传入地址
+	TCPAddress = ""
+	// TCPAuthTimeout 建立连接后等待鉴权帧的最长时间
+	TCPAuthTimeout = 10 * time.Second
+	// TCPMaxFrameSize 单个上行帧的最大字节数
+	TCPMaxFrameSize = 64 * 1024
+)
+
+func loadTCP() {
+	TCPAddress = configString("tcp.Address", "")
+	TCPAuthTimeout = time.Duration(configInt("tcp.AuthTimeout", 10)) * time.Second
+	TCPMaxFrameSize = int(configInt("tcp.MaxFrameSize", 64*1024))
+}
+
+// TCPAuth TCP客户端鉴权帧携带的信息
+type TCPAuth struct {
+	ClientId   string // 鉴权帧的topic 为空时由网关生成
+	Token      []byte // 鉴权帧的内容
+	RemoteAddr net.Addr
+}
+
+// tcpConn 将一个使用socket包帧格式(Enpack)的TCP连接适配为FireTower的底层连接
+//
+// 上行帧: type messageId source topic\ncontent
+// subscribe/unSubscribe 的topic为逗号分隔的列表 publish的content原样作为消息内容
+// rpc 的messageId为请求id source为方法名 content为参数
+type tcpConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	mu     sync.Mutex // 串行化写入 sendLoop之外ToSelf也可能直接写
+}
+
+func newTCPConn(conn net.Conn) *tcpConn {
+	return &tcpConn{conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// ReadFrame 读取一个上行帧并转换为客户端消息
+func (c *tcpConn) ReadFrame() (*TopicMessage, error) {
+	frame, err := socket.ReadFrame(c.reader, TCPMaxFrameSize)
+	if err != nil {
+		return nil, err
+	}
+	message := &TopicMessage{Type: frame.Type, Data: frame.Data, Id: frame.Context.Id}
+	if frame.Topic != tcpEmptyTopic {
+		message.Topic = frame.Topic
+	}
+	if frame.Type == RPCKey {
+		message.Method = frame.Context.Source
+	}
+	frame.Recycling()
+	return message, nil
+}
+
+// ReadMessage 读取一个上行帧的内容 FireTower通过ReadFrame读取完整的帧
+func (c *tcpConn) ReadMessage() (int, []byte, error) {
+	message, err := c.ReadFrame()
+	if err != nil {
+		return 0, nil, err
+	}
+	return websocket.BinaryMessage, message.Data, nil
+}
+
+// WriteFrame 将发送队列中的消息编码为帧写出 保留消息的类型、id、来源与topic
+func (c *tcpConn) WriteFrame(message *socket.SendMessage) error {
+	pushType := message.Type
+	if pushType == "" {
+		pushType = TCPMessageKey
+	}
+	return c.writeFrame(pushType, message.Context.Id, message.Context.Source, message.Topic, message.Data)
+}
+
+// WriteMessage 写出没有类型信息的内容
+func (c *tcpConn) WriteMessage(messageType int, data []byte) error {
+	return c.writeFrame(TCPMessageKey, "0", "system", "", data)
+}
+
+// WriteClose 以close帧告知客户端关闭原因
+func (c *tcpConn) WriteClose(code int, reason string) error {
+	c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	return c.writeFrame(TCPCloseKey, "0", "system", "", []byte(strconv.Itoa(code)+" "+reason))
+}
+
+func (c *tcpConn) writeFrame(pushType, id, source, topic string, content []byte) error {
+	if topic == "" {
+		topic = tcpEmptyTopic
+	}
+	if content == nil {
+		content = []byte{}
+	}
+	b, err := socket.Enpack(pushType, id, source, topic, content)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err = c.conn.Write(b)
+	return err
+}
+
+// WriteBatch 将一批消息编码后合并为一次写入
+func (c *tcpConn) WriteBatch(messages []*socket.SendMessage) error {
+	var buf []byte
+	for _, message := range messages {
+		pushType, topic, content := message.Type, message.Topic, message.Data
+		if pushType == "" {
+			pushType = TCPMessageKey
+		}
+		if topic == "" {
+			topic = tcpEmptyTopic
+		}
+		if content == nil {
+			content = []byte{}
+		}
+		b, err := socket.Enpack(pushType, message.Context.Id, message.Context.Source, topic, content)
+		if err != nil {
+			return err
+		}
+		buf = append(buf, b...)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.conn.Write(buf)
+	return err
+}
+
+// SetWriteDeadline 设置写入截止时间
+func (c *tcpConn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+// Close 关闭TCP连接
+func (c *tcpConn) Close() error {
+	return c.conn.Close()
+}
+
+// ListenTCP 在addr上监听原生TCP接入 addr为空时使用配置 tcp.Address
+// 该方法会一直阻塞 直到监听出错
+func ListenTCP(addr string, build func(tower *FireTower, auth *TCPAuth) bool) error {
+	if addr == "" {
+		addr = TCPAddress
+	}
+	if addr == "" {
+		return ErrorTCPAddressEmpty
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return ServeTCP(ln, build)
+}
+
+// ServeTCP 接收ln上的TCP连接 每个连接鉴权通过后作为一个FireTower运行
+// 与websocket连接分布在相同的bucket中 因此两种客户端可以互相收到对方的推送
+//
+// 客户端连接后需要在TCPAuthTimeout内发送一个auth帧
+// build 在收到鉴权帧时调用 业务在这里鉴权并设置回调 返回false则拒绝连接
+func ServeTCP(ln net.Listener, build func(tower *FireTower, auth *TCPAuth) bool) error {
+	if topicManageGrpc == nil {
+		panic("please confirm gateway was inited")
+	}
+	defer ln.Close()
+	var delay time.Duration
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if temporaryAcceptError(err) {
+				// 与net/http一致 超时或文件描述符等资源耗尽时退避后重试
+				if delay == 0 {
+					delay = 5 * time.Millisecond
+				} else if delay *= 2; delay > time.Second {
+					delay = time.Second
+				}
+				time.Sleep(delay)
+				continue
+			}
+			return err
+		}
+		delay = 0
+		go serveTCPConn(conn, build)
+	}
+}
+
+// temporaryAcceptError Accept返回的错误是否可以在退避后重试
+func temporaryAcceptError(err error) bool {
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return true
+	}
+	for _, errno := range []syscall.Errno{syscall.EMFILE, syscall.ENFILE, syscall.ENOBUFS, syscall.ENOMEM, syscall.ECONNABORTED} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
+
+func serveTCPConn(conn net.Conn, build func(tower *FireTower, auth *TCPAuth) bool) {
+	c := newTCPConn(conn)
+	conn.SetReadDeadline(time.Now().Add(TCPAuthTimeout))
+	frame, err := socket.ReadFrame(c.reader, TCPMaxFrameSize)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	if frame.Type != TCPAuthKey {
+		c.writeFrame(TCPAuthKey, frame.Context.Id, "system", "", []byte("auth required"))
+		conn.Close()
+		return
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	auth := &TCPAuth{Token: frame.Data, RemoteAddr: conn.RemoteAddr()}
+	if frame.Topic != tcpEmptyTopic {
+		auth.ClientId = frame.Topic
+	}
+	clientId := auth.ClientId
+	if clientId == "" {
+		clientId = newSessionId()
+	}
+	tower := buildNewTower(c, clientId)
+	if build != nil && !build(tower, auth) {
+		c.writeFrame(TCPAuthKey, frame.Context.Id, "system", "", []byte("forbidden"))
+		// build中可能已经订阅了topic或设置了UserId 关闭tower以释放订阅关系与限流器 同时关闭连接
+		tower.Close()
+		return
+	}
+	if err := c.writeFrame(TCPAuthKey, frame.Context.Id, "system", "", []byte("ok")); err != nil {
+		conn.Close()
+		return
+	}
+	tower.Run()
+}
@@ -0,0 +1,180 @@
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/OSMeteor/firetower/socket"
+)
+
+type tcpDevice struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func dialTCPDevice(t *testing.T, addr string) *tcpDevice {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &tcpDevice{conn: conn, reader: bufio.NewReader(conn)}
+}
+
+func (d *tcpDevice) write(t *testing.T, pushType, id, source, topic string, content []byte) {
+	t.Helper()
+	b, err := socket.Enpack(pushType, id, source, topic, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.conn.Write(b); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (d *tcpDevice) read(t *testing.T) *socket.SendMessage {
+	t.Helper()
+	d.conn.SetReadDeadline(time.Now().Add(time.Second))
+	frame, err := socket.ReadFrame(d.reader, 0)
+	if err != nil {
+		t.Fatalf("read frame: %v", err)
+	}
+	return frame
+}
+
+func TestTCPEndpoint(t *testing.T) {
+	setupTransportTest(t)
+	RegisterRPCHandler("ping", func(ctx context.Context, fire *FireInfo) (interface{}, error) {
+		return "pong", nil
+	})
+	defer RegisterRPCHandler("ping", nil)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	towers := make(chan *FireTower, 1)
+	published := make(chan *FireInfo, 1)
+	rejected := make(chan struct{})
+	go ServeTCP(ln, func(tower *FireTower, auth *TCPAuth) bool {
+		if string(auth.Token) != "secret" {
+			tower.SetOnOfflineHandler(func() { close(rejected) })
+			return false
+		}
+		tower.SetReadHandler(func(fire *FireInfo) bool {
+			published <- fire
+			return true
+		})
+		towers <- tower
+		return true
+	})
+	defer ln.Close()
+
+	denied := dialTCPDevice(t, ln.Addr().String())
+	denied.write(t, TCPAuthKey, "1", "device", "sensor_1", []byte("wrong"))
+	if frame := denied.read(t); frame.Type != TCPAuthKey || string(frame.Data) != "forbidden" {
+		t.Fatalf("expected forbidden, got %s %q", frame.Type, frame.Data)
+	}
+	select {
+	case <-rejected:
+	case <-time.After(time.Second):
+		t.Error("rejected tower should be closed")
+	}
+
+	device := dialTCPDevice(t, ln.Addr().String())
+	device.write(t, TCPAuthKey, "1", "device", "sensor_1", []byte("secret"))
+	if frame := device.read(t); frame.Type != TCPAuthKey || string(frame.Data) != "ok" {
+		t.Fatalf("expected auth ok, got %s %q", frame.Type, frame.Data)
+	}
+	tower := <-towers
+	if tower.ClientId != "sensor_1" {
+		t.Errorf("client id should come from the auth frame, got %q", tower.ClientId)
+	}
+
+	// 上行内容不需要是json
+	device.write(t, socket.PublishKey, "2", "device", "room/1", []byte{0x01, 0x02})
+	select {
+	case fire := <-published:
+		if fire.Message.Topic != "room/1" || string(fire.Message.Data) != "\x01\x02" {
+			t.Errorf("unexpected publish %+v", fire.Message)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("publish frame was not dispatched")
+	}
+
+	device.write(t, RPCKey, "3", "ping", "-", []byte("null"))
+	if frame := device.read(t); frame.Type != RPCKey || frame.Context.Id != "3" {
+		t.Errorf("unexpected rpc reply %s %s %q", frame.Type, frame.Context.Id, frame.Data)
+	}
+
+	// 与websocket连接共用bucket 推送以帧的形式送达
+	bucket := TM.GetBucket(tower)
+	bucket.AddSubscribe("room/1", tower)
+	push := socket.GetSendMessage("4", "platform")
+	push.Type, push.Topic, push.Data = socket.PublishKey, "room/1", []byte("hello")
+	bucket.push(push)
+	frame := device.read(t)
+	if frame.Type != socket.PublishKey || frame.Topic != "room/1" || frame.Context.Source != "platform" || string(frame.Data) != "hello" {
+		t.Errorf("unexpected push frame %s %s %s %q", frame.Type, frame.Topic, frame.Context.Source, frame.Data)
+	}
+	bucket.DelSubscribe("room/1", tower)
+
+	tower.closeWithCode(1008, "bye")
+	if frame := device.read(t); frame.Type != TCPCloseKey || string(frame.Data) != "1008 bye" {
+		t.Errorf("unexpected close frame %s %q", frame.Type, frame.Data)
+	}
+}
+
+func TestTCPAuthRequired(t *testing.T) {
+	setupTransportTest(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ServeTCP(ln, nil)
+	defer ln.Close()
+
+	device := dialTCPDevice(t, ln.Addr().String())
+	device.write(t, "subscribe", "1", "device", "room/1", []byte{})
+	if frame := device.read(t); frame.Type != TCPAuthKey || string(frame.Data) != "auth required" {
+		t.Fatalf("expected auth required, got %s %q", frame.Type, frame.Data)
+	}
+}
+
+// failingListener 前几次Accept返回指定的错误 之后返回net.ErrClosed
+type failingListener struct {
+	net.Listener
+	errs    []error
+	accepts int
+}
+
+func (l *failingListener) Accept() (net.Conn, error) {
+	l.accepts++
+	if len(l.errs) > 0 {
+		err := l.errs[0]
+		l.errs = l.errs[1:]
+		return nil, err
+	}
+	return nil, net.ErrClosed
+}
+
+func (l *failingListener) Close() error { return nil }
+
+func TestServeTCPAcceptRetry(t *testing.T) {
+	setupTransportTest(t)
+	emfile := &net.OpError{Op: "accept", Net: "tcp", Err: os.NewSyscallError("accept", syscall.EMFILE)}
+	ln := &failingListener{errs: []error{emfile, emfile}}
+	if err := ServeTCP(ln, nil); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("expected the listener to stop on net.ErrClosed, got %v", err)
+	}
+	if ln.accepts != 3 {
+		t.Errorf("EMFILE should be retried, got %d accepts", ln.accepts)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	pb "github.com/OSMeteor/firetower/grpc/manager"
@@ -33,6 +34,9 @@ var (
 
 	// IdWorker 全局唯一id生成器实例
 	IdWorker *snowFlakeByGo.Worker
+
+	// runningTowers 运行中的Run以及它启动的读写协程 用于等待所有连接完全退出
+	runningTowers sync.WaitGroup
 )
 
 func GetTopicManage() *socket.TcpClient {
@@ -51,9 +55,11 @@ type FireInfo struct {
 
 // TopicMessage 话题信息结构体
 type TopicMessage struct {
-	Topic string          `json:"topic"`
-	Data  json.RawMessage `json:"data"` // 可能是个json
-	Type  string          `json:"type"`
+	Topic  string          `json:"topic"`
+	Data   json.RawMessage `json:"data"` // 可能是个json
+	Type   string          `json:"type"`
+	Id     string          `json:"id,omitempty"`     // rpc请求id 响应时原样带回
+	Method string          `json:"method,omitempty"` // rpc方法名
 }
 
 // NewFireInfo 第二个参数的作用是继承
@@ -125,12 +131,26 @@ type FireTower struct {
 
 	readIn    chan *FireInfo           // 读取队列
 	sendOut   chan *socket.SendMessage // 发送队列
-	ws        *websocket.Conn          // 保存底层websocket连接
+	ws        Conn                     // 保存底层连接 websocket或其他传输方式
 	topic     map[string]bool          // 订阅topic列表
-	isClose   bool                     // 判断当前websocket是否被关闭
+	topicMu   sync.RWMutex             // 保护topic 管理接口会在其他协程中读取
+	isClose   uint32                   // 判断当前websocket是否被关闭 原子操作 见closed
 	closeChan chan struct{}            // 用来作为关闭websocket的触发点
 	mutex     sync.Mutex               // 避免并发close chan
 
+	indexUser   string // 登记在TM用户索引中的UserId
+	indexClient string // 登记在TM客户端索引中的ClientId
+
+	sentNum    uint64 // 已写入底层连接的消息数 原子操作
+	droppedNum uint64 // 发送队列已满被丢弃的消息数 原子操作
+	expiredNum uint64 // 写出前已经过期被丢弃的消息数 原子操作
+
+	conflateMu   sync.Mutex
+	conflated    map[string]*socket.SendMessage // 合并key -> 排队中的最新消息
+	conflatedNum uint64                         // 被更新的消息替换的消息数 原子操作
+
+	batchFrame bool // 同一批写出的json消息合并为一个数组帧 见SetBatchFrame
+
 	onConnectHandler       func() bool
 	onOfflineHandler       func()
 	readHandler            func(*FireInfo) bool
@@ -139,6 +159,19 @@ type FireTower struct {
 	unSubscribeHandler     func(context *FireLife, topic []string) bool
 	beforeSubscribeHandler func(context *FireLife, topic []string) ([]string, bool)
 	onSystemRemove         func(topic string)
+	rateLimitHandler       func(fire *FireInfo, kind, scope string)
+
+	limitMu     sync.Mutex   // 保护用户级限流器的绑定与释放
+	connLimiter *readLimiter // 连接级限流器 未开启限流时为nil
+	userLimiter *readLimiter // 用户级限流器 同一UserId的连接共享
+	limitUser   string       // 绑定用户级限流器时的UserId
+
+	rpcMu       sync.Mutex
+	rpcHandlers map[string]RPCHandler // 当前连接注册的rpc方法
+	rpcSem      chan struct{}         // 限制同时执行中的rpc调用数
+	rpcAbandon  chan struct{}         // 记录已超时但处理函数还未返回的rpc调用数
+
+	router towerRouter // 当前连接注册的消息类型处理函数与中间件
 }
 
 // Init 初始化firetower
@@ -152,16 +185,33 @@ func Init() {
 	FireLogger = fireLog
 
 	loadConfig(DefaultConfigPath) // 加载配置
+	loadRateLimit()               // 加载限流配置
+	loadQuota()                   // 加载订阅配额
+	loadRPC()                     // 加载rpc配置
+	loadHTTPTransport()           // 加载SSE/长轮询传输配置
+	loadTCP()                     // 加载原生TCP接入配置
+	loadAdmin()                   // 加载管理接口配置
+	loadSession()                 // 加载多端登录配置
+	loadConflate()                // 加载推送合并规则
+	loadSendBatch()               // 加载批量写出配置
 	buildBuckets()                // 构建服务架构
 	buildManagerClient()          // 构建连接manager(topic管理服务)的客户端
 }
 
-// BuildTower 实例化一个websocket客户端
-func BuildTower(ws *websocket.Conn, clientId string) (tower *FireTower) {
+// BuildTower 实例化一个客户端连接
+// 直接传入 *websocket.Conn 时会自动通过NewWebsocketConn适配
+func BuildTower(ws Conn, clientId string) (tower *FireTower) {
 	if topicManageGrpc == nil {
 		panic("please confirm gateway was inited")
 	}
 
+	if c, ok := ws.(*websocket.Conn); ok {
+		if c == nil {
+			ws = nil
+		} else {
+			ws = NewWebsocketConn(c)
+		}
+	}
 	if ws == nil {
 		towerLog(tower, "ERROR", "websocket.Conn is nil")
 		return
@@ -170,7 +220,7 @@ func BuildTower(ws *websocket.Conn, clientId string) (tower *FireTower) {
 	return
 }
 
-func buildNewTower(ws *websocket.Conn, clientId string) *FireTower {
+func buildNewTower(ws Conn, clientId string) *FireTower {
 	t := &FireTower{}
 	t.connId = getConnId()
 	t.ClientId = clientId
@@ -179,8 +229,19 @@ func buildNewTower(ws *websocket.Conn, clientId string) *FireTower {
 	t.sendOut = make(chan *socket.SendMessage, ConfigTree.Get("chanLens").(int64))
 	t.topic = make(map[string]bool)
 	t.ws = ws
-	t.isClose = false
+	t.isClose = 0
 	t.closeChan = make(chan struct{})
+	t.connLimiter = newReadLimiter(ConnRateLimit)
+	if RPCMaxConcurrent > 0 {
+		t.rpcSem = make(chan struct{}, RPCMaxConcurrent)
+	} else {
+		t.rpcSem = make(chan struct{}, 1)
+	}
+	if RPCMaxAbandoned > 0 {
+		t.rpcAbandon = make(chan struct{}, RPCMaxAbandoned)
+	} else {
+		t.rpcAbandon = nil
+	}
 
 	t.readHandler = nil
 	t.readTimeoutHandler = nil
@@ -192,12 +253,39 @@ func buildNewTower(ws *websocket.Conn, clientId string) *FireTower {
 
 // Run 启动websocket客户端
 func (t *FireTower) Run() {
+	runningTowers.Add(1)
+	defer runningTowers.Done()
 	logInfo(t, "new websocket running")
+	var (
+		replaced []*FireTower
+		ok       = true
+	)
+	t.mutex.Lock()
+	if !t.closed() && TM != nil {
+		replaced, ok = TM.addTower(t)
+	}
+	t.mutex.Unlock()
+	if !ok {
+		logInfo(t, "duplicate client id, connection rejected")
+		t.closeWithCode(CloseCodeDuplicate, "duplicate client id")
+		return
+	}
+	for _, old := range replaced {
+		logInfo(old, "replaced by a new connection with the same client id")
+		old.closeWithCode(CloseCodeReplaced, "replaced by a new connection")
+	}
 	// 读取websocket信息
-	go t.readLoop()
+	runningTowers.Add(2)
+	go func() {
+		defer runningTowers.Done()
+		t.readLoop()
+	}()
 	// 处理读取事件
 	// 这两个协程都依赖 closeChan，在连接断开或被 Close 触发时会自动退出，避免 goroutine 泄漏
-	go t.readDispose()
+	go func() {
+		defer runningTowers.Done()
+		t.readDispose()
+	}()
 
 	if t.onConnectHandler != nil {
 		ok := t.onConnectHandler()
@@ -238,20 +326,34 @@ func (t *FireTower) bindTopic(topic []string) ([]string, error) {
 	if topicManage.Conn.LocalAddr().String() == "" {
 		return addTopic, errors.New("topicManage.Conn is nil")
 	}
-	if t.topic == nil {
-		t.topic = make(map[string]bool)
-	}
 	bucket := TM.GetBucket(t)
 	if bucket == nil {
 		return addTopic, errors.New("bucket is nil")
 	}
+	var (
+		quota    = GetSubscribeQuota()
+		rejected map[string][]string // 错误码 -> 因配额被拒绝的topic
+	)
+	t.topicMu.Lock()
+	if t.topic == nil {
+		t.topic = make(map[string]bool)
+	}
 	for _, v := range topic {
 		if _, ok := t.topic[v]; !ok {
+			if code := t.takeTopic(bucket, quota, v); code != "" {
+				if rejected == nil {
+					rejected = make(map[string][]string)
+				}
+				rejected[code] = append(rejected[code], v)
+				continue
+			}
 			addTopic = append(addTopic, v) // 待订阅的topic
-			t.topic[v] = true
-			bucket.AddSubscribe(v, t)
 		}
 	}
+	t.topicMu.Unlock()
+	if rejected != nil {
+		t.quotaErrors(quota, rejected)
+	}
 	if len(addTopic) > 0 {
 		_, err := topicManageGrpc.SubscribeTopic(context.Background(), &pb.SubscribeTopicRequest{Topic: addTopic, Ip: topicManage.Conn.LocalAddr().String()})
 		if err != nil {
@@ -263,9 +365,26 @@ func (t *FireTower) bindTopic(topic []string) ([]string, error) {
 	return addTopic, nil
 }
 
+// takeTopic 检查配额后添加一个topic的订阅 返回拒绝时的错误码
+// 调用方持有t.topicMu 同一topic的检查与添加订阅在同一个临界区内 并发订阅不会超出配额
+func (t *FireTower) takeTopic(bucket *Bucket, quota SubscribeQuota, topic string) string {
+	if quota.MaxSubscribersPerTopic > 0 {
+		mu := TM.quotaLock(topic)
+		mu.Lock()
+		defer mu.Unlock()
+	}
+	if code := t.admitTopic(quota, topic); code != "" {
+		return code
+	}
+	t.topic[topic] = true
+	bucket.AddSubscribe(topic, t)
+	return ""
+}
+
 func (t *FireTower) unbindTopic(topic []string) ([]string, error) {
 	var delTopic []string // 待取消订阅的topic列表
 	bucket := TM.GetBucket(t)
+	t.topicMu.Lock()
 	for _, v := range topic {
 		if _, ok := t.topic[v]; ok {
 			// 如果客户端已经订阅过该topic才执行退订
@@ -274,6 +393,7 @@ func (t *FireTower) unbindTopic(topic []string) ([]string, error) {
 			bucket.DelSubscribe(v, t)
 		}
 	}
+	t.topicMu.Unlock()
 	if len(delTopic) > 0 {
 		_, err := topicManageGrpc.UnSubscribeTopic(context.Background(), &pb.UnSubscribeTopicRequest{Topic: delTopic, Ip: topicManage.Conn.LocalAddr().String()})
 		if err != nil {
@@ -286,7 +406,7 @@ func (t *FireTower) unbindTopic(topic []string) ([]string, error) {
 }
 
 func (t *FireTower) read() (*FireInfo, error) {
-	if t.isClose {
+	if t.closed() {
 		return nil, ErrorClose
 	}
 	select {
@@ -304,26 +424,43 @@ func (t *FireTower) read() (*FireInfo, error) {
 // 向某个topic发送某段信息
 // Send 发送消息方法
 // 向某个topic发送某段信息
+// 消息会先经过出站中间件
 func (t *FireTower) Send(message *socket.SendMessage) error {
 	if message == nil {
 		return errors.New("send message is nil")
 	}
-	if t.isClose {
+	return t.outboundChain()(message)
+}
+
+// send 将消息写入发送队列
+func (t *FireTower) send(message *socket.SendMessage) error {
+	if t.closed() {
 		return ErrorClose
 	}
 	// 非阻塞发送，防止慢消费者阻塞整个 Bucket 的分发
-	select {
-	case t.sendOut <- message:
-		return nil
-	default:
-		// 缓冲区满，丢弃消息，防止阻塞上游
-		// 在生产环境中，这里应该增加一个 Metric 指标，记录丢弃的消息数量
-		if TowerLogger != nil {
-			TowerLogger(t, "WARN", "send buffer full, message dropped")
+	if key, ok := conflateKey(message); ok {
+		if t.sendConflated(key, message) {
+			return nil
+		}
+	} else {
+		select {
+		case t.sendOut <- message:
+			return nil
+		default:
 		}
-		// 返回错误让上层知道发送失败
-		return errors.New("send buffer full")
 	}
+	// 缓冲区满，丢弃消息，防止阻塞上游
+	atomic.AddUint64(&t.droppedNum, 1)
+	if TowerLogger != nil {
+		TowerLogger(t, "WARN", "send buffer full, message dropped")
+	}
+	// 返回错误让上层知道发送失败
+	return errors.New("send buffer full")
+}
+
+// closed 连接是否已经关闭 Close在持有mutex时写入 其他协程随时可能读取
+func (t *FireTower) closed() bool {
+	return atomic.LoadUint32(&t.isClose) == 1
 }
 
 // Close 关闭客户端连接并注销
@@ -332,14 +469,13 @@ func (t *FireTower) Close() {
 	logInfo(t, "websocket connect is closed")
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
-	if !t.isClose {
-		t.isClose = true
+	if !t.closed() {
+		atomic.StoreUint32(&t.isClose, 1)
+		if TM != nil {
+			TM.delTower(t)
+		}
 		if t.topic != nil {
-			var topicSlice []string
-			for k := range t.topic {
-				topicSlice = append(topicSlice, k)
-			}
-			delTopic, err := t.unbindTopic(topicSlice)
+			delTopic, err := t.unbindTopic(t.Topics())
 			fire := NewFireInfo(t, nil)
 			if err != nil {
 				fire.Panic(err.Error())
@@ -352,6 +488,7 @@ func (t *FireTower) Close() {
 		}
 		t.ws.Close()
 		close(t.closeChan)
+		t.releaseLimiters()
 		if t.onOfflineHandler != nil {
 			t.onOfflineHandler()
 		}
@@ -366,32 +503,33 @@ func (t *FireTower) sendLoop() {
 			t.Close()
 		}
 	}()
+	var batch []*socket.SendMessage
 	heartTicker := time.NewTicker(time.Duration(ConfigTree.Get("heartbeat").(int64)) * time.Second)
 	defer heartTicker.Stop()
 	for {
 		select {
 		case message := <-t.sendOut:
-			if message == nil {
-				towerLog(t, "ERROR", "sendLoop received nil message")
+			batch = t.collect(batch[:0], message)
+			if len(batch) == 0 {
 				continue
 			}
 			if err := t.ws.SetWriteDeadline(time.Now().Add(3 * time.Second)); err != nil {
-				message.Panic(fmt.Sprintf("set write deadline failed: %v", err))
+				batch[0].Panic(fmt.Sprintf("set write deadline failed: %v", err))
 				goto collapse
 			}
-			if message.MessageType == 0 {
-				message.MessageType = 1 // 文本格式
-			}
-			if err := t.ws.WriteMessage(message.MessageType, []byte(message.Data)); err != nil {
+			if err := t.writeBatch(batch); err != nil {
 				if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
-					message.Info(fmt.Sprintf("websocket closed while sending: %v", err))
+					batch[0].Info(fmt.Sprintf("websocket closed while sending: %v", err))
 				} else {
-					message.Panic(err.Error())
+					batch[0].Panic(err.Error())
 				}
 				goto collapse
 			}
+			atomic.AddUint64(&t.sentNum, uint64(len(batch)))
 		case <-heartTicker.C:
 			sendMessage := socket.GetSendMessage("0", "system")
+			sendMessage.Type = "heartbeat"
+			sendMessage.Topic = ""
 			sendMessage.MessageType = websocket.TextMessage
 			sendMessage.Data = []byte{104, 101, 97, 114, 116, 98, 101, 97, 116} // []byte("heartbeat")
 			if err := t.Send(sendMessage); err != nil {
@@ -406,24 +544,58 @@ collapse:
 	t.Close()
 }
 
+// write 将消息写入底层连接 实现了FrameWriter的连接会拿到完整的消息
+func (t *FireTower) write(message *socket.SendMessage) error {
+	if w, ok := t.ws.(FrameWriter); ok {
+		return w.WriteFrame(message)
+	}
+	return t.ws.WriteMessage(message.MessageType, []byte(message.Data))
+}
+
 func (t *FireTower) readLoop() {
 	defer func() {
 		if err := recover(); err != nil {
 			towerLog(t, "PANIC", fmt.Sprintf("%s", err))
 		}
 	}()
+	frameReader, framed := t.ws.(FrameReader)
 	for {
-		messageType, data, err := t.ws.ReadMessage()
+		var (
+			messageType int
+			data        []byte
+			message     *TopicMessage
+			err         error
+		)
+		if framed {
+			message, err = frameReader.ReadFrame()
+			if message != nil {
+				messageType, data = websocket.BinaryMessage, message.Data
+			}
+		} else {
+			messageType, data, err = t.ws.ReadMessage()
+		}
 		if err != nil { // 断开连接
 			goto collapse // 出现问题烽火台直接坍塌
 		}
 		fire := NewFireInfo(t, nil) // 从对象池中获取消息对象 降低GC压力
 		fire.MessageType = messageType
 
-		if err := json.Unmarshal(data, &fire.Message); err != nil {
+		if !t.limitRead(fire, RateLimitBytes, len(data)) {
+			continue
+		}
+		if message != nil {
+			fire.Message = message
+		} else if err := json.Unmarshal(data, &fire.Message); err != nil {
 			fire.Panic(fmt.Sprintf("client sended data was unmarshal error:%v", err))
 			continue
 		}
+		kind := RateLimitPublish
+		if fire.Message.Type == "subscribe" || fire.Message.Type == "unSubscribe" {
+			kind = RateLimitSubscribe
+		}
+		if !t.limitRead(fire, kind, 1) {
+			continue
+		}
 
 		timeout := time.After(time.Duration(3) * time.Second)
 		select {
@@ -463,49 +635,14 @@ func (t *FireTower) readDispose() {
 			}
 			t.Close()
 			return
-		} else if t.isClose {
+		} else if t.closed() {
 			return
 		} else {
-			if fire.Message.Topic == "" {
-				fire.Panic(fmt.Sprintf("%s:topic is empty, ClintId:%s, UserId:%s", fire.Message.Type, t.ClientId, t.UserId))
-				continue
-			}
-			switch fire.Message.Type {
-			case "subscribe": // 客户端订阅topic
-				addTopic := strings.Split(fire.Message.Topic, ",")
-				// 如果设置了订阅前触发事件则调用
-				// 如果设置了订阅前触发事件则调用
-				if t.beforeSubscribeHandler != nil {
-					var ok bool
-					addTopic, ok = t.beforeSubscribeHandler(fire.Context, addTopic)
-					if !ok {
-						continue
-					}
-				}
-				// 增加messageId 方便追踪
-				addTopic, err = t.bindTopic(addTopic)
-				if err != nil {
-					fire.Error(err.Error())
-				} else if t.subscribeHandler != nil {
-					t.subscribeHandler(fire.Context, addTopic)
-				}
-			case "unSubscribe": // 客户端取消订阅topic
-				delTopic := strings.Split(fire.Message.Topic, ",")
-				delTopic, err = t.unbindTopic(delTopic)
-				if err != nil {
-					fire.Error(err.Error())
-				} else if t.unSubscribeHandler != nil {
-					t.unSubscribeHandler(fire.Context, delTopic)
-				}
-			default:
-				if t.readHandler != nil {
-					ok := t.readHandler(fire)
-					if !ok {
-						fire.Panic("readHandler return false")
-						t.Close()
-						return
-					}
-				}
+			// 经过入站中间件后按消息类型路由
+			if !t.dispatch(fire) {
+				fire.Panic("message handler return false")
+				t.Close()
+				return
 			}
 			fire.Info("Extinguished")
 			fire.Recycling()
@@ -534,12 +671,46 @@ func (f *FireInfo) GetContextId() string {
 // 这里描述一下使用场景
 // 只针对当前客户端进行的推送请调用该方法
 func (t *FireTower) ToSelf(b []byte) error {
-	if t.isClose != true {
+	if !t.closed() {
 		return t.ws.WriteMessage(1, b)
 	}
 	return ErrorClose
 }
 
+// ErrorFrame 下发给客户端的错误帧内容
+// 以 {"type":"error","topic":"...","data":ErrorFrame} 的格式写回客户端
+type ErrorFrame struct {
+	Code    string   `json:"code"`
+	Message string   `json:"message"`
+	Topic   []string `json:"topic,omitempty"`
+}
+
+// sendError 通过发送队列向当前客户端写回一个错误帧
+func (t *FireTower) sendError(topic, code, info string, topics []string) error {
+	data, err := json.Marshal(&ErrorFrame{Code: code, Message: info, Topic: topics})
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(&TopicMessage{Topic: topic, Data: data, Type: "error"})
+	if err != nil {
+		return err
+	}
+	sendMessage := socket.GetSendMessage("0", "system")
+	sendMessage.Type = "error"
+	sendMessage.MessageType = websocket.TextMessage
+	sendMessage.Topic = topic
+	sendMessage.Data = b
+	return t.Send(sendMessage)
+}
+
+// closeWithCode 携带close code通知客户端后关闭连接
+func (t *FireTower) closeWithCode(code int, reason string) {
+	if c, ok := t.ws.(CloseWriter); ok && !t.closed() {
+		c.WriteClose(code, reason)
+	}
+	t.Close()
+}
+
 // CheckTopicExist 检测topic是否已经有人订阅
 func (t *FireTower) CheckTopicExist(topic string) bool {
 	res, err := topicManageGrpc.CheckTopicExist(context.Background(), &pb.CheckTopicExistRequest{Topic: topic})
@@ -549,6 +720,54 @@ func (t *FireTower) CheckTopicExist(topic string) bool {
 	return res.Ok
 }
 
+// SetUserId 设置连接的UserId
+// 连接运行后修改UserId请使用该方法 以便TM.TowersByUser与踢人等控制消息能找到该连接
+func (t *FireTower) SetUserId(userId string) {
+	if TM == nil {
+		t.UserId = userId
+		return
+	}
+	TM.setUserId(t, userId)
+}
+
+// GetUserId 返回连接当前的UserId 可以与SetUserId并发调用
+func (t *FireTower) GetUserId() string {
+	if TM == nil {
+		return t.UserId
+	}
+	TM.indexMu.RLock()
+	defer TM.indexMu.RUnlock()
+	return t.UserId
+}
+
+// ConnId 连接id 在当前实例上唯一
+func (t *FireTower) ConnId() uint64 {
+	return t.connId
+}
+
+// StartTime 连接建立的时间
+func (t *FireTower) StartTime() time.Time {
+	return t.startTime
+}
+
+// Topics 当前连接已订阅的topic
+func (t *FireTower) Topics() []string {
+	t.topicMu.RLock()
+	defer t.topicMu.RUnlock()
+	topics := make([]string, 0, len(t.topic))
+	for k := range t.topic {
+		topics = append(topics, k)
+	}
+	return topics
+}
+
+// hasTopic 当前连接是否已订阅topic
+func (t *FireTower) hasTopic(topic string) bool {
+	t.topicMu.RLock()
+	defer t.topicMu.RUnlock()
+	return t.topic[topic]
+}
+
 // SetOnConnectHandler 建立连接事件
 func (t *FireTower) SetOnConnectHandler(fn func() bool) {
 	t.onConnectHandler = fn
@@ -594,6 +813,12 @@ func (t *FireTower) SetOnSystemRemove(fn func(topic string)) {
 	t.onSystemRemove = fn
 }
 
+// SetRateLimitHandler 触发限流时的回调
+// kind 为 publish | subscribe | bytes, scope 为 conn | user
+func (t *FireTower) SetRateLimitHandler(fn func(fire *FireInfo, kind, scope string)) {
+	t.rateLimitHandler = fn
+}
+
 // GetConnectNum 获取话题订阅数的grpc方法封装
 func (t *FireTower) GetConnectNum(topic string) int64 {
 	res, err := topicManageGrpc.GetConnectNum(context.Background(), &pb.GetConnectNumRequest{Topic: topic})
@@ -0,0 +1,286 @@
+package manager
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/OSMeteor/firetower/socket"
+)
+
+var (
+	// AdminToken http管理接口的鉴权token 为空时管理接口不可用
+	// 请求需要携带 Authorization: Bearer <token> 请求头
+	AdminToken = ""
+	// PublicStats 为true时dashboard等只读的统计接口不需要token 只应在受信任的内网中开启
+	// 默认与管理接口使用同一个AdminToken
+	PublicStats = false
+	// AdminMaxBodySize 管理接口请求体的最大字节数
+	AdminMaxBodySize int64 = 4 << 20
+)
+
+// AllTopic 不依赖topic的控制帧使用的topic 例如不指定topic踢除用户时会发送给所有gateway
+const AllTopic = "*"
+
+// AdminPublishRequest 管理接口的推送请求
+type AdminPublishRequest struct {
+	Topic     string          `json:"topic"`
+	Data      json.RawMessage `json:"data"`
+	MessageId string          `json:"message_id,omitempty"`
+	Source    string          `json:"source,omitempty"` // 为空时为 admin
+	Ttl       int64           `json:"ttl,omitempty"`    // 消息的有效期 毫秒 0表示不过期
+}
+
+// AdminPublishResult 单条推送的结果
+type AdminPublishResult struct {
+	Topic    string `json:"topic"`
+	Ok       bool   `json:"ok"`
+	Gateways int    `json:"gateways"` // 收到推送的gateway数量
+	Error    string `json:"error,omitempty"`
+}
+
+// AdminControlRequest 踢除用户、移除topic与退订的请求参数
+type AdminControlRequest struct {
+	Topic  string `json:"topic"`
+	UserId string `json:"user_id"`
+}
+
+// AdminControlResult 控制操作的结果
+type AdminControlResult struct {
+	Gateways int `json:"gateways"` // 收到控制帧的gateway数量
+}
+
+// GatewayInfo 已连接gateway的统计信息
+type GatewayInfo struct {
+	Address    string `json:"address"`
+	TopicNum   int    `json:"topic_num"`   // 该gateway上有订阅关系的topic数量
+	ConnectNum int64  `json:"connect_num"` // 该gateway上订阅关系的总数
+}
+
+// TopicDistribution topic在各gateway上的分布
+type TopicDistribution struct {
+	Topic      string         `json:"topic"`
+	ConnectNum int64          `json:"connect_num"`
+	Gateways   []*GatewayInfo `json:"gateways"`
+}
+
+// registerAdminHandlers 在mux上注册管理接口
+func registerAdminHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/admin/publish", adminAuth(http.MethodPost, adminPublishHandler))
+	mux.HandleFunc("/admin/publish/batch", adminAuth(http.MethodPost, adminPublishBatchHandler))
+	mux.HandleFunc("/admin/kick", adminAuth(http.MethodPost, adminKickHandler))
+	mux.HandleFunc("/admin/topic/remove", adminAuth(http.MethodPost, adminRemoveTopicHandler))
+	mux.HandleFunc("/admin/unsubscribe", adminAuth(http.MethodPost, adminUnsubscribeHandler))
+	mux.HandleFunc("/admin/gateways", adminAuth(http.MethodGet, adminGatewaysHandler))
+	mux.HandleFunc("/admin/topic", adminAuth(http.MethodGet, adminTopicHandler))
+}
+
+// adminAuth 校验请求方法与token
+func adminAuth(method string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !checkToken(w, r, false) {
+			return
+		}
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeJSON(w, http.StatusMethodNotAllowed, 4050, "method not allowed", nil)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// statsAuth 只读统计接口的鉴权 PublicStats为true时不校验
+// 浏览器打开dashboard时无法携带请求头 所以也接受 ?token= 参数
+func statsAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !PublicStats && !checkToken(w, r, true) {
+			return
+		}
+		next(w, r)
+	}
+}
+
+// checkToken 校验AdminToken 失败时写出错误 query为true时请求头中没有token可以从参数中读取
+func checkToken(w http.ResponseWriter, r *http.Request, query bool) bool {
+	if AdminToken == "" {
+		writeJSON(w, http.StatusForbidden, 4030, "admin api is disabled", nil)
+		return false
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" && query {
+		token = r.URL.Query().Get("token")
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(AdminToken)) != 1 {
+		writeJSON(w, http.StatusUnauthorized, 4010, "unauthorized", nil)
+		return false
+	}
+	return true
+}
+
+// readAdminBody 解析json请求体
+func readAdminBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, AdminMaxBodySize))
+	if err == nil {
+		err = json.Unmarshal(body, v)
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, 4001, err.Error(), nil)
+		return false
+	}
+	return true
+}
+
+func adminPublish(req *AdminPublishRequest) *AdminPublishResult {
+	res := &AdminPublishResult{Topic: req.Topic}
+	if req.Topic == "" {
+		res.Error = "topic is empty"
+		return res
+	}
+	if len(req.Data) == 0 {
+		res.Error = "data is empty"
+		return res
+	}
+	if req.MessageId == "" {
+		req.MessageId = strconv.FormatInt(time.Now().UnixNano(), 10)
+	}
+	if req.Source == "" {
+		req.Source = "admin"
+	}
+	deadline := messageDeadline(req.Ttl, 0, time.Now())
+	n, err := grpcService.notifyTopicDeadline(socket.PublishKey, req.MessageId, req.Source, req.Topic, deadline, req.Data)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.Ok, res.Gateways = true, n
+	return res
+}
+
+// adminPublishHandler 推送一条消息
+// POST /admin/publish {"topic":"room_1","data":{...}}
+func adminPublishHandler(w http.ResponseWriter, r *http.Request) {
+	req := new(AdminPublishRequest)
+	if !readAdminBody(w, r, req) {
+		return
+	}
+	res := adminPublish(req)
+	if !res.Ok {
+		writeJSON(w, http.StatusOK, 4002, res.Error, res)
+		return
+	}
+	writeJSON(w, http.StatusOK, 0, "", res)
+}
+
+// adminPublishBatchHandler 批量推送 每条消息单独返回结果
+// POST /admin/publish/batch [{"topic":"room_1","data":{...}}, ...]
+func adminPublishBatchHandler(w http.ResponseWriter, r *http.Request) {
+	var reqs []*AdminPublishRequest
+	if !readAdminBody(w, r, &reqs) {
+		return
+	}
+	res := make([]*AdminPublishResult, 0, len(reqs))
+	for _, req := range reqs {
+		res = append(res, adminPublish(req))
+	}
+	writeJSON(w, http.StatusOK, 0, "", res)
+}
+
+// adminKickHandler 将用户踢下线
+// POST /admin/kick {"user_id":"1","topic":"room_1"} 不指定topic时通知所有gateway
+func adminKickHandler(w http.ResponseWriter, r *http.Request) {
+	req := new(AdminControlRequest)
+	if !readAdminBody(w, r, req) {
+		return
+	}
+	if req.UserId == "" {
+		writeJSON(w, http.StatusBadRequest, 4001, "user_id is empty", nil)
+		return
+	}
+	n, err := grpcService.kickUser(req.UserId, req.Topic)
+	writeAdminControl(w, n, err)
+}
+
+// adminRemoveTopicHandler 移除topic的所有订阅关系
+// POST /admin/topic/remove {"topic":"room_1"}
+func adminRemoveTopicHandler(w http.ResponseWriter, r *http.Request) {
+	req := new(AdminControlRequest)
+	if !readAdminBody(w, r, req) {
+		return
+	}
+	if req.Topic == "" {
+		writeJSON(w, http.StatusBadRequest, 4001, "topic is empty", nil)
+		return
+	}
+	n, err := grpcService.removeTopic(req.Topic)
+	writeAdminControl(w, n, err)
+}
+
+// adminUnsubscribeHandler 让用户退订某个topic
+// POST /admin/unsubscribe {"topic":"room_1","user_id":"1"}
+func adminUnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	req := new(AdminControlRequest)
+	if !readAdminBody(w, r, req) {
+		return
+	}
+	if req.Topic == "" || req.UserId == "" {
+		writeJSON(w, http.StatusBadRequest, 4001, "topic and user_id are required", nil)
+		return
+	}
+	n, err := grpcService.unsubscribeUser(req.Topic, req.UserId)
+	writeAdminControl(w, n, err)
+}
+
+func writeAdminControl(w http.ResponseWriter, n int, err error) {
+	if err == ErrorTopicNotExist {
+		writeJSON(w, http.StatusNotFound, 4040, err.Error(), &AdminControlResult{})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, 5001, err.Error(), nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, 0, "", &AdminControlResult{Gateways: n})
+}
+
+// adminGatewaysHandler 列出已连接的gateway及其topic数量
+// GET /admin/gateways
+func adminGatewaysHandler(w http.ResponseWriter, r *http.Request) {
+	res := []*GatewayInfo{}
+	rangeGateways(func(addr string, c *connectBucket) {
+		res = append(res, &GatewayInfo{Address: addr, TopicNum: routes.gatewayTopicNum(addr), ConnectNum: routes.gatewayConnectNum(addr)})
+	})
+	sort.Slice(res, func(i, j int) bool { return res[i].Address < res[j].Address })
+	writeJSON(w, http.StatusOK, 0, "", res)
+}
+
+// adminTopicHandler 查看某个topic在各gateway上的分布
+// GET /admin/topic?topic=room_1
+func adminTopicHandler(w http.ResponseWriter, r *http.Request) {
+	topic := r.URL.Query().Get("topic")
+	if topic == "" {
+		writeJSON(w, http.StatusBadRequest, 4001, "topic is empty", nil)
+		return
+	}
+	res := &TopicDistribution{Topic: topic, Gateways: []*GatewayInfo{}}
+	ok := routes.view(topic, func(r *topicRoute) {
+		res.ConnectNum = r.connectNum()
+		for ip, num := range r.gateways {
+			res.Gateways = append(res.Gateways, &GatewayInfo{Address: ip, TopicNum: 1, ConnectNum: num})
+		}
+		for id := range r.streams {
+			res.Gateways = append(res.Gateways, &GatewayInfo{Address: id, TopicNum: 1, ConnectNum: 1})
+		}
+	})
+	if !ok {
+		writeJSON(w, http.StatusNotFound, 4040, ErrorTopicNotExist.Error(), nil)
+		return
+	}
+	sort.Slice(res.Gateways, func(i, j int) bool { return res.Gateways[i].ConnectNum > res.Gateways[j].ConnectNum })
+	writeJSON(w, http.StatusOK, 0, "", res)
+}
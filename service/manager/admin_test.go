@@ -0,0 +1,213 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/OSMeteor/firetower/grpc/manager"
+	"github.com/OSMeteor/firetower/socket"
+)
+
+// fakeGateway 以net.Pipe模拟一个已连接的gateway 收到的帧写入frames
+type fakeGateway struct {
+	frames chan *socket.SendMessage
+}
+
+func addFakeGateway(t *testing.T, addr string, topics ...string) *fakeGateway {
+	t.Helper()
+	server, client := net.Pipe()
+	bucket := newConnectBucket(server)
+	ConnIndexTable.Store(addr, bucket)
+	go bucket.writeLoop()
+	g := &fakeGateway{frames: make(chan *socket.SendMessage, 16)}
+	go func() {
+		var (
+			overflow []byte
+			buffer   = make([]byte, 1024*16)
+		)
+		for {
+			n, err := client.Read(buffer)
+			if err != nil {
+				return
+			}
+			overflow, _ = socket.Depack(append(overflow, buffer[:n]...), g.frames)
+		}
+	}()
+	if len(topics) > 0 {
+		grpcService.SubscribeTopic(context.Background(), &pb.SubscribeTopicRequest{Topic: topics, Ip: addr})
+	}
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+		ConnIndexTable.Delete(addr)
+		grpcService.UnSubscribeTopic(context.Background(), &pb.UnSubscribeTopicRequest{Topic: topics, Ip: addr})
+	})
+	return g
+}
+
+func (g *fakeGateway) next(t *testing.T) *socket.SendMessage {
+	t.Helper()
+	select {
+	case frame := <-g.frames:
+		return frame
+	case <-time.After(time.Second):
+		t.Fatal("gateway received nothing")
+		return nil
+	}
+}
+
+func adminDo(t *testing.T, srv *httptest.Server, method, path, body string, data interface{}) (int, *Meta) {
+	t.Helper()
+	req, _ := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer secret")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var out struct {
+		Meta *Meta           `json:"meta"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if data != nil && len(out.Data) > 0 {
+		if err := json.Unmarshal(out.Data, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return res.StatusCode, out.Meta
+}
+
+func newAdminServer(t *testing.T) *httptest.Server {
+	AdminToken = "secret"
+	mux := http.NewServeMux()
+	registerAdminHandlers(mux)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(func() {
+		srv.Close()
+		AdminToken = ""
+	})
+	return srv
+}
+
+func TestAdminAuth(t *testing.T) {
+	srv := newAdminServer(t)
+	res, err := http.Get(srv.URL + "/admin/gateways")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 without token, got %d", res.StatusCode)
+	}
+
+	AdminToken = ""
+	if status, _ := adminDo(t, srv, http.MethodGet, "/admin/gateways", "", nil); status != http.StatusForbidden {
+		t.Errorf("admin api should be disabled without a token, got %d", status)
+	}
+}
+
+func TestAdminPublish(t *testing.T) {
+	srv := newAdminServer(t)
+	g := addFakeGateway(t, "gw1", "room_1")
+
+	var res AdminPublishResult
+	if status, meta := adminDo(t, srv, http.MethodPost, "/admin/publish", `{"topic":"room_1","data":{"a":1}}`, &res); status != http.StatusOK || meta.Code != 0 || res.Gateways != 1 {
+		t.Fatalf("publish failed: %d %+v %+v", status, meta, res)
+	}
+	if frame := g.next(t); frame.Type != socket.PublishKey || frame.Topic != "room_1" || frame.Context.Source != "admin" || string(frame.Data) != `{"a":1}` {
+		t.Errorf("unexpected frame %s %s %s %q", frame.Type, frame.Topic, frame.Context.Source, frame.Data)
+	}
+
+	var batch []*AdminPublishResult
+	adminDo(t, srv, http.MethodPost, "/admin/publish/batch", `[{"topic":"room_1","data":"x"},{"topic":"nobody","data":"y"}]`, &batch)
+	if len(batch) != 2 || !batch[0].Ok || batch[1].Ok || batch[1].Error == "" {
+		t.Fatalf("unexpected batch result %+v %+v", batch[0], batch[1])
+	}
+	g.next(t)
+
+	if status, _ := adminDo(t, srv, http.MethodGet, "/admin/publish", "", nil); status != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %d", status)
+	}
+}
+
+func TestAdminControl(t *testing.T) {
+	srv := newAdminServer(t)
+	g1 := addFakeGateway(t, "gw1", "room_1", "room_2")
+	g2 := addFakeGateway(t, "gw2", "room_2")
+
+	var res AdminControlResult
+	adminDo(t, srv, http.MethodPost, "/admin/kick", `{"user_id":"u1"}`, &res)
+	if res.Gateways != 2 {
+		t.Errorf("kick without topic should reach every gateway, got %d", res.Gateways)
+	}
+	for _, g := range []*fakeGateway{g1, g2} {
+		if frame := g.next(t); frame.Type != socket.OfflineUserKey || frame.Topic != AllTopic || string(frame.Data) != "u1" {
+			t.Errorf("unexpected kick frame %s %s %q", frame.Type, frame.Topic, frame.Data)
+		}
+	}
+
+	adminDo(t, srv, http.MethodPost, "/admin/unsubscribe", `{"topic":"room_1","user_id":"u1"}`, &res)
+	if frame := g1.next(t); res.Gateways != 1 || frame.Type != socket.OfflineTopicByUserIdKey || frame.Topic != "room_1" {
+		t.Errorf("unexpected unsubscribe %d %s %s", res.Gateways, frame.Type, frame.Topic)
+	}
+
+	adminDo(t, srv, http.MethodPost, "/admin/topic/remove", `{"topic":"room_2"}`, &res)
+	if res.Gateways != 2 {
+		t.Errorf("remove topic should reach both gateways, got %d", res.Gateways)
+	}
+	g1.next(t)
+	g2.next(t)
+
+	if status, _ := adminDo(t, srv, http.MethodPost, "/admin/topic/remove", `{"topic":"nobody"}`, nil); status != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown topic, got %d", status)
+	}
+}
+
+func TestAdminStats(t *testing.T) {
+	srv := newAdminServer(t)
+	addFakeGateway(t, "gw1", "room_1", "room_2")
+	addFakeGateway(t, "gw2", "room_2")
+	grpcService.SubscribeTopic(context.Background(), &pb.SubscribeTopicRequest{Topic: []string{"room_2"}, Ip: "gw2"})
+	defer grpcService.UnSubscribeTopic(context.Background(), &pb.UnSubscribeTopicRequest{Topic: []string{"room_2"}, Ip: "gw2"})
+
+	// 已经断开的gateway不再列出
+	addFakeGateway(t, "gw3", "room_3")
+	value, _ := ConnIndexTable.Load("gw3")
+	value.(*connectBucket).close()
+
+	var gateways []*GatewayInfo
+	adminDo(t, srv, http.MethodGet, "/admin/gateways", "", &gateways)
+	if len(gateways) != 2 || gateways[0].Address != "gw1" || gateways[0].TopicNum != 2 || gateways[1].ConnectNum != 2 {
+		t.Fatalf("unexpected gateways %+v %+v", gateways[0], gateways[1])
+	}
+
+	var dist TopicDistribution
+	adminDo(t, srv, http.MethodGet, "/admin/topic?topic=room_2", "", &dist)
+	if dist.ConnectNum != 3 || len(dist.Gateways) != 2 || dist.Gateways[0].Address != "gw2" {
+		t.Fatalf("unexpected distribution %+v", dist)
+	}
+}
+
+func TestGatewayCloseRemovesIndex(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	bucket := newConnectBucket(server)
+	bucket.relation()
+	addr := server.RemoteAddr().String()
+	if _, ok := ConnIndexTable.Load(addr); !ok {
+		t.Fatal("gateway should be indexed after relation")
+	}
+	bucket.close()
+	if _, ok := ConnIndexTable.Load(addr); ok {
+		t.Error("closed gateway should be removed from the index")
+	}
+}
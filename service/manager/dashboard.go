@@ -0,0 +1,39 @@
+package manager
+
+import (
+	_ "embed"
+	"net/http"
+	"strconv"
+)
+
+// DashboardTopN dashboard上展示的热门topic数量
+var DashboardTopN = 20
+
+//go:embed dashboard/index.html
+var dashboardHTML []byte
+
+// Dashboard 内嵌在程序中的web面板 通过轮询 /dashboard/stats 实时刷新
+func Dashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" && r.URL.Path != "/dashboard" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(dashboardHTML)
+}
+
+// dashboardStatsHandler dashboard使用的统计数据
+// GET /dashboard/stats?top=20
+func dashboardStatsHandler(w http.ResponseWriter, r *http.Request) {
+	topN := DashboardTopN
+	if v := r.URL.Query().Get("top"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeJSON(w, http.StatusBadRequest, 4001, "invalid top", nil)
+			return
+		}
+		topN = n
+	}
+	writeJSON(w, http.StatusOK, 0, "", collectStats(topN))
+}
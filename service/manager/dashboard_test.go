@@ -0,0 +1,157 @@
+package manager
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newDashboardServer(t *testing.T) *httptest.Server {
+	AdminToken = "secret"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", statsAuth(Dashboard))
+	mux.HandleFunc("/dashboard/stats", statsAuth(dashboardStatsHandler))
+	mux.HandleFunc("/topic", topicWebHandler)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(func() {
+		srv.Close()
+		AdminToken = ""
+	})
+	return srv
+}
+
+func TestRateMeter(t *testing.T) {
+	var m rateMeter
+	for i := 0; i < 30; i++ {
+		m.mark(100)
+	}
+	m.mark(105)
+	if r := m.rate(105); r != 3.1 {
+		t.Errorf("expected 3.1, got %v", r)
+	}
+	if r := m.rate(110); r != 0.1 {
+		t.Errorf("slots older than the window should expire, got %v", r)
+	}
+	// 同一个槽被新的一秒复用时重新计数
+	m.mark(115)
+	if r := m.rate(115); r != 0.1 {
+		t.Errorf("expected 0.1, got %v", r)
+	}
+}
+
+func TestInsertTopN(t *testing.T) {
+	var top []*TopicStat
+	for i, n := range []int64{3, 9, 1, 7, 9, 5} {
+		top = insertTopN(top, &TopicStat{Topic: string(rune('a' + i)), ConnectNum: n}, 3)
+	}
+	var got []string
+	for _, s := range top {
+		got = append(got, s.Topic)
+	}
+	if strings.Join(got, "") != "bed" {
+		t.Errorf("unexpected top topics %v", got)
+	}
+}
+
+func TestDashboardPage(t *testing.T) {
+	srv := newDashboardServer(t)
+	res, err := http.Get(srv.URL + "/?token=secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || !strings.Contains(res.Header.Get("Content-Type"), "text/html") || !strings.Contains(string(body), "dashboard/stats") {
+		t.Fatalf("unexpected dashboard page %d %s", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+
+	res, err = http.Get(srv.URL + "/nothing?token=secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", res.StatusCode)
+	}
+}
+
+func TestDashboardAuth(t *testing.T) {
+	srv := newDashboardServer(t)
+	for _, path := range []string{"/", "/dashboard/stats", "/dashboard/stats?token=wrong"} {
+		res, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401 without a valid token, got %d", path, res.StatusCode)
+		}
+	}
+
+	PublicStats = true
+	defer func() { PublicStats = false }()
+	res, err := http.Get(srv.URL + "/dashboard/stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("public stats should not need a token, got %d", res.StatusCode)
+	}
+}
+
+func TestDashboardStats(t *testing.T) {
+	srv := newDashboardServer(t)
+	addFakeGateway(t, "gw1", "room_1", "room_2")
+	g := addFakeGateway(t, "gw2", "room_2")
+	addFakeGateway(t, "gw3")
+	value, _ := ConnIndexTable.Load("gw3")
+	value.(*connectBucket).close() // 已经断开的gateway不计入统计
+
+	if _, err := grpcService.notifyTopic("publish", "1", "test", "room_2", []byte(`"hi"`)); err != nil {
+		t.Fatal(err)
+	}
+	g.next(t)
+
+	var stats DashboardStats
+	adminDo(t, srv, http.MethodGet, "/dashboard/stats", "", &stats)
+	if len(stats.Gateways) != 2 || stats.Gateways[0].Address != "gw1" || stats.Gateways[0].TopicNum != 2 || stats.Gateways[1].Status != "ok" {
+		t.Fatalf("unexpected gateways %+v", stats.Gateways)
+	}
+	if stats.Gateways[1].LastWrite.IsZero() {
+		t.Error("last write should be recorded after a publish")
+	}
+	if stats.TopicNum != 2 || stats.ConnectNum != 3 || len(stats.TopTopics) != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if top := stats.TopTopics[0]; top.Topic != "room_2" || top.ConnectNum != 2 || top.PublishRate <= 0 {
+		t.Errorf("unexpected top topic %+v", top)
+	}
+	if stats.PublishRate <= 0 {
+		t.Error("publish rate should be counted")
+	}
+}
+
+func TestTopicWebHandler(t *testing.T) {
+	srv := newDashboardServer(t)
+	addFakeGateway(t, "gw1", "room_1")
+
+	res, err := http.Get(srv.URL + "/topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var out struct {
+		Meta *Meta          `json:"meta"`
+		Data []*TopicWebRes `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		t.Fatalf("data should be a json array: %v", err)
+	}
+	if len(out.Data) != 1 || out.Data[0].Title != "room_1" || out.Data[0].ConnectNum != 1 {
+		t.Errorf("unexpected topics %+v", out.Data)
+	}
+}
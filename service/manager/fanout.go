@@ -0,0 +1,161 @@
+package manager
+
+import (
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/OSMeteor/firetower/socket"
+
+	"github.com/pkg/errors"
+)
+
+// 每个gateway连接一个写协程
+// 推送、控制消息与心跳都只是把封好的帧放入该gateway的有界队列 由writeLoop按顺序写出
+// 同一个连接上不会有多个协程同时写入 某个gateway写得慢也不会阻塞发往其他gateway的推送
+// 控制消息使用单独的队列 写出时优先于推送
+
+// 队列已满时的处理方式
+const (
+	// OverflowDrop 丢弃新的帧
+	OverflowDrop = "drop"
+	// OverflowClose 断开该gateway 与连接断开一样会清除它的订阅关系
+	OverflowClose = "close"
+)
+
+var (
+	// GatewayQueueSize 每个gateway连接可以积压的帧数 推送与控制消息各一个队列
+	GatewayQueueSize = 4096
+	// GatewayOverflowPolicy 队列已满时的处理方式 drop | close
+	GatewayOverflowPolicy = OverflowDrop
+	// GatewayWriteTimeout 单次写入gateway的超时时间 超时后断开该gateway
+	GatewayWriteTimeout = 5 * time.Second
+	// GatewayWriteBytes 写协程单次合并写出的最大字节数
+	GatewayWriteBytes = 64 * 1024
+)
+
+// ErrorGatewayQueueFull gateway的发送队列已满 帧被丢弃
+var ErrorGatewayQueueFull = errors.New("gateway queue full")
+
+// ErrorGatewayClosed gateway连接已经关闭
+var ErrorGatewayClosed = errors.New("gateway closed")
+
+// newConnectBucket 创建gateway连接 调用方负责启动各个协程
+func newConnectBucket(conn net.Conn) *connectBucket {
+	size := GatewayQueueSize
+	if size <= 0 {
+		size = 1
+	}
+	return &connectBucket{
+		overflow:    make([]byte, 0),
+		packetChan:  make(chan *socket.SendMessage, 1024),
+		controlChan: make(chan *socket.SendMessage, 1024),
+		out:         make(chan []byte, size),
+		controlOut:  make(chan []byte, size),
+		conn:        conn,
+		isClose:     false,
+		closeChan:   make(chan struct{}),
+		connectedAt: time.Now().UnixNano(),
+	}
+}
+
+// write 将帧放入gateway的发送队列 control为true时进入优先队列
+// 队列已满时按GatewayOverflowPolicy处理 不会等待队列空出位置
+// 推送方依次写入各个gateway的队列 在这里等待会让一个慢gateway拖慢发往其他gateway的推送
+func (c *connectBucket) write(b []byte, control bool) error {
+	out := c.out
+	if control {
+		out = c.controlOut
+	}
+	select {
+	case <-c.closeChan:
+		return ErrorGatewayClosed
+	default:
+	}
+	select {
+	case out <- b:
+		return nil
+	default:
+	}
+	if GatewayOverflowPolicy == OverflowClose {
+		Logger("ERROR", fmt.Sprintf("gateway %s queue full, closing", c.conn.RemoteAddr().String()))
+		c.close()
+	}
+	atomic.AddUint64(&c.droppedNum, 1)
+	return ErrorGatewayQueueFull
+}
+
+// writeLoop gateway连接的写协程 排队中的帧合并后一次写出
+func (c *connectBucket) writeLoop() {
+	defer func() {
+		if err := recover(); err != nil {
+			Logger("PANIC", fmt.Sprintf("writeLoop panic: %v", err))
+			c.close()
+		}
+	}()
+	var buf []byte
+	for {
+		select {
+		case b := <-c.controlOut:
+			buf = append(buf[:0], b...)
+		default:
+			select {
+			case b := <-c.controlOut:
+				buf = append(buf[:0], b...)
+			case b := <-c.out:
+				buf = append(buf[:0], b...)
+			case <-c.closeChan:
+				return
+			}
+		}
+		n := c.collect(&buf)
+		if GatewayWriteTimeout > 0 {
+			c.conn.SetWriteDeadline(time.Now().Add(GatewayWriteTimeout))
+		}
+		if _, err := c.conn.Write(buf); err != nil {
+			Logger("ERROR", fmt.Sprintf("write to gateway %s failed: %v", c.conn.RemoteAddr().String(), err))
+			c.close()
+			return
+		}
+		atomic.AddUint64(&c.sentNum, uint64(n))
+		atomic.StoreInt64(&c.lastWrite, time.Now().UnixNano())
+	}
+}
+
+// collect 将队列中已经排队的帧追加到buf 控制消息优先 返回buf中的帧数
+func (c *connectBucket) collect(buf *[]byte) int {
+	n := 1
+	for len(*buf) < GatewayWriteBytes {
+		select {
+		case b := <-c.controlOut:
+			*buf = append(*buf, b...)
+		default:
+			select {
+			case b := <-c.controlOut:
+				*buf = append(*buf, b...)
+			case b := <-c.out:
+				*buf = append(*buf, b...)
+			default:
+				return n
+			}
+		}
+		n++
+	}
+	return n
+}
+
+// GatewayQueue gateway发送队列的统计
+type GatewayQueue struct {
+	Queued  int    `json:"queued"`  // 当前排队中的帧数
+	Sent    uint64 `json:"sent"`    // 已写出的帧数
+	Dropped uint64 `json:"dropped"` // 队列已满被丢弃的帧数
+}
+
+func (c *connectBucket) queue() GatewayQueue {
+	return GatewayQueue{
+		Queued:  len(c.out) + len(c.controlOut),
+		Sent:    atomic.LoadUint64(&c.sentNum),
+		Dropped: atomic.LoadUint64(&c.droppedNum),
+	}
+}
@@ -0,0 +1,142 @@
+package manager
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	pb "github.com/OSMeteor/firetower/grpc/manager"
+	"github.com/OSMeteor/firetower/socket"
+)
+
+// addStuckGateway 登记一个从不读取数据的gateway 写协程会卡在第一次写入上
+func addStuckGateway(t *testing.T, addr string, topics ...string) *connectBucket {
+	t.Helper()
+	server, client := net.Pipe()
+	bucket := newConnectBucket(server)
+	ConnIndexTable.Store(addr, bucket)
+	go bucket.writeLoop()
+	grpcService.SubscribeTopic(context.Background(), &pb.SubscribeTopicRequest{Topic: topics, Ip: addr})
+	t.Cleanup(func() {
+		client.Close()
+		bucket.close()
+		ConnIndexTable.Delete(addr)
+		grpcService.UnSubscribeTopic(context.Background(), &pb.UnSubscribeTopicRequest{Topic: topics, Ip: addr})
+	})
+	return bucket
+}
+
+func setGatewayQueue(t *testing.T, size int, policy string) {
+	t.Helper()
+	GatewayQueueSize, GatewayOverflowPolicy = size, policy
+	t.Cleanup(func() { GatewayQueueSize, GatewayOverflowPolicy = 4096, OverflowDrop })
+}
+
+func TestSlowGatewayDoesNotBlock(t *testing.T) {
+	setGatewayQueue(t, 2, OverflowDrop)
+	stuck := addStuckGateway(t, "slow", "room_1")
+	g := addFakeGateway(t, "fast", "room_1")
+
+	ctx := context.Background()
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		if _, err := grpcService.Publish(ctx, &pb.PublishRequest{Topic: "room_1", Data: []byte("x")}); err != nil {
+			t.Fatal(err)
+		}
+		g.next(t)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("publishing should not wait for the slow gateway, took %v", d)
+	}
+	if q := stuck.queue(); q.Dropped == 0 || q.Queued != 2 {
+		t.Errorf("slow gateway should queue 2 frames and drop the rest, got %+v", q)
+	}
+}
+
+func TestGatewayOverflowPolicy(t *testing.T) {
+	setGatewayQueue(t, 1, OverflowDrop)
+	// 写协程没有启动 队列不会被消费
+	c := newConnectBucket(&net.TCPConn{})
+	if err := c.write([]byte("a"), false); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.write([]byte("b"), false); err != ErrorGatewayQueueFull {
+		t.Errorf("expected queue full, got %v", err)
+	}
+	if err := c.write([]byte("c"), true); err != nil {
+		t.Errorf("control frames have their own queue: %v", err)
+	}
+
+	server, client := net.Pipe()
+	defer client.Close()
+	GatewayOverflowPolicy = OverflowClose
+	c = newConnectBucket(server)
+	c.write([]byte("a"), false)
+	if err := c.write([]byte("b"), false); err != ErrorGatewayQueueFull {
+		t.Errorf("expected queue full, got %v", err)
+	}
+	if err := c.write([]byte("c"), false); err != ErrorGatewayClosed {
+		t.Errorf("close policy should disconnect the gateway, got %v", err)
+	}
+}
+
+// TestStalledGateway 一个gateway的队列已满时 其他gateway仍然要及时收到每一条推送
+func TestStalledGateway(t *testing.T) {
+	for _, policy := range []string{OverflowDrop, OverflowClose, "unknown"} {
+		t.Run(policy, func(t *testing.T) {
+			setGatewayQueue(t, 1, policy)
+			addStuckGateway(t, "stalled", "room_1")
+			g := addFakeGateway(t, "healthy", "room_1")
+
+			ctx := context.Background()
+			for i := 0; i < 20; i++ {
+				start := time.Now()
+				if _, err := grpcService.Publish(ctx, &pb.PublishRequest{Topic: "room_1", Data: []byte("x")}); err != nil {
+					t.Fatal(err)
+				}
+				g.next(t)
+				if d := time.Since(start); d > 50*time.Millisecond {
+					t.Fatalf("publish %d reached the healthy gateway after %v", i, d)
+				}
+			}
+		})
+	}
+}
+
+func TestGatewayControlFirst(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	c := newConnectBucket(server)
+	defer c.close()
+	push, _ := socket.Enpack(socket.PublishKey, "1", "system", "room_1", []byte("push"))
+	kick, _ := socket.Enpack(socket.OfflineUserKey, "2", "system", AllTopic, []byte("u1"))
+	c.write(push, false)
+	c.write(kick, true)
+	go c.writeLoop()
+
+	frames := make(chan *socket.SendMessage, 2)
+	var (
+		overflow []byte
+		buffer   = make([]byte, 1024)
+	)
+	for len(frames) < 2 {
+		client.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := client.Read(buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		overflow, _ = socket.Depack(append(overflow, buffer[:n]...), frames)
+	}
+	if first := <-frames; first.Type != socket.OfflineUserKey {
+		t.Errorf("control frame should be written first, got %s", first.Type)
+	}
+	// 计数在写入返回之后更新
+	deadline := time.Now().Add(time.Second)
+	for c.queue().Sent != 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if q := c.queue(); q.Sent != 2 || q.Queued != 0 {
+		t.Errorf("unexpected queue stats %+v", q)
+	}
+}
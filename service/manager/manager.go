@@ -1,13 +1,13 @@
 package manager
 
 import (
-	"container/list"
 	"context"
 	"fmt"
 	"io"
 	"net"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"net/http"
@@ -29,8 +29,7 @@ type Manager struct{}
 
 var (
 	// HttpAddress http服务监听端口配置
-	HttpAddress    = ":8000"
-	topicRelevance sync.Map
+	HttpAddress = ":8000"
 	// ConnIndexTable 连接关系索引表
 	ConnIndexTable sync.Map
 
@@ -44,14 +43,88 @@ var (
 	DefaultErrorWriter io.Writer = os.Stderr
 )
 
-type topicRelevanceItem struct {
-	ip   string
-	num  int64
-	conn net.Conn
+type topicGrpcService struct{}
+
+// grpcService grpc接口与http管理接口共用的topic管理服务 订阅关系保存在路由表routes中
+var grpcService = &topicGrpcService{}
+
+// ErrorTopicNotExist topic没有任何订阅关系
+var ErrorTopicNotExist = errors.New("topic not exist")
+
+// ErrorMessageExpired 推送时消息已经过期
+var ErrorMessageExpired = errors.New("message expired")
+
+// topicTargets 返回订阅了topic的gateway连接与grpc订阅流
+func (t *topicGrpcService) topicTargets(topic string) ([]*connectBucket, []*streamSubscriber, bool) {
+	var (
+		gateways []*connectBucket
+		streams  []*streamSubscriber
+	)
+	ok := routes.view(topic, func(r *topicRoute) {
+		for ip := range r.gateways {
+			if c, ok := ConnIndexTable.Load(ip); ok {
+				gateways = append(gateways, c.(*connectBucket))
+			}
+		}
+		for _, s := range r.streams {
+			streams = append(streams, s)
+		}
+	})
+	return gateways, streams, ok
+}
+
+// notifyTopic 向订阅了topic的所有gateway发送一个帧 返回成功入队的gateway数量
+// 推送消息同时会投递给订阅了该topic的grpc订阅流
+func (t *topicGrpcService) notifyTopic(pushType, messageId, source, topic string, data []byte) (int, error) {
+	return t.notifyTopicDeadline(pushType, messageId, source, topic, 0, data)
+}
+
+// notifyTopicDeadline 与notifyTopic相同 帧中携带消息的过期时间(unix毫秒) gateway会丢弃过期的消息
+func (t *topicGrpcService) notifyTopicDeadline(pushType, messageId, source, topic string, deadline int64, data []byte) (int, error) {
+	b, err := socket.EnpackDeadline(pushType, messageId, source, topic, deadline, data)
+	if err != nil {
+		return 0, err
+	}
+	gateways, streams, ok := t.topicTargets(topic)
+	if !ok {
+		// topic 没有存在订阅列表中直接过滤
+		return 0, ErrorTopicNotExist
+	}
+	if pushType == socket.PublishKey {
+		markPublish(topic)
+		if len(streams) > 0 {
+			message := &pb.PushMessage{Topic: topic, Data: data, MessageId: messageId, Source: source}
+			for _, s := range streams {
+				s.push(message)
+			}
+		}
+	}
+	return writeGateways(gateways, b, socket.IsControl(pushType)), nil
+}
+
+// notifyAll 向所有已连接的gateway发送一个帧 用于不依赖topic的控制消息
+func notifyAll(pushType, messageId, source, topic string, data []byte) (int, error) {
+	b, err := socket.Enpack(pushType, messageId, source, topic, data)
+	if err != nil {
+		return 0, err
+	}
+	var gateways []*connectBucket
+	ConnIndexTable.Range(func(key, value interface{}) bool {
+		gateways = append(gateways, value.(*connectBucket))
+		return true
+	})
+	return writeGateways(gateways, b, socket.IsControl(pushType)), nil
 }
 
-type topicGrpcService struct {
-	mu sync.RWMutex
+// writeGateways 将帧放入各gateway的发送队列 返回成功入队的gateway数量
+func writeGateways(gateways []*connectBucket, b []byte, control bool) int {
+	var n int
+	for _, c := range gateways {
+		if c.write(b, control) == nil {
+			n++
+		}
+	}
+	return n
 }
 
 // Publish 推送的grpc接口
@@ -59,39 +132,24 @@ type topicGrpcService struct {
 // 接收 Topic 话题
 //     Data  传输内容
 //     MessageId gateway 来源的消息id
+//     Ttl Deadline 消息的有效期与过期时间
 func (t *topicGrpcService) Publish(ctx context.Context, request *pb.PublishRequest) (*pb.PublishResponse, error) {
 	Logger("INFO", fmt.Sprintf("new message: %s", string(request.Data)))
 
-	value, ok := topicRelevance.Load(request.Topic)
-	if !ok {
-		// topic 没有存在订阅列表中直接过滤
-		return &pb.PublishResponse{Ok: false}, errors.New("topic not exist")
+	deadline := messageDeadline(request.Ttl, request.Deadline, time.Now())
+	if deadline < 0 {
+		return &pb.PublishResponse{Ok: false}, ErrorMessageExpired
 	}
-
-	table := value.(*list.List)
-	t.mu.Lock()
-	for e := table.Front(); e != nil; e = e.Next() {
-		c, ok := ConnIndexTable.Load(e.Value.(*topicRelevanceItem).ip)
-		if ok {
-			b, err := socket.Enpack(socket.PublishKey, request.MessageId, request.Source, request.Topic, request.Data)
-			if err != nil {
-
-			}
-			_, err = c.(*connectBucket).conn.Write(b)
-			if err != nil {
-				c.(*connectBucket).close()
-			}
-		}
+	if _, err := t.notifyTopicDeadline(socket.PublishKey, request.MessageId, request.Source, request.Topic, deadline, request.Data); err != nil {
+		return &pb.PublishResponse{Ok: false}, err
 	}
-	t.mu.Unlock()
 
 	return &pb.PublishResponse{Ok: true}, nil
 }
 
 // CheckTopicExist 检测topic是否已经存在订阅关系
 func (t *topicGrpcService) CheckTopicExist(ctx context.Context, request *pb.CheckTopicExistRequest) (*pb.CheckTopicExistResponse, error) {
-	_, ok := topicRelevance.Load(request.Topic)
-	if !ok {
+	if !routes.exists(request.Topic) {
 		// topic 没有存在订阅列表中直接过滤
 		return &pb.CheckTopicExistResponse{Ok: false}, nil
 	}
@@ -100,92 +158,90 @@ func (t *topicGrpcService) CheckTopicExist(ctx context.Context, request *pb.Chec
 
 // GetConnectNum 获取topic订阅数的grpc接口
 func (t *topicGrpcService) GetConnectNum(ctx context.Context, request *pb.GetConnectNumRequest) (*pb.GetConnectNumResponse, error) {
-	value, ok := topicRelevance.Load(request.Topic)
-	var num int64
-	if ok {
-		t.mu.RLock()
-		l, _ := value.(*list.List)
-		num = getConnectNum(l)
-		t.mu.RUnlock()
-	}
-
-	return &pb.GetConnectNumResponse{Number: num}, nil
+	return &pb.GetConnectNumResponse{Number: getConnectNum(request.Topic)}, nil
 }
 
-func getConnectNum(l *list.List) int64 {
+// getConnectNum topic的订阅总数 topic不存在时为0
+func getConnectNum(topic string) int64 {
 	var num int64
-	for e := l.Front(); e != nil; e = e.Next() {
-		num += e.Value.(*topicRelevanceItem).num
-	}
+	routes.view(topic, func(r *topicRoute) {
+		num = r.connectNum()
+	})
 	return num
 }
 
 // SubscribeTopic 订阅topic的grpc接口
 func (t *topicGrpcService) SubscribeTopic(ctx context.Context, request *pb.SubscribeTopicRequest) (*pb.SubscribeTopicResponse, error) {
-	t.mu.Lock()
-	defer t.mu.Unlock()
-	for _, topic := range request.Topic {
-		var store *list.List
-		value, ok := topicRelevance.Load(topic)
-
-		if !ok {
-			// topic map 里面维护一个链表
-			store = list.New()
-			store.PushBack(&topicRelevanceItem{
-				ip:  request.Ip,
-				num: 1,
-			})
-			topicRelevance.Store(topic, store)
-		} else {
-			store = value.(*list.List)
-			var found bool
-			for e := store.Front(); e != nil; e = e.Next() {
-				if e.Value.(*topicRelevanceItem).ip == request.Ip {
-					e.Value.(*topicRelevanceItem).num++
-					found = true
-					break
-				}
-			}
-			if !found {
-				store.PushBack(&topicRelevanceItem{
-					ip:  request.Ip,
-					num: 1,
-				})
-			}
-		}
-	}
+	routes.subscribe(request.Ip, request.Topic)
 	return &pb.SubscribeTopicResponse{}, nil
 }
 
 // UnSubscribeTopic 取消订阅topic的grpc接口
 func (t *topicGrpcService) UnSubscribeTopic(ctx context.Context, request *pb.UnSubscribeTopicRequest) (*pb.UnSubscribeTopicResponse, error) {
-	t.mu.Lock()
-	defer t.mu.Unlock()
-	for _, topic := range request.Topic {
-		value, ok := topicRelevance.Load(topic)
+	routes.unsubscribe(request.Ip, request.Topic)
+	return &pb.UnSubscribeTopicResponse{}, nil
+}
 
-		if !ok {
-			// topic 没有存在订阅列表中直接过滤
-			continue
-		} else {
-			store := value.(*list.List)
-			for e := store.Front(); e != nil; e = e.Next() {
-				if e.Value.(*topicRelevanceItem).ip == request.Ip {
-					if e.Value.(*topicRelevanceItem).num-1 == 0 {
-						store.Remove(e)
-						if store.Len() == 0 {
-							topicRelevance.Delete(topic)
-						}
-					} else {
-						// 这里修改是直接修改map内部值
-						e.Value.(*topicRelevanceItem).num--
-					}
-					break
-				}
-			}
-		}
+// kickUser 将用户踢下线 topic为空时通知所有gateway
+func (t *topicGrpcService) kickUser(userId, topic string) (int, error) {
+	if userId == "" {
+		return 0, errors.New("user id is empty")
 	}
-	return &pb.UnSubscribeTopicResponse{}, nil
+	if topic == "" || topic == AllTopic {
+		return notifyAll(socket.OfflineUserKey, "0", "system", AllTopic, []byte(userId))
+	}
+	return t.notifyTopic(socket.OfflineUserKey, "0", "system", topic, []byte(userId))
+}
+
+// removeTopic 移除topic在所有gateway上的订阅关系
+func (t *topicGrpcService) removeTopic(topic string) (int, error) {
+	if topic == "" {
+		return 0, errors.New("topic is empty")
+	}
+	return t.notifyTopic(socket.OfflineTopicKey, "0", "system", topic, []byte{})
+}
+
+// unsubscribeUser 让用户退订某个topic
+func (t *topicGrpcService) unsubscribeUser(topic, userId string) (int, error) {
+	if topic == "" || userId == "" {
+		return 0, errors.New("topic and user id are required")
+	}
+	return t.notifyTopic(socket.OfflineTopicByUserIdKey, "0", "system", topic, []byte(userId))
+}
+
+// controlResult topic不存在时没有gateway需要通知 不视为错误
+func controlResult(n int, err error) (int64, error) {
+	if err == ErrorTopicNotExist {
+		return 0, nil
+	}
+	return int64(n), err
+}
+
+// KickUser 将用户踢下线的grpc接口 返回收到通知的gateway数量
+func (t *topicGrpcService) KickUser(ctx context.Context, request *pb.KickUserRequest) (*pb.KickUserResponse, error) {
+	n, err := controlResult(t.kickUser(request.UserId, request.Topic))
+	if err != nil {
+		return nil, err
+	}
+	return &pb.KickUserResponse{Gateways: n}, nil
+}
+
+// RemoveTopic 移除topic所有订阅关系的grpc接口 返回收到通知的gateway数量
+func (t *topicGrpcService) RemoveTopic(ctx context.Context, request *pb.RemoveTopicRequest) (*pb.RemoveTopicResponse, error) {
+	n, err := controlResult(t.removeTopic(request.Topic))
+	if err != nil {
+		return nil, err
+	}
+	return &pb.RemoveTopicResponse{Gateways: n}, nil
+}
+
+// UnsubscribeUser 让用户退订topic的grpc接口 返回收到通知的gateway数量
+func (t *topicGrpcService) UnsubscribeUser(ctx context.Context, request *pb.UnsubscribeUserRequest) (*pb.UnsubscribeUserResponse, error) {
+	n, err := controlResult(t.unsubscribeUser(request.Topic, request.UserId))
+	if err != nil {
+		return nil, err
+	}
+	return &pb.UnsubscribeUserResponse{Gateways: n}, nil
 }
 
 // StartGrpcService 启动grpc服务
@@ -197,17 +253,25 @@ func (m *Manager) StartGrpcService(port string) {
 		panic(fmt.Sprintf("grpc service listen error: %v", err))
 	}
 	s := grpc.NewServer()
-	pb.RegisterTopicServiceServer(s, &topicGrpcService{})
+	pb.RegisterTopicServiceServer(s, grpcService)
 	s.Serve(lis)
 }
 
 type connectBucket struct {
-	overflow   []byte
-	packetChan chan *socket.SendMessage
-	conn       net.Conn
-	isClose    bool
-	closeChan  chan struct{}
-	mu         sync.Mutex
+	overflow    []byte
+	packetChan  chan *socket.SendMessage
+	controlChan chan *socket.SendMessage // 踢人等控制消息 优先于packetChan处理
+	out         chan []byte              // 待写出的推送帧 由writeLoop写出
+	controlOut  chan []byte              // 待写出的控制帧 优先于out写出
+	conn        net.Conn
+	isClose     bool
+	closeChan   chan struct{}
+	mu          sync.Mutex
+	connectedAt int64  // unix nano
+	lastRead    int64  // unix nano 原子操作
+	lastWrite   int64  // unix nano 原子操作
+	sentNum     uint64 // 已写出的帧数 原子操作
+	droppedNum  uint64 // 发送队列已满被丢弃的帧数 原子操作
 }
 
 // StartSocketService 启动tcp服务
@@ -225,14 +289,9 @@ func (m *Manager) StartSocketService(addr string) {
 			Logger("ERROR", fmt.Sprintf("tcp service accept error: %v", err))
 			continue
 		}
-		bucket := &connectBucket{
-			overflow:   make([]byte, 0),
-			packetChan: make(chan *socket.SendMessage, 1024),
-			conn:       conn,
-			isClose:    false,
-			closeChan:  make(chan struct{}),
-		}
+		bucket := newConnectBucket(conn)
 		bucket.relation()     // 建立连接关系
+		go bucket.writeLoop() // 写出发往该gateway的帧
 		go bucket.sendLoop()  // 发包
 		go bucket.handler()   // 接收字节流并解包
 		go bucket.heartbeat() // 心跳
@@ -269,19 +328,9 @@ func (c *connectBucket) relation() {
 	}
 }
 
+// delRelation 移除该gateway的所有订阅关系
 func (c *connectBucket) delRelation() {
-	topicRelevance.Range(func(key, value interface{}) bool {
-		store, _ := value.(*list.List)
-		for e := store.Front(); e != nil; e = e.Next() {
-			if e.Value.(*topicRelevanceItem).ip == c.conn.RemoteAddr().String() {
-				store.Remove(e)
-			}
-		}
-		if store.Len() == 0 {
-			topicRelevance.Delete(key)
-		}
-		return true
-	})
+	routes.removeGateway(c.conn.RemoteAddr().String())
 }
 
 func (c *connectBucket) close() {
@@ -291,10 +340,28 @@ func (c *connectBucket) close() {
 		close(c.closeChan)
 		c.conn.Close()
 		c.delRelation() // 删除topic绑定关系
+		ConnIndexTable.CompareAndDelete(c.conn.RemoteAddr().String(), c) // 断开的gateway不再出现在连接索引中
 	}
 	c.mu.Unlock()
 }
 
+// closed gateway连接是否已经断开
+func (c *connectBucket) closed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.isClose
+}
+
+// rangeGateways 遍历连接索引中仍然连接着的gateway
+func rangeGateways(fn func(addr string, c *connectBucket)) {
+	ConnIndexTable.Range(func(key, value interface{}) bool {
+		if c := value.(*connectBucket); !c.closed() {
+			fn(key.(string), c)
+		}
+		return true
+	})
+}
+
 func (c *connectBucket) handler() {
 	defer func() {
 		if err := recover(); err != nil {
@@ -309,7 +376,8 @@ func (c *connectBucket) handler() {
 			c.close()
 			return
 		}
-		c.overflow, err = socket.Depack(append(c.overflow, buffer[:l]...), c.packetChan)
+		atomic.StoreInt64(&c.lastRead, time.Now().UnixNano())
+		c.overflow, err = socket.DepackPriority(append(c.overflow, buffer[:l]...), c.packetChan, c.controlChan)
 		if err != nil {
 			Logger("ERROR", err.Error())
 		}
@@ -324,39 +392,38 @@ func (c *connectBucket) sendLoop() {
 		}
 	}()
 	for {
+		// 控制消息优先 推送积压时踢人等操作也能立即转发
+		select {
+		case message := <-c.controlChan:
+			c.notify(message)
+			continue
+		default:
+		}
 		select {
+		case message := <-c.controlChan:
+			c.notify(message)
 		case message := <-c.packetChan:
-
-			value, ok := topicRelevance.Load(message.Topic)
-			if !ok {
-				// topic 没有存在订阅列表中直接过滤
-				continue
-			} else {
-				table := value.(*list.List)
-				for e := table.Front(); e != nil; e = e.Next() {
-					bucket, ok := ConnIndexTable.Load(e.Value.(*topicRelevanceItem).ip)
-					if ok {
-						bytes, err := socket.Enpack(message.Type, message.Context.Id, message.Context.Source, message.Topic, message.Data)
-						if err != nil {
-							Logger("ERROR", fmt.Sprintf("protocol 封包时错误，%v", err))
-						}
-						_, err = bucket.(*connectBucket).conn.Write(bytes)
-						if err != nil {
-							// 直接操作table.Remove 可以改变map中list的值
-							bucket.(*connectBucket).close()
-							return
-						}
-					}
-				}
-			}
-			message.Info("topic manager sended")
-			message.Recycling()
+			c.notify(message)
 		case <-c.closeChan:
 			return
 		}
 	}
 }
 
+// notify 将gateway发来的消息转发给订阅了该topic的gateway
+func (c *connectBucket) notify(message *socket.SendMessage) {
+	if message.Expired(time.Now()) {
+		message.Info("topic manager expired")
+		message.Recycling()
+		return
+	}
+	if _, err := grpcService.notifyTopicDeadline(message.Type, message.Context.Id, message.Context.Source, message.Topic, message.Deadline, message.Data); err != nil && err != ErrorTopicNotExist {
+		Logger("ERROR", fmt.Sprintf("protocol 封包时错误，%v", err))
+	}
+	message.Info("topic manager sended")
+	message.Recycling()
+}
+
 func (c *connectBucket) heartbeat() {
 	defer func() {
 		if err := recover(); err != nil {
@@ -364,15 +431,13 @@ func (c *connectBucket) heartbeat() {
 			c.close()
 		}
 	}()
-	t := time.NewTicker(10 * time.Second)
+	t := time.NewTicker(heartbeatInterval)
 	// 心跳包内容固定 所以只用封包一次 直接用封好的包发送就可以了
 	// 服务器间心跳时间应该短一些，以便及时获取连接状态
 	b, _ := socket.Enpack("heartbeat", "0", "system", "*", []byte("heartbeat"))
 	for {
 		<-t.C
-		_, err := c.conn.Write(b)
-		if err != nil {
-			c.close()
+		if err := c.write(b, true); err == ErrorGatewayClosed {
 			return
 		}
 	}
@@ -381,8 +446,16 @@ func (c *connectBucket) heartbeat() {
 // web service
 // Response webservice 返回数据结构体
 type Response struct {
-	Meta *Meta  `json:"meta"`
-	Data string `json:"data"`
+	Meta *Meta       `json:"meta"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+// writeJSON 以Response结构返回json data直接作为json对象输出
+func writeJSON(w http.ResponseWriter, status, code int, err string, data interface{}) {
+	b, _ := json.Marshal(&Response{Meta: &Meta{Code: code, Error: err}, Data: data})
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(b)
 }
 
 // Meta http response 状态标识
@@ -411,53 +484,26 @@ func (c topics) Less(i, j int) bool {
 
 // HttpDashboard  dashboard http 服务
 func HttpDashboard() {
-	// http.HandleFunc("/", Dashboard)
+	// dashboard与统计接口默认需要AdminToken 设置PublicStats后公开
+	http.HandleFunc("/", statsAuth(Dashboard))
+	http.HandleFunc("/dashboard/stats", statsAuth(dashboardStatsHandler))
 	http.HandleFunc("/topic", topicWebHandler)
+	registerTopicHandlers(http.DefaultServeMux)
+	registerAdminHandlers(http.DefaultServeMux) // 需要设置AdminToken才可用
 	http.ListenAndServe(HttpAddress, nil)
 }
 
-// func Dashboard(w http.ResponseWriter, r *http.Request) {
-//	 w.Header().Set("Content-Type", "text/html; charset=utf-8")
-//	 w.WriteHeader(200)
-//	 template.ParseFiles("")
-// }
-
 // TopicWebHandler 获取topic相关统计信息
 func topicWebHandler(w http.ResponseWriter, r *http.Request) {
 	var topicSlice topics
-	topicRelevance.Range(func(key, value interface{}) bool {
-		var t = new(TopicWebRes)
-		t.Title = key.(string)
-		value, ok := topicRelevance.Load(t.Title)
-		var num int64
-		if ok {
-			l, _ := value.(*list.List)
-			num = getConnectNum(l)
-		}
-		t.ConnectNum = num
-		topicSlice = append(topicSlice, t)
+	routes.rangeTopics(func(topic string, r *topicRoute) bool {
+		topicSlice = append(topicSlice, &TopicWebRes{Title: topic, ConnectNum: r.connectNum()})
 		return true
 	})
 
 	sort.Sort(topicSlice)
-	res, err := json.Marshal(topicSlice)
-	response := new(Response)
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	if err != nil {
-		w.WriteHeader(500)
-		meta := &Meta{
-			Code:  5001,
-			Error: err.Error(),
-		}
-		response.Meta = meta
-	} else {
-		meta := &Meta{
-			Code:  0,
-			Error: "",
-		}
-		response.Meta = meta
-		response.Data = string(res)
+	if topicSlice == nil {
+		topicSlice = topics{}
 	}
-	bytes, _ := json.Marshal(response)
-	w.Write(bytes)
+	writeJSON(w, http.StatusOK, 0, "", topicSlice)
 }
@@ -0,0 +1,48 @@
+package manager
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/OSMeteor/firetower/grpc/manager"
+	"github.com/OSMeteor/firetower/socket"
+)
+
+func TestGrpcControl(t *testing.T) {
+	g1 := addFakeGateway(t, "gw1", "room_1")
+	g2 := addFakeGateway(t, "gw2", "room_2")
+	ctx := context.Background()
+
+	kick, err := grpcService.KickUser(ctx, &pb.KickUserRequest{UserId: "u1"})
+	if err != nil || kick.Gateways != 2 {
+		t.Fatalf("kick without topic should reach every gateway: %v %v", kick, err)
+	}
+	for _, g := range []*fakeGateway{g1, g2} {
+		if frame := g.next(t); frame.Type != socket.OfflineUserKey || string(frame.Data) != "u1" {
+			t.Errorf("unexpected kick frame %s %q", frame.Type, frame.Data)
+		}
+	}
+
+	kick, _ = grpcService.KickUser(ctx, &pb.KickUserRequest{UserId: "u1", Topic: "room_2"})
+	if frame := g2.next(t); kick.Gateways != 1 || frame.Topic != "room_2" {
+		t.Errorf("kick by topic should only reach gw2: %d %s", kick.Gateways, frame.Topic)
+	}
+
+	unsub, err := grpcService.UnsubscribeUser(ctx, &pb.UnsubscribeUserRequest{Topic: "room_1", UserId: "u1"})
+	if frame := g1.next(t); err != nil || unsub.Gateways != 1 || frame.Type != socket.OfflineTopicByUserIdKey {
+		t.Errorf("unexpected unsubscribe %v %v %s", unsub, err, frame.Type)
+	}
+
+	remove, err := grpcService.RemoveTopic(ctx, &pb.RemoveTopicRequest{Topic: "nobody"})
+	if err != nil || remove.Gateways != 0 {
+		t.Errorf("removing an unknown topic should notify nobody: %v %v", remove, err)
+	}
+	remove, _ = grpcService.RemoveTopic(ctx, &pb.RemoveTopicRequest{Topic: "room_2"})
+	if frame := g2.next(t); remove.Gateways != 1 || frame.Type != socket.OfflineTopicKey {
+		t.Errorf("unexpected remove %v %s", remove, frame.Type)
+	}
+
+	if _, err := grpcService.KickUser(ctx, &pb.KickUserRequest{}); err == nil {
+		t.Error("kick without user id should fail")
+	}
+}
@@ -0,0 +1,126 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	pb "github.com/OSMeteor/firetower/grpc/manager"
+	"github.com/OSMeteor/firetower/socket"
+)
+
+// gatewayBatch 批量推送中发往同一个gateway的帧
+type gatewayBatch struct {
+	conn    *connectBucket
+	frames  []byte
+	results []*pb.PublishResult // 包含在frames中的消息
+}
+
+// messageDeadline 根据有效期(毫秒)与过期时间(unix毫秒)计算消息的过期时间 同时设置时取较早者
+// 返回0表示不过期 返回-1表示消息在推送前已经过期
+func messageDeadline(ttl, deadline int64, now time.Time) int64 {
+	if ttl > 0 {
+		if d := now.UnixMilli() + ttl; deadline <= 0 || d < deadline {
+			deadline = d
+		}
+	}
+	if deadline <= 0 {
+		return 0
+	}
+	if deadline <= now.UnixMilli() {
+		return -1
+	}
+	return deadline
+}
+
+// publishBatch 批量推送 每个gateway的帧合并后只入队一次
+// topic没有订阅者不视为失败 结果中Gateways为0
+// 部分gateway入队失败时计入Failed 只有所有gateway都失败时Ok才为false 避免调用方重推已经送达的消息
+func (t *topicGrpcService) publishBatch(messages []*pb.PublishRequest) []*pb.PublishResult {
+	var (
+		results = make([]*pb.PublishResult, 0, len(messages))
+		batches = make(map[*connectBucket]*gatewayBatch)
+		order   []*gatewayBatch
+		now     = time.Now()
+	)
+	for _, m := range messages {
+		res := &pb.PublishResult{Topic: m.GetTopic(), MessageId: m.GetMessageId()}
+		results = append(results, res)
+		if m == nil || m.Topic == "" {
+			res.Error = "topic is empty"
+			continue
+		}
+		deadline := messageDeadline(m.Ttl, m.Deadline, now)
+		if deadline < 0 {
+			res.Error = ErrorMessageExpired.Error()
+			continue
+		}
+		b, err := socket.EnpackDeadline(socket.PublishKey, m.MessageId, m.Source, m.Topic, deadline, m.Data)
+		if err != nil {
+			res.Error = err.Error()
+			continue
+		}
+		res.Ok = true
+		gateways, streams, ok := t.topicTargets(m.Topic)
+		if !ok {
+			continue
+		}
+		markPublish(m.Topic)
+		if len(streams) > 0 {
+			message := &pb.PushMessage{Topic: m.Topic, Data: m.Data, MessageId: m.MessageId, Source: m.Source}
+			for _, s := range streams {
+				s.push(message)
+			}
+		}
+		for _, g := range gateways {
+			batch, ok := batches[g]
+			if !ok {
+				batch = &gatewayBatch{conn: g}
+				batches[g] = batch
+				order = append(order, batch)
+			}
+			batch.frames = append(batch.frames, b...)
+			batch.results = append(batch.results, res)
+		}
+	}
+
+	for _, batch := range order {
+		if err := batch.conn.write(batch.frames, false); err != nil {
+			for _, res := range batch.results {
+				res.Failed++
+				res.Error = fmt.Sprintf("queue to gateway failed: %v", err)
+			}
+			continue
+		}
+		for _, res := range batch.results {
+			res.Gateways++
+		}
+	}
+	for _, res := range results {
+		if res.Failed > 0 && res.Gateways == 0 {
+			res.Ok = false
+		}
+	}
+	return results
+}
+
+// PublishBatch 批量推送的grpc接口 结果与请求中的消息一一对应
+func (t *topicGrpcService) PublishBatch(ctx context.Context, request *pb.PublishBatchRequest) (*pb.PublishBatchResponse, error) {
+	return &pb.PublishBatchResponse{Results: t.publishBatch(request.Messages)}, nil
+}
+
+// Multicast 将同一内容推送到多个topic的grpc接口 结果与请求中的topic一一对应
+func (t *topicGrpcService) Multicast(ctx context.Context, request *pb.MulticastRequest) (*pb.PublishBatchResponse, error) {
+	messages := make([]*pb.PublishRequest, 0, len(request.Topic))
+	for _, topic := range request.Topic {
+		messages = append(messages, &pb.PublishRequest{
+			Topic:     topic,
+			Data:      request.Data,
+			MessageId: request.MessageId,
+			Source:    request.Source,
+			Ttl:       request.Ttl,
+			Deadline:  request.Deadline,
+		})
+	}
+	return &pb.PublishBatchResponse{Results: t.publishBatch(messages)}, nil
+}
@@ -0,0 +1,147 @@
+package manager
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/OSMeteor/firetower/grpc/manager"
+)
+
+// countingConn 统计Write的调用次数
+type countingConn struct {
+	net.Conn
+	writes int32
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	atomic.AddInt32(&c.writes, 1)
+	return c.Conn.Write(b)
+}
+
+func countWrites(addr string) *countingConn {
+	value, _ := ConnIndexTable.Load(addr)
+	bucket := value.(*connectBucket)
+	c := &countingConn{Conn: bucket.conn}
+	bucket.conn = c
+	return c
+}
+
+func TestPublishBatch(t *testing.T) {
+	g1 := addFakeGateway(t, "gw1", "room_1", "room_2")
+	g2 := addFakeGateway(t, "gw2", "room_2")
+	c1, c2 := countWrites("gw1"), countWrites("gw2")
+
+	res, err := grpcService.PublishBatch(context.Background(), &pb.PublishBatchRequest{Messages: []*pb.PublishRequest{
+		{Topic: "room_1", Data: []byte("a"), MessageId: "1"},
+		{Topic: "room_2", Data: []byte("b"), MessageId: "2"},
+		{Topic: "nobody", Data: []byte("c"), MessageId: "3"},
+		{Topic: "", Data: []byte("d"), MessageId: "4"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		ok       bool
+		gateways int64
+	}{{true, 1}, {true, 2}, {true, 0}, {false, 0}}
+	for i, w := range want {
+		if r := res.Results[i]; r.Ok != w.ok || r.Gateways != w.gateways {
+			t.Errorf("result %d: got ok=%v gateways=%d error=%q", i, r.Ok, r.Gateways, r.Error)
+		}
+	}
+	if a, b := g1.next(t), g1.next(t); string(a.Data) != "a" || string(b.Data) != "b" {
+		t.Errorf("gw1 should receive frames in order, got %q %q", a.Data, b.Data)
+	}
+	if frame := g2.next(t); frame.Context.Id != "2" {
+		t.Errorf("unexpected frame on gw2 %s", frame.Context.Id)
+	}
+	if w1, w2 := atomic.LoadInt32(&c1.writes), atomic.LoadInt32(&c2.writes); w1 != 1 || w2 != 1 {
+		t.Errorf("each gateway should be written once, got %d %d", w1, w2)
+	}
+}
+
+// TestPublishBatchPartialFailure 部分gateway入队失败时 已经送达的消息仍然是Ok
+func TestPublishBatchPartialFailure(t *testing.T) {
+	g1 := addFakeGateway(t, "gw1", "room_1")
+	addFakeGateway(t, "gw2", "room_1", "room_2")
+	value, _ := ConnIndexTable.Load("gw2")
+	value.(*connectBucket).close()
+
+	res, _ := grpcService.PublishBatch(context.Background(), &pb.PublishBatchRequest{Messages: []*pb.PublishRequest{
+		{Topic: "room_1", Data: []byte("a"), MessageId: "1"},
+		{Topic: "room_2", Data: []byte("b"), MessageId: "2"},
+	}})
+	if r := res.Results[0]; !r.Ok || r.Gateways != 1 || r.Failed != 1 {
+		t.Errorf("message queued to gw1 should be ok, got ok=%v gateways=%d failed=%d", r.Ok, r.Gateways, r.Failed)
+	}
+	if r := res.Results[1]; r.Ok || r.Gateways != 0 || r.Failed != 1 || r.Error == "" {
+		t.Errorf("message without any gateway should fail, got ok=%v gateways=%d failed=%d error=%q", r.Ok, r.Gateways, r.Failed, r.Error)
+	}
+	if frame := g1.next(t); string(frame.Data) != "a" {
+		t.Errorf("unexpected frame on gw1 %q", frame.Data)
+	}
+}
+
+func TestMulticast(t *testing.T) {
+	g1 := addFakeGateway(t, "gw1", "room_1", "room_2")
+	c1 := countWrites("gw1")
+
+	res, _ := grpcService.Multicast(context.Background(), &pb.MulticastRequest{Topic: []string{"room_1", "room_2"}, Data: []byte("x"), MessageId: "9", Source: "job"})
+	if len(res.Results) != 2 || !res.Results[0].Ok || res.Results[1].Topic != "room_2" {
+		t.Fatalf("unexpected results %v", res.Results)
+	}
+	for _, topic := range []string{"room_1", "room_2"} {
+		if frame := g1.next(t); frame.Topic != topic || frame.Context.Source != "job" || string(frame.Data) != "x" {
+			t.Errorf("unexpected frame %s %s %q", frame.Topic, frame.Context.Source, frame.Data)
+		}
+	}
+	if w := atomic.LoadInt32(&c1.writes); w != 1 {
+		t.Errorf("multicast should write gw1 once, got %d", w)
+	}
+}
+
+func TestMessageDeadline(t *testing.T) {
+	now := time.UnixMilli(1000000)
+	cases := []struct {
+		ttl, deadline, want int64
+	}{
+		{0, 0, 0},
+		{500, 0, 1000500},
+		{0, 1000200, 1000200},
+		{500, 1000200, 1000200},
+		{100, 1000200, 1000100},
+		{0, 999999, -1},
+	}
+	for _, c := range cases {
+		if got := messageDeadline(c.ttl, c.deadline, now); got != c.want {
+			t.Errorf("messageDeadline(%d, %d) = %d, want %d", c.ttl, c.deadline, got, c.want)
+		}
+	}
+}
+
+func TestPublishTTL(t *testing.T) {
+	g := addFakeGateway(t, "gw1", "ticks")
+
+	_, err := grpcService.Publish(context.Background(), &pb.PublishRequest{Topic: "ticks", Data: []byte("old"), Deadline: time.Now().Add(-time.Second).UnixMilli()})
+	if err != ErrorMessageExpired {
+		t.Errorf("expected ErrorMessageExpired, got %v", err)
+	}
+	res, _ := grpcService.PublishBatch(context.Background(), &pb.PublishBatchRequest{Messages: []*pb.PublishRequest{
+		{Topic: "ticks", Data: []byte("stale"), Deadline: 1},
+		{Topic: "ticks", Data: []byte("fresh"), Ttl: 60000},
+	}})
+	if res.Results[0].Ok || res.Results[0].Error != ErrorMessageExpired.Error() || !res.Results[1].Ok {
+		t.Errorf("unexpected results %v", res.Results)
+	}
+
+	frame := g.next(t)
+	if string(frame.Data) != "fresh" || frame.Topic != "ticks" {
+		t.Fatalf("only the fresh message should be sent, got %q", frame.Data)
+	}
+	if left := time.Until(time.UnixMilli(frame.Deadline)); left <= 0 || left > time.Minute {
+		t.Errorf("frame should carry the deadline, got %d", frame.Deadline)
+	}
+}
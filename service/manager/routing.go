@@ -0,0 +1,304 @@
+package manager
+
+import (
+	"sync"
+)
+
+// topic路由表
+// topic按哈希分散到routeShardNum个分片 每个分片一把读写锁 订阅、退订与推送只锁topic所在的分片
+// 每个topic记录 gateway地址 -> 该gateway上的订阅数 以及订阅了该topic的grpc订阅流
+// 同时维护 gateway -> topic 的反向索引 gateway断开时只需要清理它订阅过的topic
+
+// routeShardNum 路由表的分片数 必须是2的幂
+const routeShardNum = 64
+
+// topicRoute 一个topic的订阅者
+type topicRoute struct {
+	gateways map[string]int64             // gateway地址 -> 订阅数
+	streams  map[string]*streamSubscriber // 订阅流id -> 订阅流 每个订阅流计为一个订阅
+}
+
+// connectNum topic的订阅总数
+func (r *topicRoute) connectNum() int64 {
+	num := int64(len(r.streams))
+	for _, n := range r.gateways {
+		num += n
+	}
+	return num
+}
+
+func (r *topicRoute) empty() bool {
+	return len(r.gateways) == 0 && len(r.streams) == 0
+}
+
+type routeShard struct {
+	mu     sync.RWMutex
+	topics map[string]*topicRoute
+}
+
+// gatewayTopics gateway订阅过的topic 在持有topic所在分片的锁时更新
+type gatewayTopics struct {
+	mu      sync.Mutex
+	topics  map[string]struct{}
+	removed bool // 已被removeGateway从索引中摘除 之后的订阅不能再记录在这里
+}
+
+type routeTable struct {
+	shards [routeShardNum]routeShard
+
+	indexMu sync.RWMutex
+	index   map[string]*gatewayTopics // gateway地址 -> 订阅过的topic
+}
+
+// routes 当前的topic路由表
+var routes = newRouteTable()
+
+func newRouteTable() *routeTable {
+	t := &routeTable{index: make(map[string]*gatewayTopics)}
+	for i := range t.shards {
+		t.shards[i].topics = make(map[string]*topicRoute)
+	}
+	return t
+}
+
+// shard topic所在的分片 FNV-1a
+func (t *routeTable) shard(topic string) *routeShard {
+	h := uint32(2166136261)
+	for i := 0; i < len(topic); i++ {
+		h ^= uint32(topic[i])
+		h *= 16777619
+	}
+	return &t.shards[h&(routeShardNum-1)]
+}
+
+// gatewayIndex 返回gateway的反向索引 create为false且不存在时返回nil
+func (t *routeTable) gatewayIndex(ip string, create bool) *gatewayTopics {
+	t.indexMu.RLock()
+	g := t.index[ip]
+	t.indexMu.RUnlock()
+	if g != nil || !create {
+		return g
+	}
+	t.indexMu.Lock()
+	if g = t.index[ip]; g == nil {
+		g = &gatewayTopics{topics: make(map[string]struct{})}
+		t.index[ip] = g
+	}
+	t.indexMu.Unlock()
+	return g
+}
+
+// subscribe gateway上的topic订阅数加一
+func (t *routeTable) subscribe(ip string, topics []string) {
+	var g *gatewayTopics
+	for _, topic := range topics {
+		s := t.shard(topic)
+		s.mu.Lock()
+		r, ok := s.topics[topic]
+		if !ok {
+			r = &topicRoute{gateways: make(map[string]int64, 1)}
+			s.topics[topic] = r
+		}
+		if r.gateways[ip]++; r.gateways[ip] == 1 {
+			if g == nil {
+				g = t.gatewayIndex(ip, true)
+			}
+			g.mu.Lock()
+			if g.removed {
+				// gateway在订阅过程中被移除 撤销这次订阅 否则路由会留在表中且不再被清理
+				delete(r.gateways, ip)
+				if r.empty() {
+					t.deleteTopic(s, topic)
+				}
+			} else {
+				g.topics[topic] = struct{}{}
+			}
+			g.mu.Unlock()
+		}
+		s.mu.Unlock()
+	}
+}
+
+// unsubscribe gateway上的topic订阅数减一 减到0时移除该gateway 没有订阅者时删除topic
+func (t *routeTable) unsubscribe(ip string, topics []string) {
+	var g *gatewayTopics
+	for _, topic := range topics {
+		s := t.shard(topic)
+		s.mu.Lock()
+		r, ok := s.topics[topic]
+		if !ok || r.gateways[ip] == 0 {
+			s.mu.Unlock()
+			continue
+		}
+		if r.gateways[ip]--; r.gateways[ip] == 0 {
+			delete(r.gateways, ip)
+			if r.empty() {
+				t.deleteTopic(s, topic)
+			}
+			if g == nil {
+				g = t.gatewayIndex(ip, false)
+			}
+			if g != nil {
+				g.mu.Lock()
+				if !g.removed {
+					delete(g.topics, topic)
+				}
+				g.mu.Unlock()
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// removeGateway gateway断开时移除它在所有topic上的订阅 返回清理的topic数量
+func (t *routeTable) removeGateway(ip string) int {
+	t.indexMu.Lock()
+	g := t.index[ip]
+	delete(t.index, ip)
+	t.indexMu.Unlock()
+	if g == nil {
+		return 0
+	}
+	g.mu.Lock()
+	topics := g.topics
+	g.topics = make(map[string]struct{})
+	g.removed = true
+	g.mu.Unlock()
+	for topic := range topics {
+		s := t.shard(topic)
+		s.mu.Lock()
+		if r, ok := s.topics[topic]; ok {
+			delete(r.gateways, ip)
+			if r.empty() {
+				t.deleteTopic(s, topic)
+			}
+		}
+		s.mu.Unlock()
+	}
+	return len(topics)
+}
+
+// addStream 将订阅流登记为各topic的订阅者
+func (t *routeTable) addStream(stream *streamSubscriber) {
+	for _, topic := range stream.topics {
+		s := t.shard(topic)
+		s.mu.Lock()
+		r, ok := s.topics[topic]
+		if !ok {
+			r = &topicRoute{gateways: make(map[string]int64, 1)}
+			s.topics[topic] = r
+		}
+		if r.streams == nil {
+			r.streams = make(map[string]*streamSubscriber, 1)
+		}
+		r.streams[stream.id] = stream
+		s.mu.Unlock()
+	}
+}
+
+// removeStream 订阅流结束后移除订阅关系
+func (t *routeTable) removeStream(stream *streamSubscriber) {
+	for _, topic := range stream.topics {
+		s := t.shard(topic)
+		s.mu.Lock()
+		if r, ok := s.topics[topic]; ok {
+			delete(r.streams, stream.id)
+			if r.empty() {
+				t.deleteTopic(s, topic)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// deleteTopic topic不再有任何订阅者 调用方持有分片的锁
+func (t *routeTable) deleteTopic(s *routeShard, topic string) {
+	delete(s.topics, topic)
+	topicRates.Delete(topic)
+}
+
+// exists topic是否存在订阅关系
+func (t *routeTable) exists(topic string) bool {
+	s := t.shard(topic)
+	s.mu.RLock()
+	_, ok := s.topics[topic]
+	s.mu.RUnlock()
+	return ok
+}
+
+// view 在分片的读锁内访问topic的订阅者 topic不存在时返回false
+// fn中不能修改路由表 也不应阻塞
+func (t *routeTable) view(topic string, fn func(r *topicRoute)) bool {
+	s := t.shard(topic)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r, ok := s.topics[topic]
+	if ok {
+		fn(r)
+	}
+	return ok
+}
+
+// rangeTopics 逐个分片遍历所有topic fn返回false时停止
+// 遍历期间只持有当前分片的读锁 不是整个路由表的快照
+func (t *routeTable) rangeTopics(fn func(topic string, r *topicRoute) bool) {
+	for i := range t.shards {
+		s := &t.shards[i]
+		s.mu.RLock()
+		for topic, r := range s.topics {
+			if !fn(topic, r) {
+				s.mu.RUnlock()
+				return
+			}
+		}
+		s.mu.RUnlock()
+	}
+}
+
+// topicNum 存在订阅关系的topic数量
+func (t *routeTable) topicNum() int {
+	var n int
+	for i := range t.shards {
+		s := &t.shards[i]
+		s.mu.RLock()
+		n += len(s.topics)
+		s.mu.RUnlock()
+	}
+	return n
+}
+
+// gatewayTopicNum gateway订阅过的topic数量
+func (t *routeTable) gatewayTopicNum(ip string) int {
+	g := t.gatewayIndex(ip, false)
+	if g == nil {
+		return 0
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.topics)
+}
+
+// gatewayConnectNum gateway上订阅关系的总数 只遍历该gateway订阅过的topic
+func (t *routeTable) gatewayConnectNum(ip string) int64 {
+	g := t.gatewayIndex(ip, false)
+	if g == nil {
+		return 0
+	}
+	g.mu.Lock()
+	topics := make([]string, 0, len(g.topics))
+	for topic := range g.topics {
+		topics = append(topics, topic)
+	}
+	g.mu.Unlock()
+
+	var num int64
+	for _, topic := range topics {
+		s := t.shard(topic)
+		s.mu.RLock()
+		if r, ok := s.topics[topic]; ok {
+			num += r.gateways[ip]
+		}
+		s.mu.RUnlock()
+	}
+	return num
+}
@@ -0,0 +1,175 @@
+package manager
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRouteTable(t *testing.T) {
+	r := newRouteTable()
+	r.subscribe("gw1", []string{"room_1", "room_1", "room_2"})
+	r.subscribe("gw2", []string{"room_1"})
+	s := newStreamSubscriber([]string{"room_2", "archive"})
+	r.addStream(s)
+
+	num := func(topic string) (n int64) {
+		r.view(topic, func(route *topicRoute) { n = route.connectNum() })
+		return
+	}
+	if num("room_1") != 3 || num("room_2") != 2 || num("archive") != 1 || r.topicNum() != 3 {
+		t.Fatalf("unexpected counts %d %d %d %d", num("room_1"), num("room_2"), num("archive"), r.topicNum())
+	}
+	if r.gatewayTopicNum("gw1") != 2 || r.gatewayTopicNum("gw2") != 1 {
+		t.Errorf("reverse index should hold each topic once, got %d %d", r.gatewayTopicNum("gw1"), r.gatewayTopicNum("gw2"))
+	}
+
+	r.unsubscribe("gw1", []string{"room_1", "room_2", "nobody"})
+	if num("room_1") != 2 || r.gatewayTopicNum("gw1") != 1 {
+		t.Errorf("gw1 should still hold room_1 once, got %d %d", num("room_1"), r.gatewayTopicNum("gw1"))
+	}
+	r.unsubscribe("gw2", []string{"room_2"})
+	if num("room_2") != 1 {
+		t.Errorf("unsubscribing a topic the gateway never held should do nothing, got %d", num("room_2"))
+	}
+
+	if n := r.removeGateway("gw1"); n != 1 || num("room_1") != 1 || r.gatewayTopicNum("gw1") != 0 {
+		t.Errorf("removing gw1 should clean its topics, got %d %d", n, num("room_1"))
+	}
+	r.removeGateway("gw2")
+	if r.exists("room_1") {
+		t.Error("topic without subscribers should be deleted")
+	}
+	r.removeStream(s)
+	if r.topicNum() != 0 {
+		t.Errorf("expected an empty table, got %d topics", r.topicNum())
+	}
+}
+
+// buildRoutes 构建topics个topic的路由表 topic轮流分布在gateways个gateway上
+func buildRoutes(topics, gateways int) (*routeTable, []string) {
+	r := newRouteTable()
+	names := make([]string, topics)
+	for i := range names {
+		names[i] = "topic_" + strconv.Itoa(i)
+	}
+	for g := 0; g < gateways; g++ {
+		var mine []string
+		for i := g; i < topics; i += gateways {
+			mine = append(mine, names[i])
+		}
+		r.subscribe("gw"+strconv.Itoa(g), mine)
+	}
+	return r, names
+}
+
+var routeSizes = []int{10000, 100000, 1000000}
+
+func BenchmarkRouteSubscribe(b *testing.B) {
+	for _, size := range routeSizes {
+		b.Run(fmt.Sprintf("topics=%d", size), func(b *testing.B) {
+			r, names := buildRoutes(size, 8)
+			var n uint64
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				topic := []string{""}
+				for pb.Next() {
+					topic[0] = names[int(atomic.AddUint64(&n, 1))%size]
+					r.subscribe("gw_bench", topic)
+					r.unsubscribe("gw_bench", topic)
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkRouteTargets(b *testing.B) {
+	for _, size := range routeSizes {
+		b.Run(fmt.Sprintf("topics=%d", size), func(b *testing.B) {
+			r, names := buildRoutes(size, 8)
+			var n uint64
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				var gateways []string
+				for pb.Next() {
+					r.view(names[int(atomic.AddUint64(&n, 1))%size], func(route *topicRoute) {
+						gateways = gateways[:0]
+						for ip := range route.gateways {
+							gateways = append(gateways, ip)
+						}
+					})
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkRouteRemoveGateway 断开一个gateway的耗时只与该gateway订阅的topic数量有关
+// 路由表中其他gateway的topic数量不影响结果
+func BenchmarkRouteRemoveGateway(b *testing.B) {
+	for _, size := range routeSizes {
+		b.Run(fmt.Sprintf("topics=%d", size), func(b *testing.B) {
+			r, names := buildRoutes(size, 8)
+			mine := names[:1000]
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				r.subscribe("gw_bench", mine)
+				r.removeGateway("gw_bench")
+			}
+		})
+	}
+}
+
+// TestRouteSubscribeRemoveRace 订阅过程中gateway被移除 不能留下索引之外的路由
+func TestRouteSubscribeRemoveRace(t *testing.T) {
+	r := newRouteTable()
+	// 两个topic位于不同的分片 锁住第二个topic的分片让订阅停在中途
+	first, second := "topic_0", "topic_1"
+	for i := 2; r.shard(first) == r.shard(second); i++ {
+		second = "topic_" + strconv.Itoa(i)
+	}
+	s := r.shard(second)
+	s.mu.Lock()
+	done := make(chan struct{})
+	go func() {
+		r.subscribe("gw1", []string{first, second})
+		close(done)
+	}()
+	for r.gatewayTopicNum("gw1") != 1 {
+		runtime.Gosched()
+	}
+	if n := r.removeGateway("gw1"); n != 1 {
+		t.Errorf("expected 1 topic removed, got %d", n)
+	}
+	s.mu.Unlock()
+	<-done
+	if n := r.topicNum(); n != 0 {
+		t.Errorf("%d topics left after the gateway was removed", n)
+	}
+
+	// 并发订阅与移除 用-race运行
+	topics := make([]string, 256)
+	for i := range topics {
+		topics[i] = "topic_" + strconv.Itoa(i)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			r.subscribe("gw1", topics)
+		}()
+		go func() {
+			defer wg.Done()
+			r.removeGateway("gw1")
+		}()
+	}
+	wg.Wait()
+	r.removeGateway("gw1")
+	if n := r.topicNum(); n != 0 {
+		t.Errorf("%d topics left after the gateway was removed", n)
+	}
+}
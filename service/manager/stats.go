@@ -0,0 +1,203 @@
+package manager
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// rateWindow 推送速率的统计窗口 单位秒
+const rateWindow = 10
+
+// heartbeatInterval manager向gateway发送心跳的间隔
+const heartbeatInterval = 10 * time.Second
+
+var (
+	// topicRates topic -> *rateMeter 只统计存在订阅关系的topic 随topic一起删除
+	topicRates sync.Map
+	// publishRate 所有topic的推送速率
+	publishRate rateMeter
+)
+
+// rateMeter 按秒分槽的滑动窗口计数器
+type rateMeter struct {
+	mu     sync.Mutex
+	slots  [rateWindow]int64
+	stamps [rateWindow]int64 // 每个槽对应的秒 与当前秒不一致时说明槽已过期
+}
+
+func (m *rateMeter) mark(now int64) {
+	i := now % rateWindow
+	m.mu.Lock()
+	if m.stamps[i] != now {
+		m.stamps[i] = now
+		m.slots[i] = 0
+	}
+	m.slots[i]++
+	m.mu.Unlock()
+}
+
+// rate 最近rateWindow秒内平均每秒的消息数
+func (m *rateMeter) rate(now int64) float64 {
+	var sum int64
+	m.mu.Lock()
+	for i := range m.slots {
+		if now-m.stamps[i] < rateWindow {
+			sum += m.slots[i]
+		}
+	}
+	m.mu.Unlock()
+	return float64(sum) / rateWindow
+}
+
+// series 最近rateWindow秒每秒的消息数 从旧到新 包含当前这一秒
+func (m *rateMeter) series(now int64) []int64 {
+	res := make([]int64, rateWindow)
+	m.mu.Lock()
+	for k := range res {
+		sec := now - rateWindow + 1 + int64(k)
+		if i := sec % rateWindow; m.stamps[i] == sec {
+			res[k] = m.slots[i]
+		}
+	}
+	m.mu.Unlock()
+	return res
+}
+
+// markPublish 记录一次topic上的推送
+func markPublish(topic string) {
+	now := time.Now().Unix()
+	publishRate.mark(now)
+	value, ok := topicRates.Load(topic)
+	if !ok {
+		value, _ = topicRates.LoadOrStore(topic, new(rateMeter))
+	}
+	value.(*rateMeter).mark(now)
+}
+
+// topicRate 返回topic最近的推送速率
+func topicRate(topic string, now int64) float64 {
+	if value, ok := topicRates.Load(topic); ok {
+		return value.(*rateMeter).rate(now)
+	}
+	return 0
+}
+
+// GatewayHealth gateway连接的健康状况
+type GatewayHealth struct {
+	GatewayInfo
+	ConnectedAt time.Time    `json:"connected_at"`
+	LastRead    time.Time    `json:"last_read"`  // 最后一次收到gateway数据的时间
+	LastWrite   time.Time    `json:"last_write"` // 最后一次成功写入gateway的时间
+	Pending     int          `json:"pending"`    // 已收到但还没有分发的帧
+	Queue       GatewayQueue `json:"queue"`      // 发往该gateway的发送队列
+	Status      string       `json:"status"`     // ok | busy | stalled
+}
+
+// TopicStat topic的订阅数与推送速率
+type TopicStat struct {
+	Topic       string  `json:"topic"`
+	ConnectNum  int64   `json:"connect_num"`
+	PublishRate float64 `json:"publish_rate"` // 最近10秒平均每秒推送数
+}
+
+// DashboardStats dashboard展示的统计信息
+type DashboardStats struct {
+	Time        time.Time        `json:"time"`
+	Gateways    []*GatewayHealth `json:"gateways"`
+	TopicNum    int              `json:"topic_num"`
+	ConnectNum  int64            `json:"connect_num"`
+	StreamNum   int              `json:"stream_num"` // grpc订阅流的订阅关系数
+	PublishRate float64          `json:"publish_rate"`
+	TopTopics   []*TopicStat     `json:"top_topics"` // 按订阅数排序
+}
+
+func unixTime(nano int64) time.Time {
+	if nano == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nano)
+}
+
+// health 根据最近的读写时间与积压判断连接状态
+// 心跳每heartbeatInterval写一次 超过三个周期没有成功写入说明连接已经卡住
+func (c *connectBucket) health(now time.Time) *GatewayHealth {
+	h := &GatewayHealth{
+		ConnectedAt: unixTime(c.connectedAt),
+		LastRead:    unixTime(atomic.LoadInt64(&c.lastRead)),
+		LastWrite:   unixTime(atomic.LoadInt64(&c.lastWrite)),
+		Pending:     len(c.packetChan),
+		Queue:       c.queue(),
+		Status:      "ok",
+	}
+	last := h.LastWrite
+	if last.Before(h.ConnectedAt) {
+		last = h.ConnectedAt
+	}
+	switch {
+	case !last.IsZero() && now.Sub(last) > 3*heartbeatInterval:
+		h.Status = "stalled"
+	case cap(c.packetChan) > 0 && h.Pending > cap(c.packetChan)/2:
+		h.Status = "busy"
+	case cap(c.out) > 0 && h.Queue.Queued > cap(c.out)/2:
+		h.Status = "busy"
+	}
+	return h
+}
+
+// collectStats 遍历一次订阅关系 汇总gateway与topic的统计
+// topN 为返回的热门topic数量
+func collectStats(topN int) *DashboardStats {
+	now := time.Now()
+	stats := &DashboardStats{Time: now, Gateways: []*GatewayHealth{}, TopTopics: []*TopicStat{}}
+	gateways := make(map[string]*GatewayHealth)
+	rangeGateways(func(addr string, c *connectBucket) {
+		h := c.health(now)
+		h.Address = addr
+		gateways[h.Address] = h
+		stats.Gateways = append(stats.Gateways, h)
+	})
+
+	routes.rangeTopics(func(topic string, r *topicRoute) bool {
+		stat := &TopicStat{Topic: topic, ConnectNum: r.connectNum()}
+		stats.StreamNum += len(r.streams)
+		for ip, num := range r.gateways {
+			if g, ok := gateways[ip]; ok {
+				g.TopicNum++
+				g.ConnectNum += num
+			}
+		}
+		stats.TopicNum++
+		stats.ConnectNum += stat.ConnectNum
+		stats.TopTopics = insertTopN(stats.TopTopics, stat, topN)
+		return true
+	})
+
+	for _, stat := range stats.TopTopics {
+		stat.PublishRate = topicRate(stat.Topic, now.Unix())
+	}
+	stats.PublishRate = publishRate.rate(now.Unix())
+	sort.Slice(stats.Gateways, func(i, j int) bool { return stats.Gateways[i].Address < stats.Gateways[j].Address })
+	return stats
+}
+
+// insertTopN 将stat插入按订阅数降序排列的top列表 列表长度不超过n
+func insertTopN(top []*TopicStat, stat *TopicStat, n int) []*TopicStat {
+	if n <= 0 {
+		return top
+	}
+	if len(top) == n && top[n-1].ConnectNum >= stat.ConnectNum {
+		return top
+	}
+	i := len(top)
+	for i > 0 && top[i-1].ConnectNum < stat.ConnectNum {
+		i--
+	}
+	if len(top) < n {
+		top = append(top, nil)
+	}
+	copy(top[i+1:], top[i:])
+	top[i] = stat
+	return top
+}
@@ -0,0 +1,100 @@
+package manager
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	pb "github.com/OSMeteor/firetower/grpc/manager"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// StreamBufferSize 每个grpc订阅流可以积压的消息数 超出后断开该订阅流
+	StreamBufferSize = 1024
+
+	streamId uint64
+)
+
+// streamSubscriber 通过grpc Subscribe订阅topic的后端消费者
+// 与gateway一样登记在路由表中 推送时写入有界缓冲 由Subscribe所在的协程发送
+type streamSubscriber struct {
+	id     string
+	topics []string
+	buffer chan *pb.PushMessage
+	slow   chan struct{} // 缓冲写满时关闭
+	once   sync.Once
+}
+
+func newStreamSubscriber(topics []string) *streamSubscriber {
+	size := StreamBufferSize
+	if size <= 0 {
+		size = 1
+	}
+	return &streamSubscriber{
+		id:     "stream:" + strconv.FormatUint(atomic.AddUint64(&streamId, 1), 10),
+		topics: topics,
+		buffer: make(chan *pb.PushMessage, size),
+		slow:   make(chan struct{}),
+	}
+}
+
+// push 投递一条消息 消费者落后太多时断开订阅流而不是阻塞推送
+func (s *streamSubscriber) push(message *pb.PushMessage) {
+	select {
+	case <-s.slow:
+	case s.buffer <- message:
+	default:
+		s.once.Do(func() {
+			close(s.slow)
+		})
+	}
+}
+
+// addStream 将订阅流登记为各topic的订阅者
+func (t *topicGrpcService) addStream(s *streamSubscriber) {
+	routes.addStream(s)
+}
+
+// removeStream 订阅流结束后移除订阅关系
+func (t *topicGrpcService) removeStream(s *streamSubscriber) {
+	routes.removeStream(s)
+}
+
+// Subscribe 后端服务订阅topic的grpc流式接口
+// 订阅期间会收到这些topic上的所有推送 流结束时自动取消订阅
+func (t *topicGrpcService) Subscribe(request *pb.SubscribeRequest, stream pb.TopicService_SubscribeServer) error {
+	topics := make([]string, 0, len(request.Topic))
+	seen := make(map[string]bool, len(request.Topic))
+	for _, topic := range request.Topic {
+		if topic != "" && !seen[topic] {
+			seen[topic] = true
+			topics = append(topics, topic)
+		}
+	}
+	if len(topics) == 0 {
+		return status.Error(codes.InvalidArgument, "topic is empty")
+	}
+
+	s := newStreamSubscriber(topics)
+	t.addStream(s)
+	defer t.removeStream(s)
+	Logger("INFO", fmt.Sprintf("new stream subscriber %s: %v", s.id, topics))
+
+	for {
+		select {
+		case message := <-s.buffer:
+			if err := stream.Send(message); err != nil {
+				return err
+			}
+		case <-s.slow:
+			Logger("ERROR", fmt.Sprintf("stream subscriber %s is too slow, disconnected", s.id))
+			return status.Error(codes.ResourceExhausted, "subscriber is too slow")
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
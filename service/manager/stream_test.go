@@ -0,0 +1,109 @@
+package manager
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	pb "github.com/OSMeteor/firetower/grpc/manager"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newGrpcClient(t *testing.T) pb.TopicServiceClient {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := grpc.NewServer()
+	pb.RegisterTopicServiceServer(s, grpcService)
+	go s.Serve(lis)
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		s.Stop()
+	})
+	return pb.NewTopicServiceClient(conn)
+}
+
+func TestStreamSubscribe(t *testing.T) {
+	client := newGrpcClient(t)
+	g := addFakeGateway(t, "gw1", "room_1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := client.Subscribe(ctx, &pb.SubscribeRequest{Topic: []string{"room_1", "archive"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitTopic(t, "archive", true)
+
+	// 只有订阅流订阅的topic也可以推送
+	if res, err := client.Publish(context.Background(), &pb.PublishRequest{Topic: "archive", Data: []byte("a"), MessageId: "1", Source: "test"}); err != nil || !res.Ok {
+		t.Fatalf("publish to a stream-only topic failed: %v %v", res, err)
+	}
+	if message, err := stream.Recv(); err != nil || message.Topic != "archive" || string(message.Data) != "a" || message.MessageId != "1" {
+		t.Fatalf("unexpected message %v %v", message, err)
+	}
+
+	// gateway与订阅流都能收到
+	grpcService.notifyTopic("publish", "2", "user", "room_1", []byte("b"))
+	if message, err := stream.Recv(); err != nil || message.Topic != "room_1" || message.Source != "user" {
+		t.Fatalf("unexpected message %v %v", message, err)
+	}
+	if frame := g.next(t); string(frame.Data) != "b" {
+		t.Errorf("gateway should still receive the publish, got %q", frame.Data)
+	}
+
+	// 控制帧不会投递给订阅流 也不计入gateway数量
+	if n, _ := grpcService.removeTopic("archive"); n != 0 {
+		t.Errorf("streams should not be counted as gateways, got %d", n)
+	}
+
+	if num, _ := client.GetConnectNum(context.Background(), &pb.GetConnectNumRequest{Topic: "room_1"}); num.Number != 2 {
+		t.Errorf("stream should count as a subscriber, got %d", num.Number)
+	}
+
+	cancel()
+	waitTopic(t, "archive", false)
+}
+
+func TestStreamSlowConsumer(t *testing.T) {
+	StreamBufferSize = 1
+	defer func() { StreamBufferSize = 1024 }()
+
+	s := newStreamSubscriber([]string{"room_1"})
+	s.push(&pb.PushMessage{Topic: "room_1"})
+	s.push(&pb.PushMessage{Topic: "room_1"})
+	select {
+	case <-s.slow:
+	default:
+		t.Fatal("a full buffer should mark the subscriber as slow")
+	}
+
+	client := newGrpcClient(t)
+	if stream, err := client.Subscribe(context.Background(), &pb.SubscribeRequest{}); err == nil {
+		_, err = stream.Recv()
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("expected InvalidArgument, got %v", err)
+		}
+	}
+}
+
+func waitTopic(t *testing.T, topic string, exist bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if routes.exists(topic) == exist {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("topic %s exist should be %v", topic, exist)
+}
@@ -0,0 +1,312 @@
+package manager
+
+import (
+	"container/heap"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// topic列表支持的排序字段
+const (
+	TopicSortName        = "name"
+	TopicSortConnectNum  = "connect_num"
+	TopicSortPublishRate = "publish_rate"
+)
+
+var (
+	// TopicPageSize topic列表默认每页数量
+	TopicPageSize = 100
+	// TopicMaxPageSize topic列表每页最大数量
+	TopicMaxPageSize = 1000
+)
+
+// TopicSummary topic列表中的一项
+type TopicSummary struct {
+	Topic       string  `json:"topic"`
+	ConnectNum  int64   `json:"connect_num"`
+	GatewayNum  int     `json:"gateway_num"`
+	PublishRate float64 `json:"publish_rate"` // 最近10秒平均每秒推送数
+}
+
+// TopicPage 一页topic
+type TopicPage struct {
+	Topics     []*TopicSummary `json:"topics"`
+	Total      int             `json:"total"`                 // 满足过滤条件的topic数量
+	NextCursor string          `json:"next_cursor,omitempty"` // 为空表示没有下一页
+}
+
+// TopicDetail 单个topic的详细信息
+type TopicDetail struct {
+	TopicDistribution
+	StreamNum   int     `json:"stream_num"` // grpc订阅流数量 不包含在gateways中
+	PublishRate float64 `json:"publish_rate"`
+	Recent      []int64 `json:"recent"` // 最近10秒每秒的推送数 从旧到新
+}
+
+// topicQuery topic列表的查询条件
+type topicQuery struct {
+	prefix  string
+	pattern string
+	sort    string
+	desc    bool
+	limit   int
+	cursor  *topicCursor
+}
+
+// topicCursor 上一页最后一项的位置 以base64编码后返回给调用方
+type topicCursor struct {
+	Sort  string  `json:"s"`
+	Desc  bool    `json:"d"`
+	Value float64 `json:"v"`
+	Topic string  `json:"t"`
+}
+
+func (c *topicCursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeTopicCursor(s string) (*topicCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	c := new(topicCursor)
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// parseTopicQuery 解析查询参数
+// 默认按订阅数降序 按名称排序时默认升序
+func parseTopicQuery(r *http.Request) (*topicQuery, string) {
+	values := r.URL.Query()
+	q := &topicQuery{
+		prefix:  values.Get("prefix"),
+		pattern: values.Get("pattern"),
+		sort:    values.Get("sort"),
+		limit:   TopicPageSize,
+	}
+	switch q.sort {
+	case "":
+		q.sort = TopicSortConnectNum
+		q.desc = true
+	case TopicSortName:
+	case TopicSortConnectNum, TopicSortPublishRate:
+		q.desc = true
+	default:
+		return nil, "invalid sort"
+	}
+	switch values.Get("order") {
+	case "":
+	case "asc":
+		q.desc = false
+	case "desc":
+		q.desc = true
+	default:
+		return nil, "invalid order"
+	}
+	if q.pattern != "" {
+		if _, err := path.Match(q.pattern, ""); err != nil {
+			return nil, "invalid pattern"
+		}
+	}
+	if v := values.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, "invalid limit"
+		}
+		q.limit = n
+	}
+	if q.limit > TopicMaxPageSize {
+		q.limit = TopicMaxPageSize
+	}
+	if v := values.Get("cursor"); v != "" {
+		c, err := decodeTopicCursor(v)
+		if err != nil || c.Sort != q.sort || c.Desc != q.desc {
+			return nil, "invalid cursor"
+		}
+		q.cursor = c
+	}
+	return q, ""
+}
+
+func (q *topicQuery) match(topic string) bool {
+	if !strings.HasPrefix(topic, q.prefix) {
+		return false
+	}
+	if q.pattern != "" {
+		ok, _ := path.Match(q.pattern, topic)
+		return ok
+	}
+	return true
+}
+
+func (q *topicQuery) value(s *TopicSummary) float64 {
+	switch q.sort {
+	case TopicSortConnectNum:
+		return float64(s.ConnectNum)
+	case TopicSortPublishRate:
+		return s.PublishRate
+	}
+	return 0
+}
+
+// before 返回在结果中a是否排在b之前 值相同时按名称升序
+func (q *topicQuery) before(a *TopicSummary, av float64, b *TopicSummary, bv float64) bool {
+	if q.sort == TopicSortName {
+		if q.desc {
+			return a.Topic > b.Topic
+		}
+		return a.Topic < b.Topic
+	}
+	if av != bv {
+		if q.desc {
+			return av > bv
+		}
+		return av < bv
+	}
+	return a.Topic < b.Topic
+}
+
+type topicPageItem struct {
+	summary *TopicSummary
+	value   float64 // 排序字段的值
+}
+
+// topicPageHeap 以当前页中排在最后的一项为堆顶 用于只保留前limit项而不必对全部topic排序
+type topicPageHeap struct {
+	q     *topicQuery
+	items []topicPageItem
+}
+
+func (h *topicPageHeap) Len() int { return len(h.items) }
+func (h *topicPageHeap) Less(i, j int) bool {
+	return h.q.before(h.items[j].summary, h.items[j].value, h.items[i].summary, h.items[i].value)
+}
+func (h *topicPageHeap) Swap(i, j int)      { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *topicPageHeap) Push(x interface{}) { h.items = append(h.items, x.(topicPageItem)) }
+func (h *topicPageHeap) Pop() interface{} {
+	n := len(h.items) - 1
+	item := h.items[n]
+	h.items = h.items[:n]
+	return item
+}
+
+func (h *topicPageHeap) add(s *TopicSummary, v float64) {
+	if len(h.items) < h.q.limit {
+		heap.Push(h, topicPageItem{summary: s, value: v})
+		return
+	}
+	if top := h.items[0]; h.q.before(s, v, top.summary, top.value) {
+		h.items[0] = topicPageItem{summary: s, value: v}
+		heap.Fix(h, 0)
+	}
+}
+
+// queryTopics 查询一页topic
+func queryTopics(q *topicQuery) *TopicPage {
+	var (
+		now     = time.Now().Unix()
+		page    = &TopicPage{Topics: []*TopicSummary{}}
+		h       = &topicPageHeap{q: q}
+		after   int // 排在游标之后的topic数量
+		cursor  *TopicSummary
+		cursorV float64
+	)
+	if q.cursor != nil {
+		cursor, cursorV = &TopicSummary{Topic: q.cursor.Topic}, q.cursor.Value
+	}
+
+	routes.rangeTopics(func(topic string, r *topicRoute) bool {
+		if !q.match(topic) {
+			return true
+		}
+		s := &TopicSummary{Topic: topic, ConnectNum: r.connectNum(), GatewayNum: len(r.gateways)}
+		if q.sort == TopicSortPublishRate {
+			s.PublishRate = topicRate(topic, now)
+		}
+		page.Total++
+		v := q.value(s)
+		if cursor != nil && !q.before(cursor, cursorV, s, v) {
+			return true
+		}
+		after++
+		h.add(s, v)
+		return true
+	})
+
+	sort.Slice(h.items, func(i, j int) bool {
+		return q.before(h.items[i].summary, h.items[i].value, h.items[j].summary, h.items[j].value)
+	})
+	for _, item := range h.items {
+		if q.sort != TopicSortPublishRate {
+			item.summary.PublishRate = topicRate(item.summary.Topic, now)
+		}
+		page.Topics = append(page.Topics, item.summary)
+	}
+	if n := len(h.items); n > 0 && after > n {
+		last := h.items[n-1]
+		page.NextCursor = (&topicCursor{Sort: q.sort, Desc: q.desc, Value: last.value, Topic: last.summary.Topic}).encode()
+	}
+	return page
+}
+
+// topicDetail 查询topic的订阅分布与推送速率
+func topicDetail(topic string) (*TopicDetail, bool) {
+	now := time.Now().Unix()
+	res := &TopicDetail{TopicDistribution: TopicDistribution{Topic: topic, Gateways: []*GatewayInfo{}}}
+	ok := routes.view(topic, func(r *topicRoute) {
+		res.ConnectNum = r.connectNum()
+		res.StreamNum = len(r.streams)
+		for ip, num := range r.gateways {
+			res.Gateways = append(res.Gateways, &GatewayInfo{Address: ip, TopicNum: 1, ConnectNum: num})
+		}
+	})
+	if !ok {
+		return nil, false
+	}
+	sort.Slice(res.Gateways, func(i, j int) bool { return res.Gateways[i].ConnectNum > res.Gateways[j].ConnectNum })
+
+	res.PublishRate = topicRate(topic, now)
+	res.Recent = make([]int64, rateWindow)
+	if value, ok := topicRates.Load(topic); ok {
+		res.Recent = value.(*rateMeter).series(now)
+	}
+	return res, true
+}
+
+// registerTopicHandlers 在mux上注册v2版本的topic查询接口 与dashboard一样默认需要AdminToken
+func registerTopicHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("GET /v2/topics", statsAuth(topicListHandler))
+	mux.HandleFunc("GET /v2/topics/{name...}", statsAuth(topicDetailHandler))
+}
+
+// topicListHandler 分页查询topic
+// GET /v2/topics?prefix=room_&pattern=room_*&sort=connect_num&order=desc&limit=100&cursor=
+func topicListHandler(w http.ResponseWriter, r *http.Request) {
+	q, errInfo := parseTopicQuery(r)
+	if errInfo != "" {
+		writeJSON(w, http.StatusBadRequest, 4001, errInfo, nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, 0, "", queryTopics(q))
+}
+
+// topicDetailHandler 查询单个topic的详细信息
+// GET /v2/topics/room_1
+func topicDetailHandler(w http.ResponseWriter, r *http.Request) {
+	res, ok := topicDetail(r.PathValue("name"))
+	if !ok {
+		writeJSON(w, http.StatusNotFound, 4040, ErrorTopicNotExist.Error(), nil)
+		return
+	}
+	writeJSON(w, http.StatusOK, 0, "", res)
+}
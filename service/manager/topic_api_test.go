@@ -0,0 +1,162 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	pb "github.com/OSMeteor/firetower/grpc/manager"
+)
+
+func newTopicServer(t *testing.T) *httptest.Server {
+	AdminToken = "secret"
+	mux := http.NewServeMux()
+	registerTopicHandlers(mux)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(func() {
+		srv.Close()
+		AdminToken = ""
+	})
+	return srv
+}
+
+// subscribeN 在gateway上为topic登记n个订阅
+func subscribeN(t *testing.T, addr, topic string, n int) {
+	for i := 0; i < n; i++ {
+		grpcService.SubscribeTopic(context.Background(), &pb.SubscribeTopicRequest{Topic: []string{topic}, Ip: addr})
+	}
+	t.Cleanup(func() {
+		for i := 0; i < n; i++ {
+			grpcService.UnSubscribeTopic(context.Background(), &pb.UnSubscribeTopicRequest{Topic: []string{topic}, Ip: addr})
+		}
+	})
+}
+
+func topicNames(page *TopicPage) []string {
+	var res []string
+	for _, s := range page.Topics {
+		res = append(res, s.Topic)
+	}
+	return res
+}
+
+func TestTopicAuth(t *testing.T) {
+	srv := newTopicServer(t)
+	subscribeN(t, "gw1", "room_1", 1)
+	for _, path := range []string{"/v2/topics", "/v2/topics/room_1"} {
+		res, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401 without token, got %d", path, res.StatusCode)
+		}
+	}
+
+	PublicStats = true
+	defer func() { PublicStats = false }()
+	res, err := http.Get(srv.URL + "/v2/topics/room_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("public stats should not need a token, got %d", res.StatusCode)
+	}
+}
+
+func TestTopicList(t *testing.T) {
+	srv := newTopicServer(t)
+	addFakeGateway(t, "gw1")
+	for i := 1; i <= 5; i++ {
+		subscribeN(t, "gw1", fmt.Sprintf("room_%d", i), i)
+	}
+	subscribeN(t, "gw1", "lobby", 3)
+
+	var page TopicPage
+	adminDo(t, srv, http.MethodGet, "/v2/topics?limit=2", "", &page)
+	if got := fmt.Sprint(topicNames(&page)); got != "[room_5 room_4]" || page.Total != 6 || page.NextCursor == "" {
+		t.Fatalf("unexpected first page %s total %d", got, page.Total)
+	}
+
+	// 订阅数相同时按名称排序 翻页不会重复或遗漏
+	var all []string
+	cursor := ""
+	for i := 0; i < 10; i++ {
+		var p TopicPage
+		adminDo(t, srv, http.MethodGet, "/v2/topics?limit=2&cursor="+url.QueryEscape(cursor), "", &p)
+		all = append(all, topicNames(&p)...)
+		if cursor = p.NextCursor; cursor == "" {
+			break
+		}
+	}
+	if got := fmt.Sprint(all); got != "[room_5 room_4 lobby room_3 room_2 room_1]" {
+		t.Errorf("unexpected pages %s", got)
+	}
+
+	first := page.NextCursor
+	page = TopicPage{}
+	adminDo(t, srv, http.MethodGet, "/v2/topics?prefix=room_&sort=name&order=desc", "", &page)
+	if got := fmt.Sprint(topicNames(&page)); got != "[room_5 room_4 room_3 room_2 room_1]" || page.NextCursor != "" {
+		t.Errorf("unexpected prefix query %s %q", got, page.NextCursor)
+	}
+
+	page = TopicPage{}
+	adminDo(t, srv, http.MethodGet, "/v2/topics?pattern=room_%5B2-3%5D&sort=name", "", &page)
+	if got := fmt.Sprint(topicNames(&page)); got != "[room_2 room_3]" || page.Total != 2 {
+		t.Errorf("unexpected pattern query %s", got)
+	}
+
+	for _, query := range []string{"sort=size", "order=up", "limit=0", "pattern=%5B", "cursor=xx", "sort=name&cursor=" + url.QueryEscape(first)} {
+		if status, _ := adminDo(t, srv, http.MethodGet, "/v2/topics?"+query, "", nil); status != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, status)
+		}
+	}
+}
+
+func TestTopicListByRate(t *testing.T) {
+	srv := newTopicServer(t)
+	g := addFakeGateway(t, "gw1", "quiet", "busy")
+	for i := 0; i < 3; i++ {
+		grpcService.notifyTopic("publish", "1", "test", "busy", []byte(`1`))
+		g.next(t)
+	}
+
+	var page TopicPage
+	adminDo(t, srv, http.MethodGet, "/v2/topics?sort=publish_rate", "", &page)
+	if len(page.Topics) != 2 || page.Topics[0].Topic != "busy" || page.Topics[0].PublishRate <= 0 || page.Topics[1].PublishRate != 0 {
+		t.Fatalf("unexpected rate order %+v", page.Topics)
+	}
+}
+
+func TestTopicDetail(t *testing.T) {
+	srv := newTopicServer(t)
+	g := addFakeGateway(t, "gw1", "chat/room_1")
+	addFakeGateway(t, "gw2")
+	subscribeN(t, "gw2", "chat/room_1", 2)
+	grpcService.notifyTopic("publish", "1", "test", "chat/room_1", []byte(`1`))
+	g.next(t)
+
+	var detail TopicDetail
+	if status, _ := adminDo(t, srv, http.MethodGet, "/v2/topics/chat/room_1", "", &detail); status != http.StatusOK {
+		t.Fatalf("unexpected status %d", status)
+	}
+	if detail.Topic != "chat/room_1" || detail.ConnectNum != 3 || len(detail.Gateways) != 2 || detail.Gateways[0].Address != "gw2" {
+		t.Fatalf("unexpected detail %+v", detail)
+	}
+	var recent int64
+	for _, n := range detail.Recent {
+		recent += n
+	}
+	if len(detail.Recent) != rateWindow || recent != 1 || detail.PublishRate <= 0 {
+		t.Errorf("unexpected rate %v %v", detail.PublishRate, detail.Recent)
+	}
+
+	if status, _ := adminDo(t, srv, http.MethodGet, "/v2/topics/nobody", "", nil); status != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", status)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/binary"
+	"io"
+	"strconv"
 
 	"github.com/pkg/errors"
 )
@@ -23,6 +25,16 @@ const (
 
 // Enpack 封包
 func Enpack(pushType, messageId, source, topic string, content []byte) ([]byte, error) {
+	return enpack(pushType, messageId, source, topic, 0, content)
+}
+
+// EnpackDeadline 封包并携带消息的过期时间(unix毫秒)
+// 过期时间作为topic之后的一个参数 deadline小于等于0时与Enpack完全相同
+func EnpackDeadline(pushType, messageId, source, topic string, deadline int64, content []byte) ([]byte, error) {
+	return enpack(pushType, messageId, source, topic, deadline, content)
+}
+
+func enpack(pushType, messageId, source, topic string, deadline int64, content []byte) ([]byte, error) {
 	if pushType == "" {
 		return nil, errors.New("type is empty")
 	}
@@ -41,6 +53,10 @@ func Enpack(pushType, messageId, source, topic string, content []byte) ([]byte,
 	res = append(res, []byte(source)...)
 	res = append(res, []byte(ConstSplitSpace)...)
 	res = append(res, []byte(topic)...)
+	if deadline > 0 {
+		res = append(res, []byte(ConstSplitSpace)...)
+		res = strconv.AppendInt(res, deadline, 10)
+	}
 	res = append(res, ConstNewLine)
 	res = append(res, content...)
 	return append(append([]byte(ConstHeader), IntToBytes(len(res))...), res...), nil
@@ -48,6 +64,16 @@ func Enpack(pushType, messageId, source, topic string, content []byte) ([]byte,
 
 // Depack 解包
 func Depack(buffer []byte, readerChannel chan *SendMessage) ([]byte, error) {
+	return depack(buffer, readerChannel, nil)
+}
+
+// DepackPriority 解包 控制消息(见IsControl)写入controlChannel 其他消息写入readerChannel
+// 接收方优先处理controlChannel 使踢人等操作不必排在大量推送之后
+func DepackPriority(buffer []byte, readerChannel, controlChannel chan *SendMessage) ([]byte, error) {
+	return depack(buffer, readerChannel, controlChannel)
+}
+
+func depack(buffer []byte, readerChannel, controlChannel chan *SendMessage) ([]byte, error) {
 	length := len(buffer)
 	var (
 		i   int
@@ -140,8 +166,16 @@ func Depack(buffer []byte, readerChannel chan *SendMessage) ([]byte, error) {
 			if len(params) >= 5 {
 				sendMessage.Type = string(params[0])
 				sendMessage.Topic = string(params[3])
-				sendMessage.Data = params[4]
-				readerChannel <- sendMessage
+				sendMessage.Data = params[len(params)-1]
+				if len(params) > 5 {
+					// 携带过期时间的帧
+					sendMessage.Deadline, _ = strconv.ParseInt(string(params[4]), 10, 64)
+				}
+				if controlChannel != nil && IsControl(sendMessage.Type) {
+					controlChannel <- sendMessage
+				} else {
+					readerChannel <- sendMessage
+				}
 			}
 			
 			// IMPORTANT: Advance index
@@ -159,6 +193,40 @@ func Depack(buffer []byte, readerChannel chan *SendMessage) ([]byte, error) {
 	return buffer[i:], nil // 返回剩馀部分
 }
 
+// ReadFrame 从流中读取一个完整的包 适用于按连接逐个读取的场景(与Depack的批量解包相对)
+// maxSize 限制包体的最大长度 小于等于0表示不限制
+func ReadFrame(r io.Reader, maxSize int) (*SendMessage, error) {
+	head := make([]byte, ConstHeaderLength+ConstIntLength)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	if string(head[:ConstHeaderLength]) != ConstHeader {
+		return nil, errors.New("invalid frame header")
+	}
+	length := BytesToInt(head[ConstHeaderLength:])
+	if length <= 0 || (maxSize > 0 && length > maxSize) {
+		return nil, errors.Errorf("invalid frame length %d", length)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	line := body
+	var content []byte
+	if i := bytes.IndexByte(body, ConstNewLine); i >= 0 {
+		line, content = body[:i], body[i+1:]
+	}
+	params := bytes.SplitN(line, []byte(ConstSplitSpace), 4)
+	if len(params) < 4 {
+		return nil, errors.New("包解析出错")
+	}
+	sendMessage := GetSendMessage(string(params[1]), string(params[2]))
+	sendMessage.Type = string(params[0])
+	sendMessage.Topic = string(params[3])
+	sendMessage.Data = content
+	return sendMessage, nil
+}
+
 // IntToBytes 整形转换成字节
 func IntToBytes(n int) []byte {
 	x := int32(n)
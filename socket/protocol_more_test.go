@@ -1,6 +1,9 @@
 package socket
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func TestIntToBytesAndBack(t *testing.T) {
 	tests := []int{0, 1, 255, 256, 65535, 2147483647}
@@ -30,3 +33,50 @@ func TestEnpack(t *testing.T) {
 		t.Error("Enpack should fail with nil content")
 	}
 }
+
+func TestDepackPriority(t *testing.T) {
+	var buffer []byte
+	for _, pushType := range []string{PublishKey, OfflineUserKey, PublishKey, OfflineTopicKey} {
+		packet, err := Enpack(pushType, "1", "s", "t", []byte("d"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		buffer = append(buffer, packet...)
+	}
+	data, control := make(chan *SendMessage, 4), make(chan *SendMessage, 4)
+	if _, err := DepackPriority(buffer, data, control); err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 2 || len(control) != 2 {
+		t.Fatalf("expected 2 publish and 2 control messages, got %d and %d", len(data), len(control))
+	}
+	if m := <-control; m.Type != OfflineUserKey {
+		t.Errorf("control messages should keep their order, got %s", m.Type)
+	}
+}
+
+func TestEnpackDeadline(t *testing.T) {
+	plain, _ := Enpack(PublishKey, "1", "s", "room_1", []byte("a b"))
+	if same, _ := EnpackDeadline(PublishKey, "1", "s", "room_1", 0, []byte("a b")); string(same) != string(plain) {
+		t.Error("frames without deadline should not change")
+	}
+	packet, err := EnpackDeadline(PublishKey, "1", "s", "room_1", 1700000000000, []byte("a b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan *SendMessage, 2)
+	if _, err := Depack(append(packet, plain...), ch); err != nil {
+		t.Fatal(err)
+	}
+	m := <-ch
+	if m.Topic != "room_1" || string(m.Data) != "a b" || m.Deadline != 1700000000000 {
+		t.Errorf("unexpected message %s %q %d", m.Topic, m.Data, m.Deadline)
+	}
+	if !m.Expired(time.UnixMilli(1700000000000)) || m.Expired(time.UnixMilli(1699999999999)) {
+		t.Error("message should expire at its deadline")
+	}
+	m.Recycling()
+	if m = <-ch; m.Deadline != 0 || string(m.Data) != "a b" || m.Expired(time.Now()) {
+		t.Errorf("message without deadline should never expire, got %d", m.Deadline)
+	}
+}
@@ -78,6 +78,33 @@ func TestDepack(t *testing.T) {
 	}
 }
 
+func TestReadFrame(t *testing.T) {
+	packet, _ := Enpack("publish", "42", "device", "room/1", []byte("line1\nline2"))
+	var buffer bytes.Buffer
+	buffer.Write(packet)
+	buffer.Write(packet)
+
+	for i := 0; i < 2; i++ {
+		msg, err := ReadFrame(&buffer, 1024)
+		if err != nil {
+			t.Fatalf("ReadFrame failed: %v", err)
+		}
+		if msg.Type != "publish" || msg.Context.Id != "42" || msg.Context.Source != "device" || msg.Topic != "room/1" {
+			t.Errorf("unexpected frame %+v", msg)
+		}
+		if string(msg.Data) != "line1\nline2" {
+			t.Errorf("unexpected content %q", msg.Data)
+		}
+	}
+
+	if _, err := ReadFrame(bytes.NewReader(packet), 8); err == nil {
+		t.Error("expected error for frame larger than maxSize")
+	}
+	if _, err := ReadFrame(bytes.NewReader(append([]byte("BadHeader!"), packet[10:]...)), 0); err == nil {
+		t.Error("expected error for invalid header")
+	}
+}
+
 func BenchmarkDepack(b *testing.B) {
 	pushType := "test"
 	messageId := "1"
@@ -21,6 +21,15 @@ const (
 	OfflineUserKey = "offline_user"
 )
 
+// IsControl 踢人、按topic退订等控制消息 在各级队列中优先于推送消息处理
+func IsControl(pushType string) bool {
+	switch pushType {
+	case OfflineTopicByUserIdKey, OfflineTopicKey, OfflineUserKey:
+		return true
+	}
+	return false
+}
+
 // TcpClient tcp客户端结构体
 type TcpClient struct {
 	Address   string
@@ -28,6 +37,7 @@ type TcpClient struct {
 	closeChan chan struct{}
 	Conn      net.Conn
 	readIn      chan *SendMessage
+	controlIn   chan *SendMessage // 控制消息 优先于readIn处理
 	sendOut     chan []byte
 	mutex       sync.Mutex
 	manualClose bool
@@ -50,6 +60,7 @@ type SendMessage struct {
 	MessageType int
 	Data        json.RawMessage `json:"data"`
 	Topic       string
+	Deadline    int64 // 过期时间 unix毫秒 0表示不过期
 }
 
 type sendLife struct {
@@ -70,9 +81,15 @@ func GetSendMessage(id, source string) *SendMessage {
 	sendMessage.Context.StartTime = time.Now()
 	sendMessage.Context.Id = id
 	sendMessage.Context.Source = source
+	sendMessage.Deadline = 0
 	return sendMessage
 }
 
+// Expired 消息是否已经过期 过期的消息不再推送
+func (s *SendMessage) Expired(now time.Time) bool {
+	return s.Deadline > 0 && now.UnixMilli() >= s.Deadline
+}
+
 func init() {
 	sendPool.New = func() interface{} {
 		return &SendMessage{
@@ -87,8 +104,9 @@ func NewClient(address string) *TcpClient {
 	return &TcpClient{
 		Address: address,
 		isClose: false,
-		readIn:  make(chan *SendMessage, 1024),
-		sendOut: make(chan []byte, 1024),
+		readIn:    make(chan *SendMessage, 1024),
+		controlIn: make(chan *SendMessage, 1024),
+		sendOut:   make(chan []byte, 1024),
 	}
 }
 
@@ -140,7 +158,7 @@ func (t *TcpClient) Connect() error {
 				}
 				return
 			}
-			overflow, err = Depack(append(overflow, msg[:l]...), t.readIn)
+			overflow, err = DepackPriority(append(overflow, msg[:l]...), t.readIn, t.controlIn)
 			if err != nil {
 				fmt.Println("[manager client] depack error:", err)
 			}
@@ -245,6 +263,33 @@ func (t *TcpClient) Publish(messageId, source, topic string, data json.RawMessag
 	return t.send(b)
 }
 
+// ReadControl 从tcp通道中读取控制消息
+func (t *TcpClient) ReadControl() (*SendMessage, error) {
+	if t.isClose {
+		return nil, ErrorClose
+	}
+	return <-t.controlIn, nil
+}
+
+// OnControl 当有新的控制消息到达tcp客户端时触发
+// 控制消息在独立的协程中回调 不会被OnPush回调中阻塞的推送消息延迟
+func (t *TcpClient) OnControl(fn func(message *SendMessage)) {
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				fmt.Printf("PANIC: OnControl callback runner recovered: %v\n", err)
+			}
+		}()
+		for {
+			message, err := t.ReadControl()
+			if err != nil {
+				return
+			}
+			fn(message)
+		}
+	}()
+}
+
 // OnPush 当有新的推送消息到达tcp客户端时触发
 func (t *TcpClient) OnPush(fn func(message *SendMessage)) {
 	go func() {